@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/spf13/cobra"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+var attachCmd = &cobra.Command{
+	Use:   "attach <branch>",
+	Short: "Attach to the tmux window of the agent running in a replica",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, repoDir, err := currentRepoDir()
+		if err != nil {
+			return err
+		}
+		session, window, err := handlers.FindAgentWindow(context.Background(), repoDir, args[0], utils.DefaultTmuxFunc)
+		if err != nil {
+			return err
+		}
+		return utils.AttachTmux(session, window)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(attachCmd)
+}
@@ -3,37 +3,38 @@ package cmd
 import (
 	"context"
 	"fmt"
-	"os"
+	"io"
+	"text/tabwriter"
 
 	"github.com/spf13/cobra"
 	"github.com/terakoya76/git-replicator/internal/handlers"
-	"github.com/terakoya76/git-replicator/internal/utils"
 )
 
 var branchCmd = &cobra.Command{
 	Use:   "branch",
 	Short: "List branch directories under the current repository (like git switch)",
+	Long: `List branch directories under the current repository, with the status and task recorded
+in their metadata (see switch --task and meta). Use --output json for the full metadata.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		cwd, err := os.Getwd()
-		if err != nil {
-			return fmt.Errorf("failed to get current directory: %w", err)
-		}
-		rootDir, err := utils.GetGitReplicatorRoot()
-		if err != nil {
-			return fmt.Errorf("failed to get git-replicator root: %w", err)
-		}
-		repoDir, err := utils.FindRepoDir(cwd, rootDir)
+		_, repoDir, err := currentRepoDir()
 		if err != nil {
 			return err
 		}
-		branches, err := handlers.ListBranchDirs(context.Background(), repoDir)
+		branches, err := handlers.DescribeBranchDirs(context.Background(), repoDir)
 		if err != nil {
 			return err
 		}
-		for _, b := range branches {
-			fmt.Println(b)
-		}
-		return nil
+		return newPrinter().Print(branches, func(w io.Writer) error {
+			tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+			for _, b := range branches {
+				if b.Status == "" && b.Task == "" {
+					fmt.Fprintln(tw, b.Name)
+					continue
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\n", b.Name, b.Status, b.Task)
+			}
+			return tw.Flush()
+		})
 	},
 }
 
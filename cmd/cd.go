@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+)
+
+var cdCmd = &cobra.Command{
+	Use:   "cd <branch>",
+	Short: "Print the path of a branch directory under the current repository (changes directory with shell-init)",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, repoDir, err := currentRepoDir()
+		if err != nil {
+			return err
+		}
+		branchDir, err := handlers.ResolveBranchDir(context.Background(), repoDir, args[0])
+		if err != nil {
+			return err
+		}
+		result := handlers.BranchDirInfo{Name: args[0], Path: branchDir}
+		return newPrinter().Print(result, func(w io.Writer) error {
+			_, err := fmt.Fprintln(w, branchDir)
+			return err
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cdCmd)
+}
@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+var claimCmd = &cobra.Command{
+	Use:   "claim [branch]",
+	Short: "Lease a replica so that no other agent works in it",
+	Long: `Lease the named replica, or the first replica of the current repository without a valid
+lease, and print its path. The lease records the owner, PID, host and expiry in
+<replica>/.git/git-replicator/lease.json.
+
+Claiming a replica leased by the same owner renews the lease. Leases of other owners are
+only taken over once expired, or with --force. The owner defaults to $GIT_REPLICATOR_OWNER
+or the current user, so agents sharing a user should set it. delete, gc, prune and exec
+refuse replicas leased by someone else.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		owner, err := flags.GetString("owner")
+		if err != nil {
+			return err
+		}
+		pid, err := flags.GetInt("pid")
+		if err != nil {
+			return err
+		}
+		ttlStr, err := flags.GetString("ttl")
+		if err != nil {
+			return err
+		}
+		force, err := flags.GetBool("force")
+		if err != nil {
+			return err
+		}
+		ttl, err := utils.ParseDuration(ttlStr)
+		if err != nil {
+			return err
+		}
+		if owner == "" {
+			owner = handlers.DefaultLeaseOwner()
+		}
+		if pid == 0 {
+			pid = os.Getppid()
+		}
+		_, repoDir, err := currentRepoDir()
+		if err != nil {
+			return err
+		}
+		opts := handlers.ClaimOptions{RepoDir: repoDir, Owner: owner, PID: pid, TTL: ttl, Force: force, Now: time.Now()}
+		if len(args) == 1 {
+			opts.Name = args[0]
+		}
+		result, err := handlers.Claim(context.Background(), opts)
+		if err != nil {
+			return err
+		}
+		return newPrinter().Print(result, func(w io.Writer) error {
+			_, err := fmt.Fprintln(w, result.Dir)
+			return err
+		})
+	},
+}
+
+var releaseCmd = &cobra.Command{
+	Use:   "release [branch]",
+	Short: "Release the lease of a replica",
+	Long: `Release the lease of the named replica, or of the replica containing the current directory.
+Leases of other owners are only released once expired, or with --force.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		owner, err := cmd.Flags().GetString("owner")
+		if err != nil {
+			return err
+		}
+		force, err := cmd.Flags().GetBool("force")
+		if err != nil {
+			return err
+		}
+		if owner == "" {
+			owner = handlers.DefaultLeaseOwner()
+		}
+		_, repoDir, err := currentRepoDir()
+		if err != nil {
+			return err
+		}
+		opts := handlers.ReleaseOptions{RepoDir: repoDir, Owner: owner, Force: force, Now: time.Now()}
+		if len(args) == 1 {
+			opts.Name = args[0]
+		} else {
+			cwd, err := os.Getwd()
+			if err != nil {
+				return fmt.Errorf("failed to get current directory: %w", err)
+			}
+			if opts.Name, err = utils.FindReplicaName(cwd, repoDir); err != nil {
+				return err
+			}
+		}
+		lease, err := handlers.Release(opts)
+		if err != nil {
+			return err
+		}
+		return newPrinter().Print(lease, func(w io.Writer) error {
+			_, err := fmt.Fprintf(w, "Released lease of %s held by %s\n", opts.Name, lease.Owner)
+			return err
+		})
+	},
+}
+
+func init() {
+	claimCmd.Flags().String("owner", "", "lease owner (default $"+handlers.LeaseOwnerEnv+" or the current user)")
+	claimCmd.Flags().Int("pid", 0, "PID of the process holding the lease (default the parent process)")
+	claimCmd.Flags().String("ttl", "2h", "how long the lease is valid, e.g. 30m, 8h or 1d; 0 never expires")
+	claimCmd.Flags().Bool("force", false, "take over a valid lease of another owner")
+	rootCmd.AddCommand(claimCmd)
+
+	releaseCmd.Flags().String("owner", "", "lease owner (default $"+handlers.LeaseOwnerEnv+" or the current user)")
+	releaseCmd.Flags().Bool("force", false, "release a valid lease of another owner")
+	rootCmd.AddCommand(releaseCmd)
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+)
+
+var collectCmd = &cobra.Command{
+	Use:   "collect [branch...]",
+	Short: "Export the work of replicas relative to base as patches or bundles",
+	Long: `Export the commits of the named replicas (or of every replica with --all) that are not in
+base into an output directory, as a patch series per replica (--as patch, one directory
+per replica for git am) or as a git bundle per replica (--as bundle, for git fetch).
+
+An index.json in the output directory lists the branch, commit count and diff stat of each
+replica, the number of uncommitted files left out, and with --test-cmd whether the command
+passed in the replica. The output directory defaults to
+<root>/.git-replicator/collect/<repo>-<time> where <root> is the root holding the repository.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		all, err := flags.GetBool("all")
+		if err != nil {
+			return err
+		}
+		outDir, err := flags.GetString("out")
+		if err != nil {
+			return err
+		}
+		format, err := flags.GetString("as")
+		if err != nil {
+			return err
+		}
+		testCmd, err := flags.GetString("test-cmd")
+		if err != nil {
+			return err
+		}
+		if all && len(args) > 0 {
+			return fmt.Errorf("--all cannot be combined with branch names")
+		}
+		rootDir, repoDir, err := currentRepoDir()
+		if err != nil {
+			return err
+		}
+		if outDir == "" {
+			outDir = filepath.Join(rootDir, handlers.StateDirName, "collect", filepath.Base(repoDir)+"-"+time.Now().Format("20060102T150405"))
+		}
+		opts := handlers.CollectOptions{RepoDir: repoDir, Replicas: args, All: all, OutDir: outDir, Format: format, TestCommand: testCmd}
+		index, err := handlers.Collect(context.Background(), opts)
+		if err != nil {
+			return err
+		}
+		err = newPrinter().Print(index.Entries, func(w io.Writer) error {
+			return printCollectIndex(w, outDir, index)
+		})
+		if err != nil {
+			return err
+		}
+		failed := 0
+		for _, e := range index.Entries {
+			if e.Error != "" {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d replicas failed to export", failed, len(index.Entries))
+		}
+		return nil
+	},
+}
+
+func printCollectIndex(w io.Writer, outDir string, index handlers.CollectIndex) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "REPLICA\tBRANCH\tCOMMITS\tFILES\t+/-\tUNCOMMITTED\tTEST\tOUTPUT")
+	for _, e := range index.Entries {
+		if e.Error != "" {
+			fmt.Fprintf(tw, "%s\t\t\t\t\t\t\terror: %s\n", e.Name, e.Error)
+			continue
+		}
+		output, test := e.Output, e.TestStatus
+		if output == "" {
+			output = "-"
+		}
+		if test == "" {
+			test = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t+%d/-%d\t%d\t%s\t%s\n", e.Name, e.Branch, e.Commits, e.Files, e.Added, e.Deleted, e.Uncommitted, test, output)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\nCollected into %s\n", outDir)
+	return err
+}
+
+func init() {
+	collectCmd.Flags().Bool("all", false, "collect every replica of the current repository")
+	collectCmd.Flags().String("out", "", "output directory")
+	collectCmd.Flags().String("as", handlers.CollectFormatPatch, fmt.Sprintf("export format (%s)", strings.Join(handlers.CollectFormats, ", ")))
+	collectCmd.Flags().String("test-cmd", "", "command run with sh -c in each replica to record a test status")
+	rootCmd.AddCommand(collectCmd)
+}
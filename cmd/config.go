@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/terakoya76/git-replicator/internal/config"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Show, check or create the config file",
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the settings in effect, with the defaults applied",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return err
+		}
+		return newPrinter().Print(cfg, func(w io.Writer) error {
+			if used := viper.ConfigFileUsed(); used != "" {
+				fmt.Fprintf(w, "# %s\n", used)
+			}
+			return utils.Printer{Output: "yaml", W: w}.Print(cfg, nil)
+		})
+	},
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Report unknown keys and invalid values in the config file",
+	Long: `Report unknown keys and invalid values in the config file with their file, line and column.
+It exits with an error if any is found.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := configFilePath()
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("no config file at %s (create one with: git-replicator config init): %w", path, err)
+		}
+		problems, err := config.Check(path)
+		if err != nil {
+			return err
+		}
+		err = newPrinter().Print(problems, func(w io.Writer) error {
+			if len(problems) == 0 {
+				_, err := fmt.Fprintf(w, "%s: ok\n", path)
+				return err
+			}
+			for _, p := range problems {
+				fmt.Fprintln(w, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(problems) > 0 {
+			return fmt.Errorf("config file %s is invalid", path)
+		}
+		return nil
+	},
+}
+
+var configInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Write a config file with the defaults and commented examples",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		force, err := cmd.Flags().GetBool("force")
+		if err != nil {
+			return err
+		}
+		path, err := configFilePath()
+		if err != nil {
+			return err
+		}
+		if err := config.Init(path, force); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Wrote config file: %s\n", path)
+		return nil
+	},
+}
+
+// configFilePath returns the config file in use, the one named by --config, or the default $HOME/.git-replicator.yaml.
+func configFilePath() (string, error) {
+	if used := viper.ConfigFileUsed(); used != "" {
+		return used, nil
+	}
+	if cfgFile != "" {
+		return cfgFile, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".git-replicator.yaml"), nil
+}
+
+// repoSettings returns the settings in effect for the repository at repoDir under rootDir.
+func repoSettings(cfg *config.Config, rootDir, repoDir string) (config.RepoSettings, error) {
+	rel, err := filepath.Rel(rootDir, repoDir)
+	if err != nil {
+		return config.RepoSettings{}, fmt.Errorf("failed to resolve repository name: %w", err)
+	}
+	return cfg.ForRepo(filepath.ToSlash(rel)), nil
+}
+
+// newCloneFunc returns the clone function applying the clone and auth settings of a repository.
+func newCloneFunc(settings config.RepoSettings) handlers.CloneFunc {
+	return utils.NewCloneFunc(utils.CloneOptions{
+		Depth:             settings.Clone.Depth,
+		SingleBranch:      settings.Clone.SingleBranch,
+		RecurseSubmodules: settings.Clone.RecurseSubmodules,
+		Credentials:       credentials(settings),
+	})
+}
+
+// credentials returns the credentials of the auth settings of a repository.
+func credentials(settings config.RepoSettings) utils.Credentials {
+	return utils.Credentials{
+		Username: settings.Auth.Username,
+		Token:    settings.Auth.Token(),
+		SSHKey:   settings.Auth.SSHKey,
+	}
+}
+
+// credentialsFunc returns a function looking up the credentials of the repository holding a base or replica directory under roots.
+func credentialsFunc(cfg *config.Config, roots []string) func(dir string) (utils.Credentials, error) {
+	return func(dir string) (utils.Credentials, error) {
+		rootDir, err := utils.FindRoot(roots, dir)
+		if err != nil {
+			return utils.Credentials{}, err
+		}
+		settings, err := repoSettings(cfg, rootDir, filepath.Dir(dir))
+		if err != nil {
+			return utils.Credentials{}, err
+		}
+		return credentials(settings), nil
+	}
+}
+
+// newFetchFunc returns the fetch function applying the auth settings of the repository being fetched.
+func newFetchFunc(cfg *config.Config, roots []string) handlers.FetchFunc {
+	return utils.NewFetchFunc(credentialsFunc(cfg, roots))
+}
+
+// newPushFunc returns the push function applying the auth settings of the repository being pushed.
+func newPushFunc(cfg *config.Config, roots []string) handlers.PushFunc {
+	return utils.NewPushFunc(credentialsFunc(cfg, roots))
+}
+
+// remoteURLFunc returns a GetRemoteURLFunc building the URL of a repository from its directory with protocol.
+func remoteURLFunc(protocol string) handlers.GetRemoteURLFunc {
+	return func(repoDir, gitReplicatorRoot string) (string, error) {
+		url, err := utils.DefaultGetRemoteURL(repoDir, gitReplicatorRoot)
+		if err != nil {
+			return "", err
+		}
+		u, err := utils.ParseGitURL(url)
+		if err != nil {
+			return "", err
+		}
+		return config.RepoURL(protocol, u.Host, u.Owner, u.Repo), nil
+	}
+}
+
+func init() {
+	configInitCmd.Flags().BoolP("force", "f", false, "overwrite an existing config file")
+	configCmd.AddCommand(configShowCmd, configValidateCmd, configInitCmd)
+	rootCmd.AddCommand(configCmd)
+}
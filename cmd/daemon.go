@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/terakoya76/git-replicator/internal/config"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Keep the remote-tracking branches of every base fresh by fetching origin periodically",
+	Long: `Run in the foreground and fetch origin in the base of every repository under the roots
+every --interval. This keeps the remote-tracking branches (origin/*) of base current, which
+"fetch" copies into replicas and "prune" checks merged branches against. The branch checked
+out in base is left alone; run "update" to fast-forward it. New replicas are cloned from
+origin by "switch" and do not depend on the daemon.
+
+Repositories added while the daemon runs are picked up by the next sync. It stops on SIGINT
+or SIGTERM, which makes it suitable for a systemd user unit:
+
+  [Service]
+  ExecStart=%h/go/bin/git-replicator daemon --interval 15m
+
+After every sync the last sync times are written to
+.git-replicator/daemon-status.json under the primary root; see "daemon status".`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		intervalFlag, err := flags.GetString("interval")
+		if err != nil {
+			return err
+		}
+		timeoutFlag, err := flags.GetString("timeout")
+		if err != nil {
+			return err
+		}
+		jobs, err := flags.GetInt("jobs")
+		if err != nil {
+			return err
+		}
+		once, err := flags.GetBool("once")
+		if err != nil {
+			return err
+		}
+		opts := handlers.DaemonOptions{Jobs: jobs, Once: once}
+		if opts.Interval, err = utils.ParseDuration(intervalFlag); err != nil {
+			return err
+		}
+		if opts.Timeout, err = utils.ParseDuration(timeoutFlag); err != nil {
+			return err
+		}
+		if opts.Roots, err = gitReplicatorRoots(); err != nil {
+			return err
+		}
+		opts.GitReplicatorRoot = opts.Roots[0]
+		cfg, err := config.Load()
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		return handlers.RunDaemon(ctx, opts, newFetchFunc(cfg, opts.Roots))
+	},
+}
+
+var daemonStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the last sync times written by the daemon",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		roots, err := gitReplicatorRoots()
+		if err != nil {
+			return err
+		}
+		status, err := handlers.ReadDaemonStatus(roots[0])
+		if err != nil {
+			return err
+		}
+		return newPrinter().Print(status, func(w io.Writer) error {
+			return printDaemonStatus(w, roots, status)
+		})
+	},
+}
+
+func printDaemonStatus(w io.Writer, roots []string, status handlers.DaemonStatus) error {
+	fmt.Fprintf(w, "PID %d, started %s, last sync %s", status.PID, status.StartedAt.Format(time.RFC3339), status.LastRunAt.Format(time.RFC3339))
+	if !status.NextRunAt.IsZero() {
+		fmt.Fprintf(w, ", next sync %s", status.NextRunAt.Format(time.RFC3339))
+	}
+	fmt.Fprintln(w)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "REPOSITORY\tLAST SUCCESS\tRESULT")
+	for _, r := range status.Repos {
+		rel := relToRoot(roots, r.Dir)
+		lastSuccess := "never"
+		if !r.LastSuccessAt.IsZero() {
+			lastSuccess = r.LastSuccessAt.Format(time.RFC3339)
+		}
+		result := "ok"
+		if r.Error != "" {
+			result = "error: " + r.Error
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", rel, lastSuccess, result)
+	}
+	return tw.Flush()
+}
+
+func init() {
+	daemonCmd.Flags().String("interval", "15m", "time between two syncs")
+	daemonCmd.Flags().String("timeout", "5m", "time limit for each fetch")
+	daemonCmd.Flags().IntP("jobs", "j", runtime.NumCPU(), "number of fetches to run concurrently")
+	daemonCmd.Flags().Bool("once", false, "sync once and exit")
+	daemonCmd.AddCommand(daemonStatusCmd)
+	rootCmd.AddCommand(daemonCmd)
+}
@@ -3,39 +3,78 @@ package cmd
 import (
 	"context"
 	"fmt"
-	"os"
+	"io"
+	"path/filepath"
 
 	"github.com/spf13/cobra"
 	"github.com/terakoya76/git-replicator/internal/handlers"
 	"github.com/terakoya76/git-replicator/internal/utils"
 )
 
+type deleteResult struct {
+	Branch    string `json:"branch"`
+	Path      string `json:"path"`
+	Permanent bool   `json:"permanent"`
+}
+
 var deleteCmd = &cobra.Command{
 	Use:   "delete <branch>",
 	Short: "Delete a branch directory under the current repository",
-	Args:  cobra.ExactArgs(1),
+	Long: `Delete a branch directory under the current repository.
+
+The deletion is refused when the directory is leased by someone else (see claim) or has
+uncommitted changes, untracked files, stashes or commits that are not on any remote.
+Use --force to delete it anyway.
+The base directory holding the canonical clone is only deleted with --allow-base.
+
+The directory is moved to .trash under the root holding the repository and can be brought
+back with "git-replicator restore <branch>". Use --permanent to remove it right away.`,
+	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		branch := args[0]
-		cwd, err := os.Getwd()
+		force, err := cmd.Flags().GetBool("force")
 		if err != nil {
-			return fmt.Errorf("failed to get current directory: %w", err)
+			return err
 		}
-		rootDir, err := utils.GetGitReplicatorRoot()
+		allowBase, err := cmd.Flags().GetBool("allow-base")
 		if err != nil {
-			return fmt.Errorf("failed to get git-replicator root: %w", err)
+			return err
 		}
-		repoDir, err := utils.FindRepoDir(cwd, rootDir)
+		permanent, err := cmd.Flags().GetBool("permanent")
 		if err != nil {
 			return err
 		}
-		if err := handlers.DeleteBranchDir(context.Background(), repoDir, branch); err != nil {
+		rootDir, repoDir, err := currentRepoDir()
+		if err != nil {
 			return err
 		}
-		fmt.Printf("Deleted branch directory: %s\n", branch)
-		return nil
+		opts := handlers.DeleteOptions{
+			GitReplicatorRoot: rootDir,
+			RepoDir:           repoDir,
+			BranchName:        branch,
+			Force:             force,
+			Owner:             handlers.DefaultLeaseOwner(),
+			AllowBase:         allowBase,
+			Permanent:         permanent,
+		}
+		if err := handlers.DeleteBranchDir(context.Background(), opts); err != nil {
+			return err
+		}
+		result := deleteResult{Branch: branch, Path: filepath.Join(repoDir, utils.ReplicaDirName(branch)), Permanent: permanent}
+		return newPrinter().Print(result, func(w io.Writer) error {
+			if permanent {
+				_, err := fmt.Fprintf(w, "Deleted branch directory: %s\n", branch)
+				return err
+			}
+			_, err := fmt.Fprintf(w, "Moved branch directory to trash: %s (undo with: git-replicator restore %s)\n", branch, branch)
+			return err
+		})
 	},
 }
 
 func init() {
+	deleteCmd.Flags().BoolP("force", "f", false, "delete even if the directory is leased or uncommitted, stashed or unpushed work would be lost")
+	deleteCmd.Flags().Bool("allow-base", false, "allow deleting the base directory")
+	deleteCmd.Flags().Bool("permanent", false, "remove the directory instead of moving it to the trash")
 	rootCmd.AddCommand(deleteCmd)
 }
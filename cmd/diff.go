@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff <replica> [<other-replica>]",
+	Short: "Compare two replicas of the current repository",
+	Long: `Compare two replicas of the current repository, or a replica with base when only one is given.
+
+Shows the commits unique to each side and a per-file diff stat of the changes from the
+first replica to the second. --patch adds the full patch and --worktree compares the
+working trees, including uncommitted and untracked files, instead of the HEAD commits.
+No remotes are added and nothing is fetched between the replicas.`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		worktree, err := flags.GetBool("worktree")
+		if err != nil {
+			return err
+		}
+		patch, err := flags.GetBool("patch")
+		if err != nil {
+			return err
+		}
+		_, repoDir, err := currentRepoDir()
+		if err != nil {
+			return err
+		}
+		opts := handlers.DiffOptions{RepoDir: repoDir, From: utils.BaseDirName, To: args[0], WorkTree: worktree, Patch: patch}
+		if len(args) == 2 {
+			opts.From, opts.To = args[0], args[1]
+		}
+		result, err := handlers.Diff(context.Background(), opts)
+		if err != nil {
+			return err
+		}
+		return newPrinter().Print(result, func(w io.Writer) error {
+			return printDiff(w, result)
+		})
+	},
+}
+
+func printDiff(w io.Writer, result handlers.DiffResult) error {
+	for _, side := range []struct {
+		name    string
+		commits []handlers.DiffCommit
+	}{{result.From, result.OnlyFrom}, {result.To, result.OnlyTo}} {
+		fmt.Fprintf(w, "Commits only in %s: %d\n", side.name, len(side.commits))
+		for _, c := range side.commits {
+			fmt.Fprintf(w, "  %s %s\n", c.Hash[:min(len(c.Hash), 7)], c.Subject)
+		}
+	}
+
+	fmt.Fprintf(w, "\nChanges from %s to %s: %d files\n", result.From, result.To, len(result.Files))
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+	added, deleted := 0, 0
+	for _, f := range result.Files {
+		if f.Binary {
+			fmt.Fprintf(tw, "  %s\t| binary\n", f.Path)
+			continue
+		}
+		fmt.Fprintf(tw, "  %s\t| +%d -%d\n", f.Path, f.Added, f.Deleted)
+		added += f.Added
+		deleted += f.Deleted
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if len(result.Files) > 0 {
+		fmt.Fprintf(w, "  %d insertions(+), %d deletions(-)\n", added, deleted)
+	}
+	if result.Patch != "" {
+		fmt.Fprintf(w, "\n%s", result.Patch)
+	}
+	return nil
+}
+
+func init() {
+	diffCmd.Flags().Bool("worktree", false, "compare the working trees instead of the HEAD commits")
+	diffCmd.Flags().BoolP("patch", "p", false, "show the full patch")
+	rootCmd.AddCommand(diffCmd)
+}
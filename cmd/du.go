@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+var duCmd = &cobra.Command{
+	Use:   "du",
+	Short: "Show the disk usage of each repository and replica",
+	Long: `Show the disk usage of the current repository (or of every repository with --all-repos),
+split between the .git directory and the worktree of base and each replica.
+
+Files hardlinked between checkouts, as created by local clones, are counted once in the
+first checkout (base comes first) and shown as SHARED elsewhere. Objects borrowed through
+git alternates are counted in the repository that owns them.
+
+The largest replicas without uncommitted, stashed or unpushed work are listed as reclaimable.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		allRepos, err := flags.GetBool("all-repos")
+		if err != nil {
+			return err
+		}
+		top, err := flags.GetInt("top")
+		if err != nil {
+			return err
+		}
+		roots, repoDirs, err := targetRepoDirs(allRepos)
+		if err != nil {
+			return err
+		}
+		report, err := handlers.ReportDiskUsage(context.Background(), handlers.DiskUsageOptions{RepoDirs: repoDirs, Top: top, Owner: handlers.DefaultLeaseOwner()})
+		if err != nil {
+			return err
+		}
+		return newPrinter().Print(report, func(w io.Writer) error {
+			return printDiskUsage(w, roots, report)
+		})
+	},
+}
+
+func printDiskUsage(w io.Writer, roots []string, report handlers.DiskUsageReport) error {
+	rel := func(dir string) string {
+		return relToRoot(roots, dir)
+	}
+	row := func(w io.Writer, name string, u utils.DiskUsage) {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", name, utils.FormatSize(u.Git), utils.FormatSize(u.Worktree), utils.FormatSize(u.Shared), utils.FormatSize(u.Total()))
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "REPOSITORY\tGIT\tWORKTREE\tSHARED\tTOTAL")
+	for _, repo := range report.Repos {
+		row(tw, rel(repo.Dir), repo.DiskUsage)
+		for _, r := range repo.Replicas {
+			row(tw, "  "+r.Branch, r.DiskUsage)
+		}
+	}
+	row(tw, "TOTAL", report.Total)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(report.Reclaimable) == 0 {
+		return nil
+	}
+	fmt.Fprintln(w, "\nLargest reclaimable replicas:")
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, r := range report.Reclaimable {
+		fmt.Fprintf(tw, "  %s\t%s\n", rel(r.Dir), utils.FormatSize(r.Total()))
+	}
+	return tw.Flush()
+}
+
+func init() {
+	duCmd.Flags().Bool("all-repos", false, "show every repository under the root")
+	duCmd.Flags().Int("top", 5, "number of reclaimable replicas to list")
+	rootCmd.AddCommand(duCmd)
+}
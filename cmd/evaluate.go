@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+)
+
+var evaluateCmd = &cobra.Command{
+	Use:   "evaluate [--replicas glob] -- <command> [args...]",
+	Short: "Run a check in every replica and rank the replicas by its outcome",
+	Long: `Run a check such as tests, a linter or a benchmark in every replica of the current repository
+(or those whose directory name matches --replicas) and rank them: replicas whose command
+exits with 0 come first, ordered by score, then by duration.
+
+The score is the number on the last line of the output, or the first group of the last match
+of --score, e.g. --score 'coverage: ([0-9.]+)%'. Higher scores rank first unless
+--lower-is-better is given. Commands run one at a time by default, so that benchmarks do not
+compete; raise --jobs for checks that can run in parallel.
+
+--pick-best fetches the branch of the best replica into base and checks it out there. Switch
+base back to the default branch before running update again, or add --fetch-only to only
+create the branch in base and keep base on its default branch.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		pattern, err := flags.GetString("replicas")
+		if err != nil {
+			return err
+		}
+		jobs, err := flags.GetInt("jobs")
+		if err != nil {
+			return err
+		}
+		logDir, err := flags.GetString("log-dir")
+		if err != nil {
+			return err
+		}
+		scoreFlag, err := flags.GetString("score")
+		if err != nil {
+			return err
+		}
+		lowerIsBetter, err := flags.GetBool("lower-is-better")
+		if err != nil {
+			return err
+		}
+		pickBest, err := flags.GetBool("pick-best")
+		if err != nil {
+			return err
+		}
+		fetchOnly, err := flags.GetBool("fetch-only")
+		if err != nil {
+			return err
+		}
+		if fetchOnly && !pickBest {
+			return fmt.Errorf("--fetch-only requires --pick-best")
+		}
+		var score *regexp.Regexp
+		if scoreFlag != "" {
+			if score, err = regexp.Compile(scoreFlag); err != nil {
+				return fmt.Errorf("invalid score pattern: %w", err)
+			}
+		}
+		rootDir, repoDir, err := currentRepoDir()
+		if err != nil {
+			return err
+		}
+		if logDir == "" {
+			if logDir, err = newLogDir(rootDir, repoDir, "evaluate"); err != nil {
+				return err
+			}
+		}
+
+		printer := newPrinter()
+		// Keep stdout for the results when they are machine-readable
+		var output io.Writer = os.Stdout
+		if printer.Structured() {
+			output = os.Stderr
+		}
+		opts := handlers.EvaluateOptions{
+			ExecOptions: handlers.ExecOptions{
+				RepoDir: repoDir,
+				Pattern: pattern,
+				Command: args,
+				Jobs:    jobs,
+				LogDir:  logDir,
+				Output:  output,
+				Owner:   handlers.DefaultLeaseOwner(),
+			},
+			ScorePattern:  score,
+			LowerIsBetter: lowerIsBetter,
+		}
+		ctx := context.Background()
+		evaluations, err := handlers.Evaluate(ctx, opts)
+		if err != nil {
+			return err
+		}
+		err = printer.Print(evaluations, func(w io.Writer) error {
+			return printEvaluations(w, evaluations)
+		})
+		if err != nil {
+			return err
+		}
+
+		if !pickBest {
+			return nil
+		}
+		if len(evaluations) == 0 || !evaluations[0].Passed {
+			return fmt.Errorf("no replica passed, so there is no best replica to pick")
+		}
+		if fetchOnly {
+			branch, err := handlers.FetchIntoBase(ctx, repoDir, evaluations[0].Name)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Fetched %s of %s into base\n", branch, evaluations[0].Name)
+			return nil
+		}
+		branch, err := handlers.CheckoutInBase(ctx, repoDir, evaluations[0].Name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Checked out %s of %s in base\n", branch, evaluations[0].Name)
+		return nil
+	},
+}
+
+func printEvaluations(w io.Writer, evaluations []handlers.Evaluation) error {
+	if len(evaluations) == 0 {
+		_, err := fmt.Fprintln(w, "No replicas matched")
+		return err
+	}
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RANK\tREPLICA\tEXIT\tSCORE\tTIME\tLOG")
+	for _, e := range evaluations {
+		exit := fmt.Sprint(e.ExitCode)
+		if e.ExitCode < 0 {
+			exit = "error: " + strings.TrimSpace(e.Error)
+		}
+		score := "-"
+		if e.Score != nil {
+			score = strconv.FormatFloat(*e.Score, 'g', -1, 64)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", e.Rank, e.Name, exit, score, e.Duration.Round(time.Millisecond), e.LogFile)
+	}
+	return tw.Flush()
+}
+
+func init() {
+	evaluateCmd.Flags().String("replicas", "", "only evaluate replicas whose directory name matches this glob pattern")
+	evaluateCmd.Flags().IntP("jobs", "j", 1, "number of commands to run concurrently")
+	evaluateCmd.Flags().String("log-dir", "", "directory to save the output of each replica to")
+	evaluateCmd.Flags().String("score", "", "regular expression extracting the score from the output")
+	evaluateCmd.Flags().Bool("lower-is-better", false, "rank lower scores first")
+	evaluateCmd.Flags().Bool("pick-best", false, "check out the branch of the best replica in base")
+	evaluateCmd.Flags().Bool("fetch-only", false, "with --pick-best, only fetch the branch into base without checking it out")
+	evaluateCmd.Flags().SetInterspersed(false)
+	rootCmd.AddCommand(evaluateCmd)
+}
@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+)
+
+var execCmd = &cobra.Command{
+	Use:   "exec [--replicas glob] -- <command> [args...]",
+	Short: "Run a command in every replica of the current repository in parallel",
+	Long: `Run a command in every replica of the current repository (or those whose directory name
+matches --replicas), with at most --jobs commands running at a time. The replica name is
+available to the command as $GIT_REPLICATOR_REPLICA.
+
+Output lines are prefixed with the replica name, or with --group printed per replica once
+its command finishes. The output of each replica is also saved under --log-dir, by default
+<root>/.git-replicator/logs/<host>/<owner>/<repo>/exec-<time>-<suffix>/<replica>.log where
+<root> is the root holding the repository. A summary of exit codes is printed at the end.
+
+Replicas leased by someone else (see claim) are skipped unless --ignore-leases is given.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		pattern, err := flags.GetString("replicas")
+		if err != nil {
+			return err
+		}
+		includeBase, err := flags.GetBool("include-base")
+		if err != nil {
+			return err
+		}
+		jobs, err := flags.GetInt("jobs")
+		if err != nil {
+			return err
+		}
+		logDir, err := flags.GetString("log-dir")
+		if err != nil {
+			return err
+		}
+		group, err := flags.GetBool("group")
+		if err != nil {
+			return err
+		}
+		ignoreLeases, err := flags.GetBool("ignore-leases")
+		if err != nil {
+			return err
+		}
+		rootDir, repoDir, err := currentRepoDir()
+		if err != nil {
+			return err
+		}
+		if logDir == "" {
+			if logDir, err = newLogDir(rootDir, repoDir, "exec"); err != nil {
+				return err
+			}
+		}
+
+		printer := newPrinter()
+		// Keep stdout for the results when they are machine-readable
+		var output io.Writer = os.Stdout
+		if printer.Structured() {
+			output = os.Stderr
+		}
+		opts := handlers.ExecOptions{
+			RepoDir:      repoDir,
+			Pattern:      pattern,
+			IncludeBase:  includeBase,
+			Command:      args,
+			Jobs:         jobs,
+			LogDir:       logDir,
+			Output:       output,
+			Group:        group,
+			Owner:        handlers.DefaultLeaseOwner(),
+			IgnoreLeases: ignoreLeases,
+		}
+		results, err := handlers.Exec(context.Background(), opts)
+		if err != nil {
+			return err
+		}
+		err = printer.Print(results, func(w io.Writer) error {
+			return printExecResults(w, results)
+		})
+		if err != nil {
+			return err
+		}
+		failed := 0
+		for _, r := range results {
+			if r.ExitCode != 0 {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d commands failed", failed, len(results))
+		}
+		return nil
+	},
+}
+
+// newLogDir creates a directory for the logs of a kind of run, e.g. "exec", in repoDir under the state directory of rootDir.
+// The random suffix keeps runs started in the same second apart.
+func newLogDir(rootDir, repoDir, kind string) (string, error) {
+	rel, err := filepath.Rel(rootDir, repoDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve repository name: %w", err)
+	}
+	parent := filepath.Join(rootDir, handlers.StateDirName, "logs", rel)
+	if err := os.MkdirAll(parent, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create log directory: %w", err)
+	}
+	dir, err := os.MkdirTemp(parent, kind+"-"+time.Now().Format("20060102T150405")+"-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create log directory: %w", err)
+	}
+	return dir, nil
+}
+
+func printExecResults(w io.Writer, results []handlers.ExecResult) error {
+	if len(results) == 0 {
+		_, err := fmt.Fprintln(w, "No replicas matched")
+		return err
+	}
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "REPLICA\tEXIT\tTIME\tLOG")
+	for _, r := range results {
+		exit := fmt.Sprint(r.ExitCode)
+		if r.ExitCode < 0 {
+			exit = "error: " + strings.TrimSpace(r.Error)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Name, exit, r.Duration.Round(time.Millisecond), r.LogFile)
+	}
+	return tw.Flush()
+}
+
+func init() {
+	execCmd.Flags().String("replicas", "", "only run in replicas whose directory name matches this glob pattern")
+	execCmd.Flags().Bool("include-base", false, "also run in base")
+	execCmd.Flags().IntP("jobs", "j", runtime.NumCPU(), "number of commands to run concurrently")
+	execCmd.Flags().String("log-dir", "", "directory to save the output of each replica to")
+	execCmd.Flags().Bool("group", false, "print the output of each replica at once when its command finishes")
+	execCmd.Flags().Bool("ignore-leases", false, "also run in replicas leased by someone else")
+	// Leave the flags of the command to the command
+	execCmd.Flags().SetInterspersed(false)
+	rootCmd.AddCommand(execCmd)
+}
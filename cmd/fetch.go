@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/terakoya76/git-replicator/internal/config"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+var fetchCmd = &cobra.Command{
+	Use:   "fetch",
+	Short: "Fetch origin in base and every replica concurrently",
+	Long: `Fetch origin in base and every replica of the current repository (or of every repository
+with --all-repos), pruning remote-tracking branches deleted on the remote.
+
+Base is fetched first. Replicas then fetch the remote-tracking branches of base from the
+local checkout instead of downloading the same objects again, unless base is a single
+branch clone.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		allRepos, err := flags.GetBool("all-repos")
+		if err != nil {
+			return err
+		}
+		baseOnly, err := flags.GetBool("base-only")
+		if err != nil {
+			return err
+		}
+		jobs, err := flags.GetInt("jobs")
+		if err != nil {
+			return err
+		}
+		timeoutFlag, err := flags.GetString("timeout")
+		if err != nil {
+			return err
+		}
+		timeout, err := utils.ParseDuration(timeoutFlag)
+		if err != nil {
+			return err
+		}
+		roots, repoDirs, err := targetRepoDirs(allRepos)
+		if err != nil {
+			return err
+		}
+		cfg, err := config.Load()
+		if err != nil {
+			return err
+		}
+
+		opts := handlers.FetchOptions{RepoDirs: repoDirs, BaseOnly: baseOnly, Jobs: jobs, Timeout: timeout}
+		results, err := handlers.FetchAll(context.Background(), opts, newFetchFunc(cfg, roots))
+		if err != nil {
+			return err
+		}
+		err = newPrinter().Print(results, func(w io.Writer) error {
+			return printFetchResults(w, roots, results)
+		})
+		if err != nil {
+			return err
+		}
+		failed := 0
+		for _, r := range results {
+			if r.Error != "" {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d fetches failed", failed, len(results))
+		}
+		return nil
+	},
+}
+
+func printFetchResults(w io.Writer, roots []string, results []handlers.FetchResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DIR\tSOURCE\tTIME\tRESULT")
+	for _, r := range results {
+		rel := relToRoot(roots, r.Dir)
+		result := "ok"
+		if r.Error != "" {
+			result = "error: " + r.Error
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", rel, r.Source, r.Duration.Round(time.Millisecond), result)
+	}
+	return tw.Flush()
+}
+
+func init() {
+	fetchCmd.Flags().Bool("all-repos", false, "fetch every repository under the root")
+	fetchCmd.Flags().Bool("base-only", false, "fetch only the base directory of each repository")
+	fetchCmd.Flags().IntP("jobs", "j", runtime.NumCPU(), "number of fetches to run concurrently")
+	fetchCmd.Flags().String("timeout", "5m", "time limit for each fetch")
+	rootCmd.AddCommand(fetchCmd)
+}
@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Delete stale replicas by age, count per repository or total disk budget",
+	Long: `Delete stale replicas of the current repository (or of every repository with --all-repos).
+
+Replicas are selected by one or more policies, based on the last commit time and
+the last modification time of the files in each replica:
+
+  --max-age 14d      replicas untouched for longer than 14 days
+  --keep 5           all but the 5 most recently active replicas per repository
+  --disk-budget 50G  the least recently active replicas until the total fits
+
+Replicas with uncommitted, stashed or unpushed work or leased by another owner are
+reported as blocked and kept unless --force is given. Replicas whose usage cannot be read
+are reported with the error and kept. Deleted replicas are moved to the trash; use --permanent to
+reclaim the disk space immediately. With --disk-budget they are always removed permanently,
+since the trash would keep using the space.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := context.Background()
+		flags := cmd.Flags()
+		maxAgeFlag, err := flags.GetString("max-age")
+		if err != nil {
+			return err
+		}
+		keep, err := flags.GetInt("keep")
+		if err != nil {
+			return err
+		}
+		budgetFlag, err := flags.GetString("disk-budget")
+		if err != nil {
+			return err
+		}
+		allRepos, err := flags.GetBool("all-repos")
+		if err != nil {
+			return err
+		}
+		dryRun, err := flags.GetBool("dry-run")
+		if err != nil {
+			return err
+		}
+		yes, err := flags.GetBool("yes")
+		if err != nil {
+			return err
+		}
+		force, err := flags.GetBool("force")
+		if err != nil {
+			return err
+		}
+		permanent, err := flags.GetBool("permanent")
+		if err != nil {
+			return err
+		}
+
+		opts := handlers.GCOptions{Keep: keep, Force: force, Owner: handlers.DefaultLeaseOwner(), Now: time.Now()}
+		if maxAgeFlag != "" {
+			if opts.MaxAge, err = utils.ParseDuration(maxAgeFlag); err != nil {
+				return err
+			}
+		}
+		if budgetFlag != "" {
+			if opts.DiskBudget, err = utils.ParseSize(budgetFlag); err != nil {
+				return err
+			}
+		}
+		roots, repoDirs, err := targetRepoDirs(allRepos)
+		if err != nil {
+			return err
+		}
+		opts.RepoDirs = repoDirs
+
+		candidates, err := handlers.PlanGC(ctx, opts)
+		if err != nil {
+			return err
+		}
+		deletable := 0
+		for _, c := range candidates {
+			if c.Deletable() {
+				deletable++
+			}
+		}
+		printer := newPrinter()
+		if dryRun || deletable == 0 {
+			return printer.Print(candidates, func(w io.Writer) error {
+				return printGCCandidates(w, roots, candidates)
+			})
+		}
+		// Show what is about to be deleted while keeping stdout for the structured result
+		listOut := io.Writer(os.Stdout)
+		if printer.Structured() {
+			listOut = os.Stderr
+		}
+		if err := printGCCandidates(listOut, roots, candidates); err != nil {
+			return err
+		}
+		if !yes {
+			ok, err := confirm(fmt.Sprintf("Delete %d replicas?", deletable))
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return nil
+			}
+		}
+
+		results := make([]gcResult, 0, len(candidates))
+		failed := 0
+		for _, c := range candidates {
+			result := gcResult{GCCandidate: c}
+			if c.Deletable() {
+				// Deleted replicas go to the trash of the root holding their repository
+				rootDir, err := utils.FindRoot(roots, c.RepoDir)
+				if err == nil {
+					opts := handlers.DeleteOptions{
+						GitReplicatorRoot: rootDir,
+						RepoDir:           c.RepoDir,
+						BranchName:        c.Branch,
+						Force:             force,
+						Owner:             opts.Owner,
+						Permanent:         permanent || opts.DiskBudget > 0,
+					}
+					err = handlers.DeleteBranchDir(ctx, opts)
+				}
+				if err != nil {
+					failed++
+					result.Error = err.Error()
+				} else {
+					result.Deleted = true
+				}
+			}
+			results = append(results, result)
+		}
+		err = printer.Print(results, func(w io.Writer) error {
+			for _, r := range results {
+				switch {
+				case r.Deleted:
+					fmt.Fprintf(w, "Deleted replica: %s\n", r.Dir)
+				case r.Error != "":
+					fmt.Fprintf(os.Stderr, "skipped %s: %s\n", r.Dir, r.Error)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d replicas were not deleted", failed, deletable)
+		}
+		return nil
+	},
+}
+
+type gcResult struct {
+	handlers.GCCandidate
+	DeleteOutcome
+}
+
+func printGCCandidates(w io.Writer, roots []string, candidates []handlers.GCCandidate) error {
+	if len(candidates) == 0 {
+		_, err := fmt.Fprintln(w, "No replicas to collect")
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "REPLICA\tLAST ACTIVITY\tSIZE\tREASON\tBLOCKED")
+	for _, c := range candidates {
+		blocked := c.Blocked
+		if c.UsageError != "" {
+			blocked = "error: " + c.UsageError
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", relToRoot(roots, c.Dir), c.LastActivity().Format(time.RFC3339), utils.FormatSize(c.Size), c.Reason, blocked)
+	}
+	return tw.Flush()
+}
+
+func init() {
+	gcCmd.Flags().String("max-age", "", "collect replicas untouched for longer than this (e.g. 14d)")
+	gcCmd.Flags().Int("keep", 0, "keep at most this many replicas per repository")
+	gcCmd.Flags().String("disk-budget", "", "collect the oldest replicas until the total size fits (e.g. 50G)")
+	gcCmd.Flags().Bool("all-repos", false, "collect replicas of every repository under the root")
+	gcCmd.Flags().BoolP("dry-run", "n", false, "only show what would be deleted and why")
+	gcCmd.Flags().BoolP("yes", "y", false, "do not ask for confirmation")
+	gcCmd.Flags().BoolP("force", "f", false, "delete even if uncommitted, stashed or unpushed work would be lost")
+	gcCmd.Flags().Bool("permanent", false, "remove replicas instead of moving them to the trash")
+	rootCmd.AddCommand(gcCmd)
+}
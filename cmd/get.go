@@ -3,30 +3,80 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 
 	"github.com/spf13/cobra"
+	"github.com/terakoya76/git-replicator/internal/config"
 	"github.com/terakoya76/git-replicator/internal/handlers"
 	"github.com/terakoya76/git-replicator/internal/utils"
 )
 
 var getCmd = &cobra.Command{
-	Use:   "get <url>",
+	Use:   "get <url | owner/repo | host/owner/repo>",
 	Short: "Clone a git repository",
-	Args:  cobra.ExactArgs(1),
+	Long: `Clone a git repository into <root>/<host>/<owner>/<repo>/base, where root is the primary
+git-replicator root unless --root names another one of the configured roots.
+
+A repository given as owner/repo or host/owner/repo is cloned from default_host over
+default_protocol (https or ssh) as set in the config file. The post_get hook runs in base
+once the repository is cloned.`,
+	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		ctx := context.Background()
-		url := args[0]
-		rootDir, err := utils.GetGitReplicatorRoot()
+		printPath, err := cmd.Flags().GetBool("print-path")
+		if err != nil {
+			return err
+		}
+		rootFlag, err := cmd.Flags().GetString("root")
+		if err != nil {
+			return err
+		}
+		rootDir, err := targetRoot(rootFlag)
+		if err != nil {
+			return err
+		}
+		cfg, err := config.Load()
+		if err != nil {
+			return err
+		}
+		url, err := cfg.ExpandRepoURL(args[0])
 		if err != nil {
-			return fmt.Errorf("failed to get git-replicator root ($HOME/git-replicator): %w", err)
+			return err
 		}
-		if err := handlers.Get(ctx, url, rootDir); err != nil {
+		dir, err := handlers.BaseDir(url, rootDir)
+		if err != nil {
+			return err
+		}
+		settings, err := repoSettings(cfg, rootDir, filepath.Dir(dir))
+		if err != nil {
+			return err
+		}
+		_, statErr := os.Stat(dir)
+		if err := handlers.Get(ctx, url, rootDir, newCloneFunc(settings)); err != nil {
 			return fmt.Errorf("failed to clone repository: %w", err)
 		}
-		return nil
+		if os.IsNotExist(statErr) && settings.Hooks.PostGet != "" {
+			if err := handlers.RunHook(ctx, filepath.Dir(dir), utils.BaseDirName, settings.Hooks.PostGet, os.Stderr); err != nil {
+				return err
+			}
+		}
+		if printPath {
+			fmt.Println(dir)
+			return nil
+		}
+		u, err := utils.ParseGitURL(url)
+		if err != nil {
+			return err
+		}
+		result := handlers.RepoInfo{Host: u.Host, Owner: u.Owner, Repo: u.Repo, Path: dir}
+		return newPrinter().Print(result, func(w io.Writer) error { return nil })
 	},
 }
 
 func init() {
+	getCmd.Flags().String("root", "", "git-replicator root to clone into, by path or directory name (default is the primary root)")
+	getCmd.Flags().Bool("print-path", false, "print only the base directory path (used by shell-init)")
 	rootCmd.AddCommand(getCmd)
 }
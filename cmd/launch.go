@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/terakoya76/git-replicator/internal/config"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+var launchCmd = &cobra.Command{
+	Use:   "launch [branch...]",
+	Short: "Run the agent command in a tmux window for each replica",
+	Long: `Open a window in the tmux session of the current repository (named <owner>/<repo>) for each
+named replica, or for every replica with --all, with its working directory set to the replica,
+and type the agent command into its shell. Without arguments the replica containing the
+current directory is launched. Replicas that already have a window are left alone.
+
+The agent is started with --profile, the default profile agent.profile, --command or
+agent.command, in this order (see open for profiles). The name of the replica is exported
+to the window as GIT_REPLICATOR_REPLICA. Use attach to watch an
+agent and stop to close its window.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		all, err := cmd.Flags().GetBool("all")
+		if err != nil {
+			return err
+		}
+		profileName, err := cmd.Flags().GetString("profile")
+		if err != nil {
+			return err
+		}
+		if profileName != "" && cmd.Flags().Changed("command") {
+			return fmt.Errorf("--profile cannot be combined with --command")
+		}
+		cfg, err := config.Load()
+		if err != nil {
+			return err
+		}
+		// Without any profile, --command or agent.command is typed as is, or only the shell is started
+		profile := config.Profile{Command: cfg.Agent.Command}
+		if profileName != "" || (cfg.Agent.Profile != "" && !cmd.Flags().Changed("command")) {
+			if profile, err = cfg.Profile(profileName); err != nil {
+				return err
+			}
+		}
+		if all && len(args) > 0 {
+			return fmt.Errorf("--all cannot be combined with branch names")
+		}
+		_, repoDir, err := currentRepoDir()
+		if err != nil {
+			return err
+		}
+		opts := handlers.LaunchOptions{RepoDir: repoDir, Replicas: args, All: all, Profile: profile}
+		if !all && len(args) == 0 {
+			cwd, err := os.Getwd()
+			if err != nil {
+				return fmt.Errorf("failed to get current directory: %w", err)
+			}
+			name, err := utils.FindReplicaName(cwd, repoDir)
+			if err != nil {
+				return err
+			}
+			opts.Replicas = []string{name}
+		}
+
+		results, err := handlers.Launch(context.Background(), opts, utils.DefaultTmuxFunc)
+		if err != nil {
+			return err
+		}
+		return newPrinter().Print(results, func(w io.Writer) error {
+			tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "REPLICA\tWINDOW\tSTATUS")
+			for _, r := range results {
+				fmt.Fprintf(tw, "%s\t%s:%s\t%s\n", r.Name, r.Session, r.Name, r.Status)
+			}
+			return tw.Flush()
+		})
+	},
+}
+
+func init() {
+	launchCmd.Flags().Bool("all", false, "launch the agent in every replica of the current repository")
+	launchCmd.Flags().String("profile", "", "profile from the config file to start the agent with")
+	launchCmd.Flags().String("command", "", "agent command to run in each window (config: agent.command)")
+	rootCmd.AddCommand(launchCmd)
+	if err := viper.BindPFlag("agent.command", launchCmd.Flags().Lookup("command")); err != nil {
+		slog.Error("failed to bind command flag", "err", err)
+	}
+}
@@ -3,31 +3,85 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"io"
+	"path"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/terakoya76/git-replicator/internal/handlers"
-	"github.com/terakoya76/git-replicator/internal/utils"
 )
 
 var listCmd = &cobra.Command{
 	Use:   "list",
-	Short: "List repositories under $HOME/git-replicator",
+	Short: "List repositories under every git-replicator root",
+	Long: `List repositories under every git-replicator root ($HOME/git-replicator unless the root
+and roots config keys or $GIT_REPLICATOR_ROOT say otherwise).
+
+--host, --owner and --repo take glob patterns such as 'github.com', 'terakoya76'
+or 'git-*'. --sort activity lists the most recently active repositories first and
+--sort size the largest first; both cover base and every replica.`,
+	Args: cobra.NoArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		rootDir, err := utils.GetGitReplicatorRoot()
+		flags := cmd.Flags()
+		var opts handlers.ListOptions
+		var err error
+		if opts.Host, err = flags.GetString("host"); err != nil {
+			return err
+		}
+		if opts.Owner, err = flags.GetString("owner"); err != nil {
+			return err
+		}
+		if opts.Repo, err = flags.GetString("repo"); err != nil {
+			return err
+		}
+		if opts.SortBy, err = flags.GetString("sort"); err != nil {
+			return err
+		}
+		if opts.WithReplicas, err = flags.GetBool("with-replicas"); err != nil {
+			return err
+		}
+		paths, err := flags.GetBool("paths")
 		if err != nil {
-			return fmt.Errorf("failed to get git-replicator root: %w", err)
+			return err
 		}
-		repos, err := handlers.List(context.Background(), rootDir)
+
+		roots, err := gitReplicatorRoots()
 		if err != nil {
-			return fmt.Errorf("failed to list repositories: %w", err)
+			return err
 		}
-		for _, repo := range repos {
-			fmt.Printf("%s/%s/%s\n", repo.Host, repo.Owner, repo.Repo)
+		repos, err := handlers.ListRepos(context.Background(), roots, opts)
+		if err != nil {
+			return fmt.Errorf("failed to list repositories: %w", err)
 		}
-		return nil
+		return newPrinter().Print(repos, func(w io.Writer) error {
+			for _, repo := range repos {
+				name := path.Join(repo.Host, repo.Owner, repo.Repo)
+				if paths {
+					name = repo.Dir
+				}
+				fmt.Fprintln(w, name)
+				if repo.Error != "" {
+					fmt.Fprintf(w, "  error: %s\n", repo.Error)
+				}
+				for _, replica := range repo.Replicas {
+					if paths {
+						fmt.Fprintf(w, "  %s\n", replica.Dir)
+					} else {
+						fmt.Fprintf(w, "  %s\n", replica.Branch)
+					}
+				}
+			}
+			return nil
+		})
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(listCmd)
+	listCmd.Flags().String("host", "", "only list repositories whose host matches this glob pattern")
+	listCmd.Flags().String("owner", "", "only list repositories whose owner matches this glob pattern")
+	listCmd.Flags().String("repo", "", "only list repositories whose name matches this glob pattern")
+	listCmd.Flags().String("sort", handlers.ListSortName, fmt.Sprintf("sort order (%s)", strings.Join(handlers.ListSorts, ", ")))
+	listCmd.Flags().Bool("with-replicas", false, "list the replicas of each repository")
+	listCmd.Flags().Bool("paths", false, "print full paths instead of host/owner/repo")
 }
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+var metaCmd = &cobra.Command{
+	Use:   "meta [branch]",
+	Short: "Show or change the metadata of a branch directory",
+	Long: `Show the metadata of the named branch directory, or of the one containing the current
+directory: when and by whom it was created, the ref it was created from, its task, labels
+and status. --task, --status, --label and --unlabel change it.
+
+switch records the metadata of new branch directories, push marks them as pushed and
+delete as deleted. It is stored in <branch>/.git/git-replicator/metadata.json.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		var update handlers.MetadataUpdate
+		if flags.Changed("task") {
+			task, err := flags.GetString("task")
+			if err != nil {
+				return err
+			}
+			update.Task = &task
+		}
+		if flags.Changed("status") {
+			status, err := flags.GetString("status")
+			if err != nil {
+				return err
+			}
+			update.Status = &status
+		}
+		var err error
+		if update.AddLabels, err = flags.GetStringArray("label"); err != nil {
+			return err
+		}
+		if update.RemoveLabels, err = flags.GetStringArray("unlabel"); err != nil {
+			return err
+		}
+
+		_, repoDir, err := currentRepoDir()
+		if err != nil {
+			return err
+		}
+		var name string
+		if len(args) == 1 {
+			name = args[0]
+		} else {
+			cwd, err := os.Getwd()
+			if err != nil {
+				return fmt.Errorf("failed to get current directory: %w", err)
+			}
+			if name, err = utils.FindReplicaName(cwd, repoDir); err != nil {
+				return err
+			}
+		}
+
+		var meta handlers.ReplicaMetadata
+		if flags.Changed("task") || flags.Changed("status") || flags.Changed("label") || flags.Changed("unlabel") {
+			meta, err = handlers.SetMetadata(repoDir, name, update, time.Now())
+		} else {
+			meta, err = handlers.GetMetadata(repoDir, name)
+		}
+		if err != nil {
+			return err
+		}
+		return newPrinter().Print(meta, func(w io.Writer) error {
+			return printMetadata(w, meta)
+		})
+	},
+}
+
+func printMetadata(w io.Writer, meta handlers.ReplicaMetadata) error {
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Local().Format(time.DateTime)
+	}
+	source := meta.SourceRef
+	if meta.SourceCommit != "" {
+		source += " (" + meta.SourceCommit[:min(len(meta.SourceCommit), 12)] + ")"
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Status:\t%s\n", meta.Status)
+	fmt.Fprintf(tw, "Task:\t%s\n", meta.Task)
+	fmt.Fprintf(tw, "Labels:\t%s\n", strings.Join(meta.Labels, ", "))
+	fmt.Fprintf(tw, "Created:\t%s %s\n", formatTime(meta.CreatedAt), meta.CreatedBy)
+	fmt.Fprintf(tw, "Source:\t%s\n", source)
+	fmt.Fprintf(tw, "Updated:\t%s\n", formatTime(meta.UpdatedAt))
+	return tw.Flush()
+}
+
+func init() {
+	metaCmd.Flags().String("task", "", "set the task description")
+	metaCmd.Flags().String("status", "", "set the status, e.g. active, review or done")
+	metaCmd.Flags().StringArray("label", nil, "add a label (repeatable)")
+	metaCmd.Flags().StringArray("unlabel", nil, "remove a label (repeatable)")
+	rootCmd.AddCommand(metaCmd)
+}
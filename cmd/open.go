@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/terakoya76/git-replicator/internal/config"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+var openCmd = &cobra.Command{
+	Use:   "open [branch]",
+	Short: "Open a replica with an agent or editor profile",
+	Long: `Run the command of a profile for the named replica, or for the one containing the current
+directory, in the foreground. Profiles are defined in the config file:
+
+  agent:
+    profile: claude      # used when --profile is not given
+  profiles:
+    claude:
+      command: claude
+      env: ["CLAUDE_CONFIG_DIR=/home/me/.claude-agents"]
+    cursor:
+      command: cursor {{quote .Dir}}
+      workdir: repo      # replica (default) or repo
+
+The command is a Go template run with sh -c. It can use {{.Name}}, {{.Dir}}, {{.RepoDir}},
+{{.Branch}} and {{.Task}}; wrap them in quote, as in {{quote .Task}}, to pass them as a
+single shell word. The same profiles are used by launch --profile.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		profileName, err := cmd.Flags().GetString("profile")
+		if err != nil {
+			return err
+		}
+		cfg, err := config.Load()
+		if err != nil {
+			return err
+		}
+		profile, err := cfg.Profile(profileName)
+		if err != nil {
+			return err
+		}
+		_, repoDir, err := currentRepoDir()
+		if err != nil {
+			return err
+		}
+		var name string
+		if len(args) == 1 {
+			name = args[0]
+		} else {
+			cwd, err := os.Getwd()
+			if err != nil {
+				return fmt.Errorf("failed to get current directory: %w", err)
+			}
+			if name, err = utils.FindReplicaName(cwd, repoDir); err != nil {
+				return err
+			}
+		}
+		opts := handlers.OpenOptions{RepoDir: repoDir, Name: name, Profile: profile, Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}
+		return handlers.Open(context.Background(), opts)
+	},
+}
+
+func init() {
+	openCmd.Flags().String("profile", "", "profile from the config file (default agent.profile)")
+	rootCmd.AddCommand(openCmd)
+}
@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/terakoya76/git-replicator/internal/config"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+)
+
+// DeleteOutcome reports whether a candidate selected by prune or gc was deleted.
+type DeleteOutcome struct {
+	Deleted bool   `json:"deleted"`
+	Error   string `json:"error,omitempty"`
+}
+
+type pruneResult struct {
+	handlers.PruneCandidate
+	DeleteOutcome
+}
+
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete replicas whose branch has been merged into base or deleted on the remote",
+	Long: `Delete replicas of the current repository whose branch has been merged into the
+base branch, or whose upstream branch has been deleted on the remote (detected with --fetch).
+
+The replicas are listed and deleted after confirmation. Replicas leased by another owner
+are reported as blocked and kept unless --force is given. Deletion goes through the same
+safety checks as delete and moves the replicas to the trash.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := context.Background()
+		flags := cmd.Flags()
+		fetch, err := flags.GetBool("fetch")
+		if err != nil {
+			return err
+		}
+		dryRun, err := flags.GetBool("dry-run")
+		if err != nil {
+			return err
+		}
+		yes, err := flags.GetBool("yes")
+		if err != nil {
+			return err
+		}
+		force, err := flags.GetBool("force")
+		if err != nil {
+			return err
+		}
+
+		rootDir, repoDir, err := currentRepoDir()
+		if err != nil {
+			return err
+		}
+		cfg, err := config.Load()
+		if err != nil {
+			return err
+		}
+		pruneOpts := handlers.PruneOptions{RepoDir: repoDir, Fetch: fetch, Owner: handlers.DefaultLeaseOwner(), Force: force}
+		candidates, err := handlers.FindPrunable(ctx, pruneOpts, newFetchFunc(cfg, []string{rootDir}))
+		if err != nil {
+			return err
+		}
+		deletable := 0
+		for _, c := range candidates {
+			if c.Blocked == "" {
+				deletable++
+			}
+		}
+		printer := newPrinter()
+		if dryRun || deletable == 0 {
+			return printer.Print(candidates, func(w io.Writer) error {
+				return printPruneCandidates(w, candidates)
+			})
+		}
+		// Show what is about to be deleted while keeping stdout for the structured result
+		listOut := io.Writer(os.Stdout)
+		if printer.Structured() {
+			listOut = os.Stderr
+		}
+		if err := printPruneCandidates(listOut, candidates); err != nil {
+			return err
+		}
+		if !yes {
+			ok, err := confirm(fmt.Sprintf("Delete %d replicas?", deletable))
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return nil
+			}
+		}
+
+		results := make([]pruneResult, 0, len(candidates))
+		failed := 0
+		for _, c := range candidates {
+			result := pruneResult{PruneCandidate: c}
+			if c.Blocked != "" {
+				results = append(results, result)
+				continue
+			}
+			opts := handlers.DeleteOptions{
+				GitReplicatorRoot: rootDir,
+				RepoDir:           repoDir,
+				BranchName:        c.Branch,
+				Force:             force,
+				Owner:             pruneOpts.Owner,
+			}
+			if err := handlers.DeleteBranchDir(ctx, opts); err != nil {
+				failed++
+				result.Error = err.Error()
+			} else {
+				result.Deleted = true
+			}
+			results = append(results, result)
+		}
+		err = printer.Print(results, func(w io.Writer) error {
+			for _, r := range results {
+				switch {
+				case r.Deleted:
+					fmt.Fprintf(w, "Moved branch directory to trash: %s\n", r.Branch)
+				case r.Error != "":
+					fmt.Fprintf(os.Stderr, "skipped %s: %s\n", r.Branch, r.Error)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d replicas were not deleted", failed, deletable)
+		}
+		return nil
+	},
+}
+
+func printPruneCandidates(w io.Writer, candidates []handlers.PruneCandidate) error {
+	if len(candidates) == 0 {
+		_, err := fmt.Fprintln(w, "No replicas to prune")
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "BRANCH\tREASON\tBLOCKED")
+	for _, c := range candidates {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", c.Branch, c.Reason, c.Blocked)
+	}
+	return tw.Flush()
+}
+
+func init() {
+	pruneCmd.Flags().Bool("fetch", false, "fetch origin first to detect branches deleted on the remote")
+	pruneCmd.Flags().BoolP("dry-run", "n", false, "only list the replicas that would be deleted")
+	pruneCmd.Flags().BoolP("yes", "y", false, "do not ask for confirmation")
+	pruneCmd.Flags().BoolP("force", "f", false, "delete even if uncommitted, stashed or unpushed work would be lost")
+	rootCmd.AddCommand(pruneCmd)
+}
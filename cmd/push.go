@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/terakoya76/git-replicator/internal/config"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+var pushCmd = &cobra.Command{
+	Use:   "push [branch...]",
+	Short: "Push the branches of replicas to origin and set their upstream",
+	Long: `Push the branch checked out in each named replica (or in every replica with --all) to the
+branch of the same name on origin, and set it as the upstream of the branch. Without
+arguments the replica containing the current directory is pushed.
+
+Pushes use the same transport and credentials as get and switch. --force-with-lease allows
+pushing rewritten history, e.g. after update --rebase, as long as the remote branch has not
+moved since it was last fetched.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		all, err := flags.GetBool("all")
+		if err != nil {
+			return err
+		}
+		forceWithLease, err := flags.GetBool("force-with-lease")
+		if err != nil {
+			return err
+		}
+		if all && len(args) > 0 {
+			return fmt.Errorf("--all cannot be combined with branch names")
+		}
+		rootDir, repoDir, err := currentRepoDir()
+		if err != nil {
+			return err
+		}
+		cfg, err := config.Load()
+		if err != nil {
+			return err
+		}
+		opts := handlers.PushOptions{RepoDir: repoDir, Replicas: args, All: all, ForceWithLease: forceWithLease}
+		if !all && len(args) == 0 {
+			cwd, err := os.Getwd()
+			if err != nil {
+				return fmt.Errorf("failed to get current directory: %w", err)
+			}
+			name, err := utils.FindReplicaName(cwd, repoDir)
+			if err != nil {
+				return err
+			}
+			opts.Replicas = []string{name}
+		}
+
+		results, err := handlers.Push(context.Background(), opts, newPushFunc(cfg, []string{rootDir}))
+		if err != nil {
+			return err
+		}
+		err = newPrinter().Print(results, func(w io.Writer) error {
+			return printPushResults(w, results)
+		})
+		if err != nil {
+			return err
+		}
+		failed := 0
+		for _, r := range results {
+			if r.Status == handlers.PushStatusFailed {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d pushes failed", failed, len(results))
+		}
+		return nil
+	},
+}
+
+func printPushResults(w io.Writer, results []handlers.PushResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DIR\tBRANCH\tSTATUS")
+	for _, r := range results {
+		status := r.Status
+		if r.Error != "" {
+			status += ": " + r.Error
+		}
+		if r.Warning != "" {
+			status += " (warning: " + r.Warning + ")"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Name, r.Branch, status)
+	}
+	return tw.Flush()
+}
+
+func init() {
+	pushCmd.Flags().Bool("all", false, "push every replica of the current repository")
+	pushCmd.Flags().Bool("force-with-lease", false, "allow non-fast-forward pushes unless the remote branch moved since the last fetch")
+	rootCmd.AddCommand(pushCmd)
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+)
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore <branch>",
+	Short: "Restore a deleted branch directory of the current repository from the trash",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rootDir, repoDir, err := currentRepoDir()
+		if err != nil {
+			return err
+		}
+		opts := handlers.RestoreOptions{
+			GitReplicatorRoot: rootDir,
+			RepoDir:           repoDir,
+			BranchName:        args[0],
+		}
+		entry, err := handlers.Restore(context.Background(), opts)
+		if err != nil {
+			return err
+		}
+		return newPrinter().Print(entry, func(w io.Writer) error {
+			_, err := fmt.Fprintf(w, "Restored branch directory: %s (deleted at %s)\n", entry.OriginalPath, entry.DeletedAt.Format(time.RFC3339))
+			return err
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+}
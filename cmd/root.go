@@ -1,12 +1,20 @@
 package cmd
 
 import (
+	"bufio"
+	"context"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.com/terakoya76/git-replicator/internal/config"
+	"github.com/terakoya76/git-replicator/internal/handlers"
 	"github.com/terakoya76/git-replicator/internal/utils"
 )
 
@@ -32,9 +40,149 @@ func init() {
 		slog.Error("failed to bind verbose flag", "err", err)
 		return
 	}
+	rootCmd.PersistentFlags().StringP("output", "o", "text", "output format: "+strings.Join(utils.OutputFormats, "|"))
+	err = viper.BindPFlag("output", rootCmd.PersistentFlags().Lookup("output"))
+	if err != nil {
+		slog.Error("failed to bind output flag", "err", err)
+		return
+	}
+	rootCmd.PersistentFlags().String("format", "", "Go template applied to each result (overrides --output)")
+	err = viper.BindPFlag("format", rootCmd.PersistentFlags().Lookup("format"))
+	if err != nil {
+		slog.Error("failed to bind format flag", "err", err)
+		return
+	}
 	utils.InitLogger()
 }
 
+// newPrinter returns a printer to stdout configured by the global --output and --format flags.
+func newPrinter() utils.Printer {
+	return utils.Printer{
+		Output: viper.GetString("output"),
+		Format: viper.GetString("format"),
+		W:      os.Stdout,
+	}
+}
+
+// gitReplicatorRoots returns the git-replicator roots from $GIT_REPLICATOR_ROOT or the root and roots config keys, the primary root first.
+func gitReplicatorRoots() ([]string, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+	roots, err := utils.GetGitReplicatorRoots(cfg.RootDirs()...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get git-replicator root: %w", err)
+	}
+	return roots, nil
+}
+
+// gitReplicatorRoot returns the primary git-replicator root, which new repositories are cloned into.
+func gitReplicatorRoot() (string, error) {
+	roots, err := gitReplicatorRoots()
+	if err != nil {
+		return "", err
+	}
+	return roots[0], nil
+}
+
+// targetRoot returns the git-replicator root named by path or directory name, or the primary root if name is empty.
+func targetRoot(name string) (string, error) {
+	roots, err := gitReplicatorRoots()
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		return roots[0], nil
+	}
+	for _, root := range roots {
+		if filepath.Base(root) == name {
+			return root, nil
+		}
+	}
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return "", fmt.Errorf("invalid root %s: %w", name, err)
+	}
+	if !slices.Contains(roots, abs) {
+		return "", fmt.Errorf("%s is not a git-replicator root (roots: %s)", name, strings.Join(roots, ", "))
+	}
+	return abs, nil
+}
+
+// currentRepoDir returns the git-replicator root and the repository directory ($root/<host>/<owner>/<repo>) containing the current directory.
+func currentRepoDir() (string, string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get current directory: %w", err)
+	}
+	roots, err := gitReplicatorRoots()
+	if err != nil {
+		return "", "", err
+	}
+	for _, rootDir := range roots {
+		var repoDir string
+		if repoDir, err = utils.FindRepoDir(cwd, rootDir); err == nil {
+			return rootDir, repoDir, nil
+		}
+	}
+	return "", "", err
+}
+
+// targetRepoDirs returns the git-replicator roots and either the repository directory containing the current directory or, with allRepos, every repository under the roots.
+func targetRepoDirs(allRepos bool) ([]string, []string, error) {
+	if !allRepos {
+		rootDir, repoDir, err := currentRepoDir()
+		if err != nil {
+			return nil, nil, err
+		}
+		return []string{rootDir}, []string{repoDir}, nil
+	}
+	roots, err := gitReplicatorRoots()
+	if err != nil {
+		return nil, nil, err
+	}
+	var repoDirs []string
+	for _, rootDir := range roots {
+		repos, err := handlers.List(context.Background(), rootDir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list repositories: %w", err)
+		}
+		for _, repo := range repos {
+			repoDirs = append(repoDirs, filepath.Dir(repo.Path))
+		}
+	}
+	return roots, repoDirs, nil
+}
+
+// relToRoot returns dir relative to the root of roots containing it, or dir itself when no root does.
+// With several roots the name of the root is kept so that repositories of different roots can be told apart.
+func relToRoot(roots []string, dir string) string {
+	rootDir, err := utils.FindRoot(roots, dir)
+	if err != nil {
+		return dir
+	}
+	rel, err := filepath.Rel(rootDir, dir)
+	if err != nil {
+		return dir
+	}
+	if len(roots) > 1 {
+		return filepath.Join(filepath.Base(rootDir), rel)
+	}
+	return rel
+}
+
+// confirm asks the user a yes/no question on stdin and reports whether the answer was yes.
+func confirm(prompt string) (bool, error) {
+	fmt.Fprintf(os.Stderr, "%s [y/N]: ", prompt)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, fmt.Errorf("failed to read answer: %w", err)
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
 func initConfig() {
 	if cfgFile != "" {
 		viper.SetConfigFile(cfgFile)
@@ -47,6 +195,9 @@ func initConfig() {
 		viper.AddConfigPath(home)
 		viper.SetConfigName(".git-replicator")
 	}
+	// Flags bound to viper can be set with GIT_REPLICATOR_<KEY> environment variables, e.g. GIT_REPLICATOR_OUTPUT or GIT_REPLICATOR_AGENT_COMMAND
+	viper.SetEnvPrefix("GIT_REPLICATOR")
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	viper.AutomaticEnv()
 	if err := viper.ReadInConfig(); err == nil {
 		fmt.Fprintf(os.Stderr, "Using config file: %s\n", viper.ConfigFileUsed())
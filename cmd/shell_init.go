@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+)
+
+var shellInitCmd = &cobra.Command{
+	Use:   "shell-init <bash|zsh|fish>",
+	Short: "Print a shell function that lets switch, get and cd change the current directory",
+	Long: `Print a shell function that wraps git-replicator so that switch, get and cd
+move the interactive shell into the target directory.
+
+  # bash / zsh
+  eval "$(git-replicator shell-init bash)"
+
+  # fish
+  git-replicator shell-init fish | source`,
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: handlers.SupportedShells(),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		script, err := handlers.ShellInit(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Print(script)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(shellInitCmd)
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+)
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the git status of every branch directory under the current repository",
+	Long: `Show, for every branch directory under the current repository, the branch checked out,
+its upstream, commits ahead/behind the upstream and base, modified and untracked files,
+and the last commit. A "*" after the branch marks a directory whose checked out branch
+differs from its name.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		jobs, err := cmd.Flags().GetInt("jobs")
+		if err != nil {
+			return err
+		}
+		_, repoDir, err := currentRepoDir()
+		if err != nil {
+			return err
+		}
+		statuses, err := handlers.Status(context.Background(), handlers.StatusOptions{RepoDir: repoDir, Jobs: jobs})
+		if err != nil {
+			return err
+		}
+
+		return newPrinter().Print(statuses, func(out io.Writer) error {
+			return printStatuses(out, statuses)
+		})
+	},
+}
+
+func printStatuses(out io.Writer, statuses []handlers.ReplicaStatus) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DIR\tBRANCH\tUPSTREAM\t+/- UPSTREAM\t+/- BASE\tCHANGES\tLAST COMMIT\tTASK")
+	for _, s := range statuses {
+		if s.Error != "" {
+			fmt.Fprintf(w, "%s\t\t\t\t\t\terror: %s\n", s.Name, s.Error)
+			continue
+		}
+		branch := s.Branch
+		if branch == "" {
+			branch = "(detached)"
+		}
+		if s.Mismatch {
+			branch += " *"
+		}
+		upstream, upstreamDiff := "-", "-"
+		if s.Upstream != "" {
+			upstream = s.Upstream
+			upstreamDiff = fmt.Sprintf("+%d/-%d", s.AheadUpstream, s.BehindUpstream)
+			if s.UpstreamGone {
+				upstream += " (gone)"
+				upstreamDiff = "-"
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t+%d/-%d\t%dM %dU\t%s %s\t%s\n",
+			s.Name, branch, upstream, upstreamDiff, s.AheadBase, s.BehindBase,
+			s.Modified, s.Untracked, s.LastCommitTime.Format(time.DateTime), s.LastCommitSubject, s.Task)
+	}
+	return w.Flush()
+}
+
+func init() {
+	statusCmd.Flags().IntP("jobs", "j", runtime.NumCPU(), "number of branch directories inspected concurrently")
+	rootCmd.AddCommand(statusCmd)
+}
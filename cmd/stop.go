@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+var stopCmd = &cobra.Command{
+	Use:   "stop [branch]",
+	Short: "Close the tmux window of the agent running in a replica",
+	Long: `Close the tmux window of the agent running in the named replica, or the whole tmux session
+of the current repository with --all. The replica itself is left untouched.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		all, err := cmd.Flags().GetBool("all")
+		if err != nil {
+			return err
+		}
+		if all == (len(args) == 1) {
+			return fmt.Errorf("specify either a branch or --all")
+		}
+		_, repoDir, err := currentRepoDir()
+		if err != nil {
+			return err
+		}
+		if all {
+			return handlers.StopAll(context.Background(), repoDir, utils.DefaultTmuxFunc)
+		}
+		return handlers.Stop(context.Background(), repoDir, args[0], utils.DefaultTmuxFunc)
+	},
+}
+
+func init() {
+	stopCmd.Flags().Bool("all", false, "close the tmux session of the current repository")
+	rootCmd.AddCommand(stopCmd)
+}
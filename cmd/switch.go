@@ -3,9 +3,13 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/terakoya76/git-replicator/internal/config"
 	"github.com/terakoya76/git-replicator/internal/handlers"
 	"github.com/terakoya76/git-replicator/internal/utils"
 )
@@ -13,20 +17,39 @@ import (
 var switchCmd = &cobra.Command{
 	Use:   "switch <branch>",
 	Short: "Clone current repo into a new branch directory (like git switch)",
-	Args:  cobra.ExactArgs(1),
+	Long: `Clone the current repository into a new branch directory and switch it to <branch>.
+Slashes in <branch> become "-" in the directory name, so feature/foo is cloned into feature-foo.
+The clone follows the protocol, clone and auth settings of the config file, and the
+post_switch hook runs in the new branch directory once it is ready.`,
+	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		branch := args[0]
-
-		cwd, err := os.Getwd()
+		printPath, err := cmd.Flags().GetBool("print-path")
 		if err != nil {
-			return fmt.Errorf("failed to get current directory: %w", err)
+			return err
+		}
+		claim, err := cmd.Flags().GetBool("claim")
+		if err != nil {
+			return err
 		}
-		rootDir, err := utils.GetGitReplicatorRoot()
+		task, err := cmd.Flags().GetString("task")
 		if err != nil {
-			return fmt.Errorf("failed to get git-replicator root: %w", err)
+			return err
+		}
+		labels, err := cmd.Flags().GetStringArray("label")
+		if err != nil {
+			return err
 		}
 
-		repoDir, err := utils.FindRepoDir(cwd, rootDir)
+		rootDir, repoDir, err := currentRepoDir()
+		if err != nil {
+			return err
+		}
+		cfg, err := config.Load()
+		if err != nil {
+			return err
+		}
+		settings, err := repoSettings(cfg, rootDir, repoDir)
 		if err != nil {
 			return err
 		}
@@ -34,14 +57,38 @@ var switchCmd = &cobra.Command{
 			RepoDir:           repoDir,
 			BranchName:        branch,
 			GitReplicatorRoot: rootDir,
+			Creator:           handlers.DefaultLeaseOwner(),
+			Task:              task,
+			Labels:            labels,
+			PostSwitch:        settings.Hooks.PostSwitch,
+			Output:            os.Stderr,
 		}
-		if err := handlers.Switch(context.Background(), opts, utils.DefaultGetRemoteURL, utils.DefaultCloneFunc, utils.DefaultSwitchBranchFunc); err != nil {
+		if err := handlers.Switch(context.Background(), opts, remoteURLFunc(settings.Protocol), newCloneFunc(settings), utils.DefaultSwitchBranchFunc); err != nil {
 			return err
 		}
-		return nil
+		if claim {
+			claimOpts := handlers.ClaimOptions{RepoDir: repoDir, Name: branch, Owner: handlers.DefaultLeaseOwner(), PID: os.Getppid(), Now: time.Now()}
+			if _, err := handlers.Claim(context.Background(), claimOpts); err != nil {
+				return err
+			}
+		}
+		branchDir := filepath.Join(repoDir, utils.ReplicaDirName(branch))
+		if printPath {
+			fmt.Println(branchDir)
+			return nil
+		}
+		result := handlers.BranchDirInfo{Name: branch, Path: branchDir, Branch: branch}
+		return newPrinter().Print(result, func(w io.Writer) error {
+			_, err := fmt.Fprintf(w, "cloned branch: %s to dir: %s\n", branch, branchDir)
+			return err
+		})
 	},
 }
 
 func init() {
+	switchCmd.Flags().String("task", "", "description of the work in the new branch directory, recorded in its metadata")
+	switchCmd.Flags().StringArray("label", nil, "label recorded in the metadata of the new branch directory (repeatable)")
+	switchCmd.Flags().Bool("claim", false, "lease the new branch directory without expiry (see claim)")
+	switchCmd.Flags().Bool("print-path", false, "print only the branch directory path (used by shell-init)")
 	rootCmd.AddCommand(switchCmd)
 }
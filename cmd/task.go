@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/terakoya76/git-replicator/internal/config"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+var taskCmd = &cobra.Command{
+	Use:   "task",
+	Short: "Queue tasks and run the agent command on them in replicas of their own",
+	Long: `Manage the task queue of the current repository, kept in
+<repo>/.git-replicator/tasks.json.
+
+"task add" queues a task, and "task run" works through the queue: for each task it creates
+a replica named after a slug of the description, writes the description to TASK.md in it,
+runs the agent command there and records the exit code. Run several workers to work on
+tasks in parallel.`,
+}
+
+var taskAddCmd = &cobra.Command{
+	Use:   "add <description>",
+	Short: "Queue a task",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		labels, err := cmd.Flags().GetStringArray("label")
+		if err != nil {
+			return err
+		}
+		_, repoDir, err := currentRepoDir()
+		if err != nil {
+			return err
+		}
+		task, err := handlers.AddTask(context.Background(), repoDir, args[0], labels, time.Now())
+		if err != nil {
+			return err
+		}
+		return newPrinter().Print(task, func(w io.Writer) error {
+			_, err := fmt.Fprintf(w, "Queued task %d: %s\n", task.ID, task.Branch)
+			return err
+		})
+	},
+}
+
+var taskListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List the tasks of the current repository",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, repoDir, err := currentRepoDir()
+		if err != nil {
+			return err
+		}
+		tasks, err := handlers.ListTasks(repoDir)
+		if err != nil {
+			return err
+		}
+		return newPrinter().Print(tasks, func(w io.Writer) error {
+			return printTasks(w, tasks)
+		})
+	},
+}
+
+var taskRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Run the agent command on queued tasks",
+	Long: `Take queued tasks one at a time, create a replica for each, write the task to TASK.md
+in it and run the agent command there with sh -c. The command finds the task in
+$GIT_REPLICATOR_TASK and $GIT_REPLICATOR_TASK_FILE. The replica is leased to --owner while
+the command runs, and its output is saved to <repo>/.git-replicator/logs/task-<id>.log.
+
+Each task is claimed in the queue with the owner, PID and host of the worker before its
+replica is created. Running tasks whose worker process is gone from this host are queued
+again and resume in the replica created for them.
+
+The agent command is taken from --command or from agent.command in the config file.
+Without --watch the worker stops when the queue is empty.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		command, err := flags.GetString("command")
+		if err != nil {
+			return err
+		}
+		if command == "" {
+			command = viper.GetString("agent.command")
+		}
+		owner, err := flags.GetString("owner")
+		if err != nil {
+			return err
+		}
+		if owner == "" {
+			owner = handlers.DefaultLeaseOwner()
+		}
+		maxTasks, err := flags.GetInt("max")
+		if err != nil {
+			return err
+		}
+		watch, err := flags.GetBool("watch")
+		if err != nil {
+			return err
+		}
+		intervalFlag, err := flags.GetString("interval")
+		if err != nil {
+			return err
+		}
+		rootDir, repoDir, err := currentRepoDir()
+		if err != nil {
+			return err
+		}
+		cfg, err := config.Load()
+		if err != nil {
+			return err
+		}
+		settings, err := repoSettings(cfg, rootDir, repoDir)
+		if err != nil {
+			return err
+		}
+
+		printer := newPrinter()
+		// Keep stdout for the results when they are machine-readable
+		var output io.Writer = os.Stdout
+		if printer.Structured() {
+			output = os.Stderr
+		}
+		opts := handlers.RunTasksOptions{
+			RepoDir:           repoDir,
+			GitReplicatorRoot: rootDir,
+			Command:           command,
+			Owner:             owner,
+			Max:               maxTasks,
+			PostSwitch:        settings.Hooks.PostSwitch,
+			Output:            output,
+		}
+		if watch {
+			if opts.PollInterval, err = utils.ParseDuration(intervalFlag); err != nil {
+				return err
+			}
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		tasks, err := handlers.RunTasks(ctx, opts, remoteURLFunc(settings.Protocol), newCloneFunc(settings), utils.DefaultSwitchBranchFunc)
+		if err != nil {
+			return err
+		}
+		err = printer.Print(tasks, func(w io.Writer) error {
+			if len(tasks) == 0 {
+				_, err := fmt.Fprintln(w, "No queued tasks")
+				return err
+			}
+			fmt.Fprintln(w)
+			return printTasks(w, tasks)
+		})
+		if err != nil {
+			return err
+		}
+		failed := 0
+		for _, task := range tasks {
+			if task.Status == handlers.TaskStatusFailed {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d tasks failed", failed, len(tasks))
+		}
+		return nil
+	},
+}
+
+func printTasks(w io.Writer, tasks []handlers.Task) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tBRANCH\tSTATUS\tEXIT\tDESCRIPTION")
+	for _, task := range tasks {
+		exit := "-"
+		if task.Status == handlers.TaskStatusDone || task.Status == handlers.TaskStatusFailed {
+			exit = fmt.Sprint(task.ExitCode)
+		}
+		description, _, _ := strings.Cut(task.Description, "\n")
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", task.ID, task.Branch, task.Status, exit, description)
+	}
+	return tw.Flush()
+}
+
+func init() {
+	taskAddCmd.Flags().StringArray("label", nil, "label recorded in the metadata of the replica of the task (repeatable)")
+	taskRunCmd.Flags().String("command", "", "agent command to run for each task (config: agent.command)")
+	taskRunCmd.Flags().String("owner", "", "lease owner of the replicas while their task runs (default $"+handlers.LeaseOwnerEnv+" or the current user)")
+	taskRunCmd.Flags().Int("max", 0, "stop after running this many tasks (0 runs all)")
+	taskRunCmd.Flags().Bool("watch", false, "wait for new tasks when the queue is empty")
+	taskRunCmd.Flags().String("interval", "30s", "how often to check the queue with --watch")
+	taskCmd.AddCommand(taskAddCmd, taskListCmd, taskRunCmd)
+	rootCmd.AddCommand(taskCmd)
+}
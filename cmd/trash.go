@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+var trashCmd = &cobra.Command{
+	Use:   "trash",
+	Short: "Manage branch directories moved to the trash by delete",
+}
+
+var trashListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List branch directories in the trash",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		roots, err := gitReplicatorRoots()
+		if err != nil {
+			return err
+		}
+		var entries []handlers.TrashEntry
+		for _, rootDir := range roots {
+			rootEntries, err := handlers.ListTrash(context.Background(), rootDir)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, rootEntries...)
+		}
+		return newPrinter().Print(entries, func(out io.Writer) error {
+			w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "DELETED AT\tREPOSITORY\tBRANCH\tID")
+			for _, e := range entries {
+				fmt.Fprintf(w, "%s\t%s/%s/%s\t%s\t%s\n", e.DeletedAt.Format(time.RFC3339), e.Host, e.Owner, e.Repo, e.Branch, e.ID)
+			}
+			return w.Flush()
+		})
+	},
+}
+
+var trashEmptyCmd = &cobra.Command{
+	Use:   "empty",
+	Short: "Permanently remove branch directories from the trash",
+	Long: `Permanently remove branch directories from the trash.
+The entries are listed and removed after confirmation.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := context.Background()
+		olderThanFlag, err := cmd.Flags().GetString("older-than")
+		if err != nil {
+			return err
+		}
+		olderThan, err := utils.ParseDuration(olderThanFlag)
+		if err != nil {
+			return err
+		}
+		yes, err := cmd.Flags().GetBool("yes")
+		if err != nil {
+			return err
+		}
+		roots, err := gitReplicatorRoots()
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		var expired []handlers.TrashEntry
+		for _, rootDir := range roots {
+			rootExpired, err := handlers.ExpiredTrash(ctx, rootDir, olderThan, now)
+			if err != nil {
+				return err
+			}
+			expired = append(expired, rootExpired...)
+		}
+		printer := newPrinter()
+		if len(expired) == 0 {
+			return printer.Print(expired, func(w io.Writer) error {
+				_, err := fmt.Fprintln(w, "No entries to remove from the trash")
+				return err
+			})
+		}
+		if !yes {
+			// Keep stdout for the structured result
+			listOut := io.Writer(os.Stdout)
+			if printer.Structured() {
+				listOut = os.Stderr
+			}
+			for _, e := range expired {
+				fmt.Fprintf(listOut, "%s/%s/%s %s (deleted at %s)\n", e.Host, e.Owner, e.Repo, e.Branch, e.DeletedAt.Format(time.RFC3339))
+			}
+			ok, err := confirm(fmt.Sprintf("Permanently remove %d entries from the trash?", len(expired)))
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return nil
+			}
+		}
+
+		var removed []handlers.TrashEntry
+		for _, rootDir := range roots {
+			var rootRemoved []handlers.TrashEntry
+			rootRemoved, err = handlers.EmptyTrash(ctx, rootDir, olderThan, now)
+			removed = append(removed, rootRemoved...)
+			if err != nil {
+				break
+			}
+		}
+		printErr := printer.Print(removed, func(w io.Writer) error {
+			for _, e := range removed {
+				fmt.Fprintf(w, "Removed from trash: %s/%s/%s %s (deleted at %s)\n", e.Host, e.Owner, e.Repo, e.Branch, e.DeletedAt.Format(time.RFC3339))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return printErr
+	},
+}
+
+func init() {
+	trashEmptyCmd.Flags().BoolP("yes", "y", false, "do not ask for confirmation")
+	trashEmptyCmd.Flags().String("older-than", "0", "only remove entries deleted longer ago than this (e.g. 7d, 12h)")
+	trashCmd.AddCommand(trashListCmd, trashEmptyCmd)
+	rootCmd.AddCommand(trashCmd)
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/terakoya76/git-replicator/internal/config"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+)
+
+var updateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Fast-forward base to origin and optionally rebase or merge every replica onto it",
+	Long: `Fetch origin in base and fast-forward it to the default branch of origin.
+
+With --rebase or --merge, the branch of every replica of the current repository is then
+rebased onto or merged with the new base. Replicas with uncommitted changes or a detached
+HEAD are skipped, and a rebase or merge that conflicts is aborted so that the replica is
+left as it was.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		rebase, err := flags.GetBool("rebase")
+		if err != nil {
+			return err
+		}
+		merge, err := flags.GetBool("merge")
+		if err != nil {
+			return err
+		}
+		rootDir, repoDir, err := currentRepoDir()
+		if err != nil {
+			return err
+		}
+		cfg, err := config.Load()
+		if err != nil {
+			return err
+		}
+		opts := handlers.UpdateOptions{RepoDir: repoDir}
+		switch {
+		case rebase:
+			opts.Mode = handlers.UpdateModeRebase
+		case merge:
+			opts.Mode = handlers.UpdateModeMerge
+		}
+
+		results, err := handlers.Update(context.Background(), opts, newFetchFunc(cfg, []string{rootDir}))
+		if err != nil {
+			return err
+		}
+		err = newPrinter().Print(results, func(w io.Writer) error {
+			return printUpdateResults(w, results)
+		})
+		if err != nil {
+			return err
+		}
+		failed := 0
+		for _, r := range results {
+			if r.Status == handlers.UpdateStatusConflict || r.Status == handlers.UpdateStatusFailed {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d replicas could not be updated", failed)
+		}
+		return nil
+	},
+}
+
+func printUpdateResults(w io.Writer, results []handlers.UpdateResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DIR\tSTATUS\tDETAIL")
+	for _, r := range results {
+		detail := r.Detail
+		if len(r.Conflicts) > 0 {
+			detail += " (conflicts: " + strings.Join(r.Conflicts, ", ") + ")"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Branch, r.Status, detail)
+	}
+	return tw.Flush()
+}
+
+func init() {
+	updateCmd.Flags().Bool("rebase", false, "rebase the branch of every replica onto the new base")
+	updateCmd.Flags().Bool("merge", false, "merge the new base into the branch of every replica")
+	updateCmd.MarkFlagsMutuallyExclusive("rebase", "merge")
+	rootCmd.AddCommand(updateCmd)
+}
@@ -0,0 +1,215 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// Problem is an unknown key or an invalid value in a config file.
+type Problem struct {
+	File string `json:"file,omitempty"`
+	// Line and Column locate the key in File, starting at 1. They are 0 when unknown.
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Key     string `json:"key"`
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	var b strings.Builder
+	if p.File != "" {
+		b.WriteString(p.File)
+		if p.Line > 0 {
+			fmt.Fprintf(&b, ":%d:%d", p.Line, p.Column)
+		}
+		b.WriteString(": ")
+	}
+	fmt.Fprintf(&b, "%s: %s", p.Key, p.Message)
+	return b.String()
+}
+
+// Check reads the YAML or JSON config file at path and reports its unknown keys and invalid values with their position.
+func Check(path string) ([]Problem, error) {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml", ".json":
+	default:
+		return nil, fmt.Errorf("unsupported config file type %q: only YAML and JSON files can be checked", ext)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	c := checker{file: path, nodes: map[string]*yaml.Node{}}
+	if len(doc.Content) > 0 {
+		c.check(doc.Content[0], reflect.TypeFor[fileConfig](), "")
+	}
+	// Values of the wrong type cannot be decoded, so only validate well-formed files
+	if !c.malformed {
+		v := viper.New()
+		v.SetConfigFile(path)
+		if err := v.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		var cfg Config
+		if err := v.Unmarshal(&cfg); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+		}
+		for _, p := range cfg.Validate() {
+			c.add(c.lookup(p.Key), p.Key, "%s", p.Message)
+		}
+	}
+	sort.SliceStable(c.problems, func(i, j int) bool {
+		return c.problems[i].Line < c.problems[j].Line
+	})
+	return c.problems, nil
+}
+
+// fileConfig is the schema of a config file: Config and the global flags, which can be set in the file too.
+type fileConfig struct {
+	Config  `mapstructure:",squash"`
+	Verbose bool   `mapstructure:"verbose"`
+	Output  string `mapstructure:"output"`
+	Format  string `mapstructure:"format"`
+}
+
+// checker walks a YAML document along the Config type.
+type checker struct {
+	file     string
+	problems []Problem
+	// malformed is set when a value has the wrong type.
+	malformed bool
+	// nodes maps the lowercased keys seen to their key node, or value node for sequence items.
+	nodes map[string]*yaml.Node
+}
+
+func (c *checker) add(node *yaml.Node, key, format string, args ...any) {
+	p := Problem{File: c.file, Key: key, Message: fmt.Sprintf(format, args...)}
+	if node != nil {
+		p.Line, p.Column = node.Line, node.Column
+	}
+	c.problems = append(c.problems, p)
+}
+
+// invalid reports a value of the wrong type.
+func (c *checker) invalid(node *yaml.Node, key, format string, args ...any) {
+	c.malformed = true
+	c.add(node, key, format, args...)
+}
+
+// lookup returns the node of key, or of the closest parent key that is in the file.
+func (c *checker) lookup(key string) *yaml.Node {
+	key = strings.ToLower(key)
+	for key != "" {
+		if node, ok := c.nodes[key]; ok {
+			return node
+		}
+		i := strings.LastIndexAny(key, ".[")
+		if i < 0 {
+			break
+		}
+		key = key[:i]
+	}
+	return nil
+}
+
+func (c *checker) check(node *yaml.Node, t reflect.Type, key string) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	// An empty value leaves the setting unset
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		return
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			c.invalid(node, key, "must be a mapping")
+			return
+		}
+		fields := structFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			k, v := node.Content[i], node.Content[i+1]
+			name := strings.ToLower(k.Value)
+			child := joinKey(key, name)
+			c.nodes[child] = k
+			ft, ok := fields[name]
+			if !ok {
+				c.add(k, child, "unknown key")
+				continue
+			}
+			c.check(v, ft, child)
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			c.invalid(node, key, "must be a mapping")
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			k, v := node.Content[i], node.Content[i+1]
+			child := joinKey(key, strings.ToLower(k.Value))
+			c.nodes[child] = k
+			c.check(v, t.Elem(), child)
+		}
+	case reflect.Slice:
+		// Like viper, accept a single value for a list of values
+		if node.Kind == yaml.ScalarNode && t.Elem().Kind() != reflect.Struct {
+			c.check(node, t.Elem(), key)
+			return
+		}
+		if node.Kind != yaml.SequenceNode {
+			c.invalid(node, key, "must be a list")
+			return
+		}
+		for i, item := range node.Content {
+			child := fmt.Sprintf("%s[%d]", key, i)
+			c.nodes[child] = item
+			c.check(item, t.Elem(), child)
+		}
+	default:
+		if node.Kind != yaml.ScalarNode {
+			c.invalid(node, key, "must be a %s", t.Kind())
+			return
+		}
+		if t.Kind() == reflect.String {
+			return
+		}
+		if err := node.Decode(reflect.New(t).Interface()); err != nil {
+			c.invalid(node, key, "invalid %s %q", t.Kind(), node.Value)
+		}
+	}
+}
+
+// structFields returns the types of the fields of t by their mapstructure key, including the fields of squashed structs.
+func structFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("mapstructure"), ",")
+		if opts == "squash" {
+			maps.Copy(fields, structFields(f.Type))
+			continue
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+func joinKey(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
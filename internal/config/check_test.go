@@ -0,0 +1,116 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/terakoya76/git-replicator/internal/config"
+)
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+	return path
+}
+
+func TestCheck(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		path := writeConfigFile(t, "config.yaml", `root: ~/src
+roots: ~/work
+verbose: true
+default_protocol: ssh
+clone:
+  depth: 1
+repos:
+  - match: github.com/acme/*
+    hooks:
+      post_switch: make setup
+agent:
+  profile: Claude
+profiles:
+  Claude:
+    command: claude
+`)
+		problems, err := config.Check(path)
+		assert.NoError(t, err)
+		assert.Empty(t, problems)
+	})
+
+	t.Run("unknown keys and wrong types", func(t *testing.T) {
+		path := writeConfigFile(t, "config.yaml", `rot: ~/src
+clone:
+  depth: deep
+  shallow: true
+repos:
+  match: github.com/acme/*
+profiles:
+  claude:
+    command: [claude]
+`)
+		problems, err := config.Check(path)
+		assert.NoError(t, err)
+		assert.Equal(t, []config.Problem{
+			{File: path, Line: 1, Column: 1, Key: "rot", Message: "unknown key"},
+			{File: path, Line: 3, Column: 10, Key: "clone.depth", Message: `invalid int "deep"`},
+			{File: path, Line: 4, Column: 3, Key: "clone.shallow", Message: "unknown key"},
+			{File: path, Line: 6, Column: 3, Key: "repos", Message: "must be a list"},
+			{File: path, Line: 9, Column: 14, Key: "profiles.claude.command", Message: "must be a string"},
+		}, problems)
+	})
+
+	t.Run("invalid values", func(t *testing.T) {
+		path := writeConfigFile(t, "config.yml", `default_protocol: ftp
+repos:
+  - match: github.com/acme/*
+  - protocol: ssh
+profiles:
+  cursor:
+    command: cursor
+    workdir: home
+`)
+		problems, err := config.Check(path)
+		assert.NoError(t, err)
+		if assert.Len(t, problems, 3) {
+			assert.Equal(t, 1, problems[0].Line)
+			assert.Equal(t, "default_protocol", problems[0].Key)
+			assert.Contains(t, problems[0].Message, `unsupported protocol "ftp"`)
+			// The missing key is reported at its entry
+			assert.Equal(t, 4, problems[1].Line)
+			assert.Equal(t, "repos[1].match", problems[1].Key)
+			assert.Equal(t, 6, problems[2].Line)
+			assert.Equal(t, "profiles.cursor", problems[2].Key)
+			assert.Equal(t, path+`:6:3: profiles.cursor: invalid workdir "home": must be replica or repo`, problems[2].String())
+		}
+	})
+
+	t.Run("unknown keys and invalid values", func(t *testing.T) {
+		path := writeConfigFile(t, "config.yaml", "rooot: x\nclone:\n  depth: -2\n")
+		problems, err := config.Check(path)
+		assert.NoError(t, err)
+		assert.Equal(t, []config.Problem{
+			{File: path, Line: 1, Column: 1, Key: "rooot", Message: "unknown key"},
+			{File: path, Line: 3, Column: 3, Key: "clone.depth", Message: "must not be negative"},
+		}, problems)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		path := writeConfigFile(t, "config.json", "{\n  \"clone\": {\"depth\": -1}\n}\n")
+		problems, err := config.Check(path)
+		assert.NoError(t, err)
+		assert.Equal(t, []config.Problem{{File: path, Line: 2, Column: 13, Key: "clone.depth", Message: "must not be negative"}}, problems)
+	})
+
+	t.Run("unreadable", func(t *testing.T) {
+		_, err := config.Check(writeConfigFile(t, "config.yaml", "clone: [\n"))
+		assert.ErrorContains(t, err, "line")
+		_, err = config.Check(writeConfigFile(t, "config.toml", "root = '~'\n"))
+		assert.ErrorContains(t, err, "unsupported config file type")
+		_, err = config.Check(filepath.Join(t.TempDir(), "missing.yaml"))
+		assert.Error(t, err)
+	})
+}
@@ -1,19 +1,385 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
 
 	"github.com/spf13/viper"
 )
 
+// Config is the content of the config file ($HOME/.git-replicator.yaml by default).
 type Config struct {
-	// Add your configuration fields here
+	// Root is the primary directory repositories are cloned into, $HOME/git-replicator by default.
+	Root string `mapstructure:"root" json:"root,omitempty"`
+	// Roots are further directories holding repositories, e.g. a work root next to a personal one.
+	Roots []string `mapstructure:"roots" json:"roots,omitempty"`
+	// DefaultHost is the host of repositories given to get as owner/repo.
+	DefaultHost string `mapstructure:"default_host" json:"default_host"`
+	// DefaultProtocol is the protocol of the URLs git-replicator builds: ProtocolHTTPS or ProtocolSSH.
+	DefaultProtocol string             `mapstructure:"default_protocol" json:"default_protocol"`
+	Clone           CloneConfig        `mapstructure:"clone" json:"clone,omitzero"`
+	Auth            AuthConfig         `mapstructure:"auth" json:"auth,omitzero"`
+	Hooks           HooksConfig        `mapstructure:"hooks" json:"hooks,omitzero"`
+	Repos           []RepoConfig       `mapstructure:"repos" json:"repos,omitempty"`
+	Agent           AgentConfig        `mapstructure:"agent" json:"agent,omitzero"`
+	Profiles        map[string]Profile `mapstructure:"profiles" json:"profiles,omitempty"`
 }
 
+const (
+	DefaultHost     = "github.com"
+	ProtocolHTTPS   = "https"
+	ProtocolSSH     = "ssh"
+	DefaultProtocol = ProtocolHTTPS
+)
+
+// Protocols lists the values accepted by default_protocol and the protocol of repos entries.
+var Protocols = []string{ProtocolHTTPS, ProtocolSSH}
+
+// CloneConfig tunes the clones made by get, switch and task run.
+type CloneConfig struct {
+	// Depth limits the history fetched to this many commits. 0 fetches all of it.
+	Depth int `mapstructure:"depth" json:"depth,omitempty"`
+	// SingleBranch fetches only the branch checked out by the clone.
+	SingleBranch bool `mapstructure:"single_branch" json:"single_branch,omitempty"`
+	// RecurseSubmodules also clones the submodules.
+	RecurseSubmodules bool `mapstructure:"recurse_submodules" json:"recurse_submodules,omitempty"`
+}
+
+// AuthConfig holds the credentials used to clone, fetch and push. Without any, HTTPS is anonymous and SSH uses the SSH agent.
+type AuthConfig struct {
+	// Username is the user of HTTPS basic auth, "git" by default.
+	Username string `mapstructure:"username" json:"username,omitempty"`
+	// TokenEnv names the environment variable holding the password or token used over HTTPS.
+	TokenEnv string `mapstructure:"token_env" json:"token_env,omitempty"`
+	// SSHKey is the private key file used over SSH.
+	SSHKey string `mapstructure:"ssh_key" json:"ssh_key,omitempty"`
+}
+
+// Token returns the HTTPS password or token, read from the environment variable named by TokenEnv.
+func (a AuthConfig) Token() string {
+	if a.TokenEnv == "" {
+		return ""
+	}
+	return os.Getenv(a.TokenEnv)
+}
+
+// HooksConfig holds shell commands run with sh -c at points of the life of a replica.
+// They find the name of the branch directory in $GIT_REPLICATOR_REPLICA.
+type HooksConfig struct {
+	// PostGet runs in base after get clones a repository.
+	PostGet string `mapstructure:"post_get" json:"post_get,omitempty"`
+	// PostSwitch runs in a new replica after switch or task run creates it.
+	PostSwitch string `mapstructure:"post_switch" json:"post_switch,omitempty"`
+}
+
+// RepoConfig overrides settings for the repositories matching Match.
+// Every setting it sets replaces the global one; clone, auth and hooks are replaced as a whole.
+type RepoConfig struct {
+	// Match is a host/owner/repo glob pattern (see path.Match), e.g. "github.com/acme/*".
+	Match    string      `mapstructure:"match" json:"match"`
+	Protocol string      `mapstructure:"protocol" json:"protocol,omitempty"`
+	Clone    CloneConfig `mapstructure:"clone" json:"clone,omitzero"`
+	Auth     AuthConfig  `mapstructure:"auth" json:"auth,omitzero"`
+	Hooks    HooksConfig `mapstructure:"hooks" json:"hooks,omitzero"`
+}
+
+// RepoSettings are the settings in effect for a repository.
+type RepoSettings struct {
+	Protocol string
+	Clone    CloneConfig
+	Auth     AuthConfig
+	Hooks    HooksConfig
+}
+
+// AgentConfig configures the agent started by launch and task run when no profile is given.
+type AgentConfig struct {
+	Command string `mapstructure:"command" json:"command,omitempty"`
+	// Profile is the name of the profile used by default by launch and open.
+	Profile string `mapstructure:"profile" json:"profile,omitempty"`
+}
+
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+const (
+	// WorkdirReplica runs the agent in the replica.
+	WorkdirReplica = "replica"
+	// WorkdirRepo runs the agent in the repository directory holding base and every replica.
+	WorkdirRepo = "repo"
+)
+
+// Profile describes how to start an agent or editor in a replica.
+type Profile struct {
+	// Command is a text/template rendered with ProfileData and run with sh -c, e.g. "cursor {{quote .Dir}}".
+	// The quote function quotes a value as a single shell word.
+	Command string `mapstructure:"command" json:"command"`
+	// Env holds KEY=VALUE pairs added to the environment of the command.
+	Env []string `mapstructure:"env" json:"env,omitempty"`
+	// Workdir is the working directory policy: WorkdirReplica (the default) or WorkdirRepo.
+	Workdir string `mapstructure:"workdir" json:"workdir,omitempty"`
+}
+
+// ProfileData is available to the command template of a profile.
+type ProfileData struct {
+	// Name is the branch directory name of the replica.
+	Name string
+	// Dir is the path of the replica.
+	Dir     string
+	RepoDir string
+	// Branch is the branch checked out in the replica.
+	Branch string
+	// Task is the task recorded in the metadata of the replica.
+	Task string
+}
+
+// Validate reports invalid settings of the profile.
+func (p Profile) Validate() error {
+	if strings.TrimSpace(p.Command) == "" {
+		return fmt.Errorf("command is required")
+	}
+	if _, err := template.New("command").Funcs(templateFuncs).Parse(p.Command); err != nil {
+		return fmt.Errorf("invalid command template: %w", err)
+	}
+	for _, kv := range p.Env {
+		if key, _, ok := strings.Cut(kv, "="); !ok || key == "" {
+			return fmt.Errorf("invalid env entry %q: must be KEY=VALUE", kv)
+		}
+	}
+	switch p.Workdir {
+	case "", WorkdirReplica, WorkdirRepo:
+	default:
+		return fmt.Errorf("invalid workdir %q: must be %s or %s", p.Workdir, WorkdirReplica, WorkdirRepo)
+	}
+	return nil
+}
+
+// templateFuncs are the functions available to the command template of a profile.
+var templateFuncs = template.FuncMap{"quote": shellQuote}
+
+// shellQuote quotes s as a single word for sh, so that paths with spaces and free text such as tasks can be passed safely.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Render returns the command of the profile for data.
+func (p Profile) Render(data ProfileData) (string, error) {
+	tmpl, err := template.New("command").Funcs(templateFuncs).Option("missingkey=error").Parse(p.Command)
+	if err != nil {
+		return "", fmt.Errorf("invalid command template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render command: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// WorkingDir returns the directory the command of the profile runs in for data.
+func (p Profile) WorkingDir(data ProfileData) string {
+	if p.Workdir == WorkdirRepo {
+		return data.RepoDir
+	}
+	return data.Dir
+}
+
+// Profile returns the profile name, or the default profile if name is empty.
+// Without a default profile, agent.command is used as a profile of its own.
+func (c *Config) Profile(name string) (Profile, error) {
+	if name == "" {
+		name = c.Agent.Profile
+	}
+	if name == "" {
+		if c.Agent.Command == "" {
+			return Profile{}, fmt.Errorf("no agent configured (set agent.command or agent.profile, or pass --profile)")
+		}
+		return Profile{Command: c.Agent.Command}, nil
+	}
+	p, ok := c.lookupProfile(name)
+	if !ok {
+		if len(c.Profiles) == 0 {
+			return Profile{}, fmt.Errorf("unknown profile %q: no profiles configured", name)
+		}
+		names := make([]string, 0, len(c.Profiles))
+		for n := range c.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return Profile{}, fmt.Errorf("unknown profile %q (available: %s)", name, strings.Join(names, ", "))
+	}
+	if err := p.Validate(); err != nil {
+		return Profile{}, fmt.Errorf("invalid profile %q: %w", name, err)
+	}
+	return p, nil
+}
+
+// ForRepo returns the settings for the repository name (host/owner/repo), applying the repos entries matching it in order.
+func (c *Config) ForRepo(name string) RepoSettings {
+	settings := RepoSettings{Protocol: c.DefaultProtocol, Clone: c.Clone, Auth: c.Auth, Hooks: c.Hooks}
+	if settings.Protocol == "" {
+		settings.Protocol = DefaultProtocol
+	}
+	for _, repo := range c.Repos {
+		if ok, err := path.Match(strings.ToLower(repo.Match), strings.ToLower(name)); err != nil || !ok {
+			continue
+		}
+		if repo.Protocol != "" {
+			settings.Protocol = repo.Protocol
+		}
+		if repo.Clone != (CloneConfig{}) {
+			settings.Clone = repo.Clone
+		}
+		if repo.Auth != (AuthConfig{}) {
+			settings.Auth = repo.Auth
+		}
+		if repo.Hooks != (HooksConfig{}) {
+			settings.Hooks = repo.Hooks
+		}
+	}
+	return settings
+}
+
+// RepoURL returns the clone URL of host/owner/repo for protocol.
+func RepoURL(protocol, host, owner, repo string) string {
+	if protocol == ProtocolSSH {
+		return fmt.Sprintf("git@%s:%s/%s.git", host, owner, repo)
+	}
+	return fmt.Sprintf("https://%s/%s/%s.git", host, owner, repo)
+}
+
+// ExpandRepoURL returns ref as a clone URL. URLs are returned as is, while owner/repo and host/owner/repo
+// are completed with the default host and the protocol in effect for the repository.
+func (c *Config) ExpandRepoURL(ref string) (string, error) {
+	if strings.Contains(ref, "://") || strings.Contains(ref, "@") {
+		return ref, nil
+	}
+	parts := strings.Split(strings.TrimSuffix(strings.Trim(ref, "/"), ".git"), "/")
+	if len(parts) == 2 {
+		host := c.DefaultHost
+		if host == "" {
+			host = DefaultHost
+		}
+		parts = append([]string{host}, parts...)
+	}
+	if len(parts) != 3 || slices.Contains(parts, "") {
+		return "", fmt.Errorf("invalid repository %q: must be a URL, owner/repo or host/owner/repo", ref)
+	}
+	settings := c.ForRepo(strings.Join(parts, "/"))
+	return RepoURL(settings.Protocol, parts[0], parts[1], parts[2]), nil
+}
+
+// RootDirs returns the configured roots, the primary one first.
+func (c *Config) RootDirs() []string {
+	// Root is set from $GIT_REPLICATOR_ROOT too, which may list several directories
+	roots := filepath.SplitList(c.Root)
+	return append(roots, c.Roots...)
+}
+
+// lookupProfile returns the profile name. Viper lowercases the keys of the config file, so the names are compared case-insensitively.
+func (c *Config) lookupProfile(name string) (Profile, bool) {
+	if p, ok := c.Profiles[name]; ok {
+		return p, true
+	}
+	p, ok := c.Profiles[strings.ToLower(name)]
+	return p, ok
+}
+
+// Validate reports the invalid settings of the config. Keys are dotted paths such as "clone.depth" or "repos[0].match".
+func (c *Config) Validate() []Problem {
+	var problems []Problem
+	add := func(key string, format string, args ...any) {
+		problems = append(problems, Problem{Key: key, Message: fmt.Sprintf(format, args...)})
+	}
+	if c.Root != "" && strings.TrimSpace(c.Root) == "" {
+		add("root", "must not be blank")
+	}
+	for i, root := range c.Roots {
+		if strings.TrimSpace(root) == "" {
+			add(fmt.Sprintf("roots[%d]", i), "must not be empty")
+		}
+	}
+	if strings.ContainsAny(c.DefaultHost, "/: ") {
+		add("default_host", "invalid host %q: must be a host name such as %s", c.DefaultHost, DefaultHost)
+	}
+	validateProtocol := func(key, protocol string) {
+		if protocol != "" && !slices.Contains(Protocols, protocol) {
+			add(key, "unsupported protocol %q (supported: %s)", protocol, strings.Join(Protocols, ", "))
+		}
+	}
+	validateClone := func(key string, clone CloneConfig) {
+		if clone.Depth < 0 {
+			add(key+".depth", "must not be negative")
+		}
+	}
+	validateAuth := func(key string, auth AuthConfig) {
+		if auth.TokenEnv != "" && !envNamePattern.MatchString(auth.TokenEnv) {
+			add(key+".token_env", "invalid environment variable name %q", auth.TokenEnv)
+		}
+	}
+	validateProtocol("default_protocol", c.DefaultProtocol)
+	validateClone("clone", c.Clone)
+	validateAuth("auth", c.Auth)
+	for i, repo := range c.Repos {
+		key := fmt.Sprintf("repos[%d]", i)
+		if repo.Match == "" {
+			add(key+".match", "is required")
+		} else if _, err := path.Match(repo.Match, ""); err != nil {
+			add(key+".match", "invalid pattern %q: %v", repo.Match, err)
+		}
+		validateProtocol(key+".protocol", repo.Protocol)
+		validateClone(key+".clone", repo.Clone)
+		validateAuth(key+".auth", repo.Auth)
+	}
+	if c.Agent.Profile != "" {
+		if _, ok := c.lookupProfile(c.Agent.Profile); !ok {
+			add("agent.profile", "unknown profile %q", c.Agent.Profile)
+		}
+	}
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := c.Profiles[name].Validate(); err != nil {
+			add("profiles."+name, "%v", err)
+		}
+	}
+	return problems
+}
+
+// Load returns the config read by viper, with the defaults applied. It fails if a setting is invalid,
+// except for agent and profile settings, which Profile checks when a command starts an agent.
 func Load() (*Config, error) {
+	return load(viper.GetViper())
+}
+
+func load(v *viper.Viper) (*Config, error) {
 	var cfg Config
-	if err := viper.Unmarshal(&cfg); err != nil {
+	if err := v.Unmarshal(&cfg); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
+	for _, p := range cfg.Validate() {
+		if !isProfileProblem(p) {
+			return nil, fmt.Errorf("invalid config: %s (see git-replicator config validate)", p)
+		}
+	}
+	if cfg.DefaultHost == "" {
+		cfg.DefaultHost = DefaultHost
+	}
+	if cfg.DefaultProtocol == "" {
+		cfg.DefaultProtocol = DefaultProtocol
+	}
 	return &cfg, nil
 }
+
+// isProfileProblem reports whether p concerns the agent or a profile, which only matter to the commands starting an agent.
+func isProfileProblem(p Problem) bool {
+	return strings.HasPrefix(p.Key, "agent.") || strings.HasPrefix(p.Key, "profiles.")
+}
@@ -0,0 +1,228 @@
+package config_test
+
+import (
+	"maps"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/terakoya76/git-replicator/internal/config"
+)
+
+func TestProfileValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile config.Profile
+		wantErr string
+	}{
+		{name: "valid", profile: config.Profile{Command: "cursor {{.Dir}}", Env: []string{"A=b", "EMPTY="}, Workdir: config.WorkdirRepo}},
+		{name: "no command", profile: config.Profile{Command: " "}, wantErr: "command is required"},
+		{name: "bad template", profile: config.Profile{Command: "cursor {{.Dir"}, wantErr: "invalid command template"},
+		{name: "bad env", profile: config.Profile{Command: "claude", Env: []string{"A"}}, wantErr: `invalid env entry "A"`},
+		{name: "bad workdir", profile: config.Profile{Command: "claude", Workdir: "home"}, wantErr: `invalid workdir "home"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.profile.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProfileRender(t *testing.T) {
+	data := config.ProfileData{Name: "feature", Dir: "/r/feature", RepoDir: "/r", Branch: "feature", Task: "fix it"}
+
+	command, err := config.Profile{Command: `code {{.Dir}} --title "{{.Name}}: {{.Task}}"`}.Render(data)
+	assert.NoError(t, err)
+	assert.Equal(t, `code /r/feature --title "feature: fix it"`, command)
+
+	_, err = config.Profile{Command: "code {{.Unknown}}"}.Render(data)
+	assert.Error(t, err)
+
+	// Quoted values are passed to sh as a single word
+	tricky := config.ProfileData{Dir: "/r/my dir", Task: `it's "done"; rm -rf x`}
+	command, err = config.Profile{Command: `agent {{quote .Dir}} {{quote .Task}}`}.Render(tricky)
+	assert.NoError(t, err)
+	out, err := exec.Command("sh", "-c", `printf '%s\n' `+strings.TrimPrefix(command, "agent ")).Output()
+	assert.NoError(t, err)
+	assert.Equal(t, "/r/my dir\nit's \"done\"; rm -rf x\n", string(out))
+	assert.NoError(t, config.Profile{Command: "agent {{quote .Task}}"}.Validate())
+
+	assert.Equal(t, "/r/feature", config.Profile{}.WorkingDir(data))
+	assert.Equal(t, "/r", config.Profile{Workdir: config.WorkdirRepo}.WorkingDir(data))
+}
+
+func TestConfigProfile(t *testing.T) {
+	cfg := config.Config{
+		Agent: config.AgentConfig{Command: "claude"},
+		Profiles: map[string]config.Profile{
+			"cursor": {Command: "cursor {{.Dir}}"},
+			"broken": {Command: "x", Workdir: "nowhere"},
+		},
+	}
+
+	p, err := cfg.Profile("")
+	assert.NoError(t, err)
+	assert.Equal(t, config.Profile{Command: "claude"}, p)
+
+	p, err = cfg.Profile("cursor")
+	assert.NoError(t, err)
+	assert.Equal(t, "cursor {{.Dir}}", p.Command)
+
+	// Viper lowercases the profile names read from the config file
+	p, err = cfg.Profile("Cursor")
+	assert.NoError(t, err)
+	assert.Equal(t, "cursor {{.Dir}}", p.Command)
+
+	cfg.Agent.Profile = "cursor"
+	p, err = cfg.Profile("")
+	assert.NoError(t, err)
+	assert.Equal(t, "cursor {{.Dir}}", p.Command)
+
+	_, err = cfg.Profile("aider")
+	assert.ErrorContains(t, err, "available: broken, cursor")
+	_, err = cfg.Profile("broken")
+	assert.ErrorContains(t, err, `invalid profile "broken"`)
+	_, err = (&config.Config{}).Profile("")
+	assert.ErrorContains(t, err, "no agent configured")
+}
+
+func TestConfigRootDirs(t *testing.T) {
+	assert.Empty(t, (&config.Config{}).RootDirs())
+	assert.Equal(t, []string{"~/work"}, (&config.Config{Roots: []string{"~/work"}}).RootDirs())
+	cfg := config.Config{Root: "~/git-replicator", Roots: []string{"~/work", "/srv/oss"}}
+	assert.Equal(t, []string{"~/git-replicator", "~/work", "/srv/oss"}, cfg.RootDirs())
+}
+
+func TestConfigValidate(t *testing.T) {
+	valid := config.Config{
+		Roots:           []string{"~/work"},
+		DefaultHost:     "github.example.com",
+		DefaultProtocol: config.ProtocolSSH,
+		Clone:           config.CloneConfig{Depth: 1},
+		Auth:            config.AuthConfig{TokenEnv: "GITHUB_TOKEN"},
+		Repos:           []config.RepoConfig{{Match: "github.com/acme/*", Protocol: config.ProtocolHTTPS}},
+		Agent:           config.AgentConfig{Profile: "claude"},
+		Profiles:        map[string]config.Profile{"claude": {Command: "claude"}},
+	}
+	tests := []struct {
+		name   string
+		modify func(c *config.Config)
+		want   []string
+	}{
+		{name: "valid", modify: func(c *config.Config) {}},
+		{name: "empty root", modify: func(c *config.Config) { c.Roots = append(c.Roots, " ") }, want: []string{"roots[1]"}},
+		{name: "host with scheme", modify: func(c *config.Config) { c.DefaultHost = "https://github.com" }, want: []string{"default_host"}},
+		{name: "protocol", modify: func(c *config.Config) { c.DefaultProtocol = "git" }, want: []string{"default_protocol"}},
+		{name: "negative depth", modify: func(c *config.Config) { c.Clone.Depth = -1 }, want: []string{"clone.depth"}},
+		{name: "token env", modify: func(c *config.Config) { c.Auth.TokenEnv = "$TOKEN" }, want: []string{"auth.token_env"}},
+		{
+			name: "repos",
+			modify: func(c *config.Config) {
+				c.Repos = append(c.Repos, config.RepoConfig{Protocol: "ftp"}, config.RepoConfig{Match: "[", Clone: config.CloneConfig{Depth: -2}})
+			},
+			want: []string{"repos[1].match", "repos[1].protocol", "repos[2].match", "repos[2].clone.depth"},
+		},
+		{name: "unknown default profile", modify: func(c *config.Config) { c.Agent.Profile = "aider" }, want: []string{"agent.profile"}},
+		{name: "invalid profile", modify: func(c *config.Config) { c.Profiles["broken"] = config.Profile{} }, want: []string{"profiles.broken"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid
+			cfg.Roots = slices.Clone(valid.Roots)
+			cfg.Repos = slices.Clone(valid.Repos)
+			cfg.Profiles = maps.Clone(valid.Profiles)
+			tt.modify(&cfg)
+			var keys []string
+			for _, p := range cfg.Validate() {
+				keys = append(keys, p.Key)
+			}
+			assert.Equal(t, tt.want, keys)
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	// A broken profile only fails the commands using it
+	viper.Set("agent", map[string]any{"profile": "broken"})
+	viper.Set("profiles", map[string]any{"broken": map[string]any{"command": "{{"}})
+	cfg, err := config.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, config.DefaultHost, cfg.DefaultHost)
+	_, err = cfg.Profile("")
+	assert.ErrorContains(t, err, `invalid profile "broken"`)
+
+	viper.Set("clone", map[string]any{"depth": -1})
+	_, err = config.Load()
+	assert.ErrorContains(t, err, "clone.depth")
+}
+
+func TestConfigForRepo(t *testing.T) {
+	cfg := config.Config{
+		Clone: config.CloneConfig{Depth: 10},
+		Auth:  config.AuthConfig{TokenEnv: "GITHUB_TOKEN"},
+		Hooks: config.HooksConfig{PostSwitch: "make setup"},
+		Repos: []config.RepoConfig{
+			{Match: "github.example.com/*/*", Protocol: config.ProtocolSSH, Auth: config.AuthConfig{SSHKey: "~/.ssh/work"}},
+			{Match: "github.example.com/team/monorepo", Clone: config.CloneConfig{Depth: 1, SingleBranch: true}},
+		},
+	}
+
+	assert.Equal(t, config.RepoSettings{
+		Protocol: config.ProtocolHTTPS,
+		Clone:    cfg.Clone,
+		Auth:     cfg.Auth,
+		Hooks:    cfg.Hooks,
+	}, cfg.ForRepo("github.com/owner/repo"))
+
+	assert.Equal(t, config.RepoSettings{
+		Protocol: config.ProtocolSSH,
+		Clone:    config.CloneConfig{Depth: 1, SingleBranch: true},
+		Auth:     config.AuthConfig{SSHKey: "~/.ssh/work"},
+		Hooks:    cfg.Hooks,
+	}, cfg.ForRepo("GitHub.example.com/team/monorepo"))
+}
+
+func TestConfigExpandRepoURL(t *testing.T) {
+	cfg := config.Config{
+		DefaultHost: "gitlab.com",
+		Repos:       []config.RepoConfig{{Match: "github.example.com/*/*", Protocol: config.ProtocolSSH}},
+	}
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr bool
+	}{
+		{ref: "https://github.com/owner/repo", want: "https://github.com/owner/repo"},
+		{ref: "git@github.com:owner/repo.git", want: "git@github.com:owner/repo.git"},
+		{ref: "owner/repo", want: "https://gitlab.com/owner/repo.git"},
+		{ref: "github.example.com/team/service.git", want: "git@github.example.com:team/service.git"},
+		{ref: "repo", wantErr: true},
+		{ref: "a/b/c/d", wantErr: true},
+		{ref: "owner//repo", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			got, err := cfg.ExpandRepoURL(tt.ref)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	got, err := (&config.Config{}).ExpandRepoURL("owner/repo")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://github.com/owner/repo.git", got)
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Template is the config file written by Init. It sets the defaults and shows the other settings commented out.
+const Template = `# git-replicator config file, see "git-replicator config validate"
+
+# Primary directory repositories are cloned into ($GIT_REPLICATOR_ROOT overrides it)
+# root: ~/git-replicator
+# Further directories holding repositories, listed by list and daemon
+# roots:
+#   - ~/work
+
+# Completes "get owner/repo" and builds the URLs replicas are cloned from (https or ssh)
+default_host: github.com
+default_protocol: https
+
+clone:
+  # Fetch only this many commits of history (0 fetches all of it)
+  depth: 0
+  single_branch: false
+  recurse_submodules: false
+
+# Credentials used to clone. Without any, HTTPS is anonymous and SSH uses the SSH agent.
+# auth:
+#   username: git
+#   token_env: GITHUB_TOKEN
+#   ssh_key: ~/.ssh/id_ed25519
+
+# Shell commands run with sh -c, with the branch directory name in $GIT_REPLICATOR_REPLICA
+# hooks:
+#   post_get: make setup      # in base after get
+#   post_switch: npm ci       # in each new replica
+
+# Overrides for the repositories matching a host/owner/repo glob, applied in order
+# repos:
+#   - match: github.example.com/*/*
+#     protocol: ssh
+#     clone:
+#       depth: 1
+
+# agent:
+#   command: claude
+#   profile: claude
+# profiles:
+#   claude:
+#     command: claude
+#     env: ["CLAUDE_CONFIG_DIR=/home/me/.claude-agents"]
+#   cursor:
+#     command: cursor {{quote .Dir}}
+#     workdir: repo
+`
+
+// Init writes Template to path. It refuses to replace an existing file unless force is set.
+func Init(path string, force bool) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	f, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("config file %s already exists (use --force to overwrite)", path)
+		}
+		return fmt.Errorf("failed to create config file: %w", err)
+	}
+	if _, err := f.WriteString(Template); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
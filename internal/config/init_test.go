@@ -0,0 +1,36 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/terakoya76/git-replicator/internal/config"
+)
+
+func TestInit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "home", ".git-replicator.yaml")
+	assert.NoError(t, config.Init(path, false))
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, config.Template, string(data))
+
+	// The template is a valid config file
+	problems, err := config.Check(path)
+	assert.NoError(t, err)
+	assert.Empty(t, problems)
+
+	if err := os.WriteFile(path, []byte("root: ~/src\n"), 0o644); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+	assert.ErrorContains(t, config.Init(path, false), "already exists")
+	data, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "root: ~/src\n", string(data))
+
+	assert.NoError(t, config.Init(path, true))
+	data, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, config.Template, string(data))
+}
@@ -4,9 +4,14 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/terakoya76/git-replicator/internal/utils"
 )
 
-// ListBranchDirs returns a list of branch directory names under the given repoDir (including 'base').
+// ListBranchDirs returns a list of branch directory names under the given repoDir (including 'base'), skipping hidden directories.
 func ListBranchDirs(ctx context.Context, repoDir string) ([]string, error) {
 	entries, err := os.ReadDir(repoDir)
 	if err != nil {
@@ -14,9 +19,69 @@ func ListBranchDirs(ctx context.Context, repoDir string) ([]string, error) {
 	}
 	var branches []string
 	for _, entry := range entries {
-		if entry.IsDir() {
+		// Skip hidden directories such as the task queue state
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
 			branches = append(branches, entry.Name())
 		}
 	}
 	return branches, nil
 }
+
+// listReplicas returns the branch directory names under repoDir, excluding base and directories that are not checkouts of the repository.
+func listReplicas(ctx context.Context, repoDir string) ([]string, error) {
+	branches, err := ListBranchDirs(ctx, repoDir)
+	if err != nil {
+		return nil, err
+	}
+	var replicas []string
+	for _, branch := range branches {
+		if branch == utils.BaseDirName {
+			continue
+		}
+		if err := utils.VerifyCheckout(filepath.Join(repoDir, branch), repoDir); err != nil {
+			continue
+		}
+		replicas = append(replicas, branch)
+	}
+	return replicas, nil
+}
+
+// BranchDirInfo describes a branch directory of a repository.
+type BranchDirInfo struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	// Branch is the branch checked out in the directory, empty when HEAD is detached or the directory is not a git checkout.
+	Branch string `json:"branch"`
+	// Head is the commit checked out in the directory.
+	Head   string `json:"head"`
+	IsBase bool   `json:"is_base"`
+	ReplicaMetadata
+}
+
+// DescribeBranchDirs returns the branch directories under repoDir (including base) with the branch and commit checked out in each.
+func DescribeBranchDirs(ctx context.Context, repoDir string) ([]BranchDirInfo, error) {
+	names, err := ListBranchDirs(ctx, repoDir)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]BranchDirInfo, 0, len(names))
+	for _, name := range names {
+		info := BranchDirInfo{
+			Name:   name,
+			Path:   filepath.Join(repoDir, name),
+			IsBase: name == utils.BaseDirName,
+		}
+		if repo, err := git.PlainOpen(info.Path); err == nil {
+			if head, err := repo.Head(); err == nil {
+				info.Head = head.Hash().String()
+				if head.Name().IsBranch() {
+					info.Branch = head.Name().Short()
+				}
+			}
+		}
+		// Directories without readable metadata are listed all the same
+		info.ReplicaMetadata, _ = ReadMetadata(info.Path)
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/terakoya76/git-replicator/internal/handlers"
 )
 
@@ -49,3 +50,24 @@ func TestListBranchDirs(t *testing.T) {
 		}
 	})
 }
+
+func TestDescribeBranchDirs(t *testing.T) {
+	origin := newTestOrigin(t)
+	repoDir := filepath.Join(t.TempDir(), "github.com", "owner", "repo")
+	repo := cloneTestRepo(t, origin, filepath.Join(repoDir, "base"))
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatalf("failed to get HEAD: %v", err)
+	}
+	// A directory that is not a checkout has no branch or head
+	if err := os.Mkdir(filepath.Join(repoDir, "scratch"), 0o755); err != nil {
+		t.Fatalf("failed to create scratch dir: %v", err)
+	}
+
+	infos, err := handlers.DescribeBranchDirs(context.Background(), repoDir)
+	assert.NoError(t, err)
+	assert.Equal(t, []handlers.BranchDirInfo{
+		{Name: "base", Path: filepath.Join(repoDir, "base"), Branch: "main", Head: head.Hash().String(), IsBase: true},
+		{Name: "scratch", Path: filepath.Join(repoDir, "scratch")},
+	}, infos)
+}
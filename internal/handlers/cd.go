@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+// ResolveBranchDir returns the path of an existing branch directory under the given repoDir.
+func ResolveBranchDir(ctx context.Context, repoDir, branchName string) (string, error) {
+	branchDir, err := utils.ResolveReplicaDir(repoDir, branchName)
+	if err != nil {
+		return "", err
+	}
+	stat, err := os.Stat(branchDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("branch directory does not exist: %s", branchDir)
+		}
+		return "", fmt.Errorf("failed to stat branch directory %s: %w", branchDir, err)
+	}
+	if !stat.IsDir() {
+		return "", fmt.Errorf("not a directory: %s", branchDir)
+	}
+	return branchDir, nil
+}
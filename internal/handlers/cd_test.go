@@ -0,0 +1,62 @@
+package handlers_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+)
+
+func TestResolveBranchDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	repoDir := filepath.Join(tmpDir, "repo")
+	if err := os.MkdirAll(filepath.Join(repoDir, "feature-x"), 0o755); err != nil {
+		t.Fatalf("failed to create branch dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repoDir, "file.txt"), []byte("data"), 0o644); err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		branch  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "existing branch dir",
+			branch: "feature-x",
+			want:   filepath.Join(repoDir, "feature-x"),
+		},
+		{
+			name:    "non-existent branch dir",
+			branch:  "nonexistent",
+			wantErr: true,
+		},
+		{
+			name:    "file instead of directory",
+			branch:  "file.txt",
+			wantErr: true,
+		},
+		{
+			name:    "empty branch name",
+			branch:  "",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := handlers.ResolveBranchDir(context.Background(), repoDir, tt.branch)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+const (
+	CollectFormatPatch  = "patch"
+	CollectFormatBundle = "bundle"
+)
+
+// CollectFormats lists the supported export formats.
+var CollectFormats = []string{CollectFormatPatch, CollectFormatBundle}
+
+const (
+	TestStatusPassed = "passed"
+	TestStatusFailed = "failed"
+)
+
+// CollectIndexFile is the name of the index written to the output directory.
+const CollectIndexFile = "index.json"
+
+type CollectOptions struct {
+	RepoDir string
+	// Replicas are the branch directory names to export. All exports every replica instead.
+	Replicas []string
+	All      bool
+	OutDir   string
+	Format   string
+	// TestCommand, if set, is run with sh -c in each replica and its outcome recorded as the test status.
+	TestCommand string
+}
+
+// CollectEntry describes the work of a replica relative to base and where it was exported to.
+type CollectEntry struct {
+	Name   string `json:"name"`
+	Branch string `json:"branch"`
+	Head   string `json:"head"`
+	// Base is the HEAD of base the work was exported relative to.
+	Base    string `json:"base"`
+	Commits int    `json:"commits"`
+	Files   int    `json:"files"`
+	Added   int    `json:"added"`
+	Deleted int    `json:"deleted"`
+	// Uncommitted counts modified and untracked files, which are not part of the export.
+	Uncommitted int `json:"uncommitted,omitempty"`
+	// Output is the patch directory or bundle file relative to the output directory, empty without commits.
+	Output     string `json:"output,omitempty"`
+	TestStatus string `json:"test_status,omitempty"`
+	TestLog    string `json:"test_log,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// CollectIndex is written to CollectIndexFile in the output directory.
+type CollectIndex struct {
+	RepoDir     string         `json:"repo_dir"`
+	Format      string         `json:"format"`
+	CollectedAt time.Time      `json:"collected_at"`
+	Entries     []CollectEntry `json:"entries"`
+}
+
+// Collect exports the commits of each selected replica that are not in base into opts.OutDir, as a patch series in <name>/
+// or as a git bundle <name>.bundle, and writes an index of the exports. Failures of a single replica are reported in its entry.
+func Collect(ctx context.Context, opts CollectOptions) (CollectIndex, error) {
+	index := CollectIndex{RepoDir: opts.RepoDir, Format: opts.Format, CollectedAt: time.Now()}
+	if opts.Format != CollectFormatPatch && opts.Format != CollectFormatBundle {
+		return index, fmt.Errorf("unsupported format: %s", opts.Format)
+	}
+	if opts.OutDir == "" {
+		return index, fmt.Errorf("output directory is required")
+	}
+	names := opts.Replicas
+	if opts.All {
+		var err error
+		if names, err = listReplicas(ctx, opts.RepoDir); err != nil {
+			return index, err
+		}
+	} else if len(names) == 0 {
+		return index, fmt.Errorf("no replicas to collect")
+	}
+	dirs := make([]string, len(names))
+	for i, name := range names {
+		dir, err := resolveExistingReplica(opts.RepoDir, name, false)
+		if err != nil {
+			return index, err
+		}
+		dirs[i] = dir
+	}
+	baseDir := filepath.Join(opts.RepoDir, utils.BaseDirName)
+	baseHead, err := headHash(baseDir)
+	if err != nil {
+		return index, err
+	}
+	if err := os.MkdirAll(opts.OutDir, 0o755); err != nil {
+		return index, fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	for i, name := range names {
+		entry := CollectEntry{Name: name, Base: baseHead}
+		if err := collectReplica(ctx, &entry, dirs[i], baseDir, opts); err != nil {
+			entry.Error = err.Error()
+		}
+		index.Entries = append(index.Entries, entry)
+	}
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return index, fmt.Errorf("failed to encode index: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(opts.OutDir, CollectIndexFile), data, 0o644); err != nil {
+		return index, fmt.Errorf("failed to write index: %w", err)
+	}
+	return index, nil
+}
+
+// collectReplica exports the replica at dir and fills entry.
+func collectReplica(ctx context.Context, entry *CollectEntry, dir, baseDir string, opts CollectOptions) error {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open repo: %w", err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return fmt.Errorf("failed to get HEAD: %w", err)
+	}
+	entry.Head = head.Hash().String()
+	tip := "HEAD"
+	if head.Name().IsBranch() {
+		entry.Branch = head.Name().Short()
+		tip = head.Name().String()
+	}
+
+	// Make the objects of base available, so that the HEAD of base can be used even if the replica never fetched it
+	env := utils.AlternateObjectsEnv(baseDir)
+	commits, err := logRange(ctx, dir, env, entry.Base, entry.Head)
+	if err != nil {
+		return err
+	}
+	entry.Commits = len(commits)
+	numstat, err := utils.RunGitEnv(ctx, dir, env, "-c", "core.quotePath=false", "diff", "--no-renames", "--numstat", entry.Base+"..."+entry.Head)
+	if err != nil {
+		return err
+	}
+	files, err := parseNumstat(numstat)
+	if err != nil {
+		return err
+	}
+	entry.Files = len(files)
+	for _, f := range files {
+		entry.Added += f.Added
+		entry.Deleted += f.Deleted
+	}
+	state, err := utils.InspectWorkState(ctx, dir)
+	if err != nil {
+		return err
+	}
+	entry.Uncommitted = len(state.Modified) + len(state.Untracked)
+
+	if opts.TestCommand != "" {
+		if err := runCollectTest(ctx, entry, dir, opts); err != nil {
+			return err
+		}
+	}
+
+	if entry.Commits == 0 {
+		return nil
+	}
+	switch opts.Format {
+	case CollectFormatPatch:
+		entry.Output = entry.Name
+		out := filepath.Join(opts.OutDir, entry.Output)
+		if err := os.RemoveAll(out); err != nil {
+			return fmt.Errorf("failed to clean %s: %w", out, err)
+		}
+		_, err = utils.RunGitEnv(ctx, dir, env, "format-patch", "--quiet", "--no-color", "-o", out, entry.Base+".."+entry.Head)
+	case CollectFormatBundle:
+		entry.Output = entry.Name + ".bundle"
+		_, err = utils.RunGitEnv(ctx, dir, env, "bundle", "create", "--quiet", filepath.Join(opts.OutDir, entry.Output), tip, "^"+entry.Base)
+	}
+	return err
+}
+
+// runCollectTest runs opts.TestCommand in dir, saving its output next to the export.
+func runCollectTest(ctx context.Context, entry *CollectEntry, dir string, opts CollectOptions) error {
+	entry.TestLog = entry.Name + ".test.log"
+	log, err := os.Create(filepath.Join(opts.OutDir, entry.TestLog))
+	if err != nil {
+		return fmt.Errorf("failed to create test log: %w", err)
+	}
+	defer log.Close()
+	cmd := exec.CommandContext(ctx, "sh", "-c", opts.TestCommand)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), ExecReplicaEnv+"="+entry.Name)
+	cmd.Stdout = log
+	cmd.Stderr = log
+	entry.TestStatus = TestStatusPassed
+	if err := cmd.Run(); err != nil {
+		entry.TestStatus = TestStatusFailed
+	}
+	return nil
+}
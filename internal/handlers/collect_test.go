@@ -0,0 +1,113 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+func TestCollect(t *testing.T) {
+	setTestGitIdentity(t)
+	origin := newTestOrigin(t)
+	repoDir := filepath.Join(t.TempDir(), "github.com", "owner", "repo")
+	for _, branch := range []string{"base", "agent-1", "agent-2"} {
+		dir := filepath.Join(repoDir, branch)
+		repo := cloneTestRepo(t, origin, dir)
+		setTestRemoteURL(t, dir, "https://github.com/owner/repo.git")
+		if branch != "base" {
+			head, err := repo.Head()
+			if err != nil {
+				t.Fatalf("failed to get HEAD: %v", err)
+			}
+			checkoutTestBranch(t, dir, branch, head.Hash())
+		}
+	}
+	agent1 := filepath.Join(repoDir, "agent-1")
+	commitTestFile(t, agent1, "a.txt", "a\nb\n")
+	commitTestFile(t, agent1, "b.txt", "c\n")
+	writeTestFile(t, filepath.Join(repoDir, "agent-2", "wip.txt"), "wip\n")
+	// Base moving on must not show up as work of the replicas
+	commitTestFile(t, filepath.Join(repoDir, "base"), "base.txt", "base\n")
+
+	byName := func(index handlers.CollectIndex) map[string]handlers.CollectEntry {
+		entries := map[string]handlers.CollectEntry{}
+		for _, e := range index.Entries {
+			entries[e.Name] = e
+		}
+		return entries
+	}
+
+	t.Run("patch", func(t *testing.T) {
+		outDir := t.TempDir()
+		index, err := handlers.Collect(context.Background(), handlers.CollectOptions{
+			RepoDir:     repoDir,
+			All:         true,
+			OutDir:      outDir,
+			Format:      handlers.CollectFormatPatch,
+			TestCommand: `[ "$GIT_REPLICATOR_REPLICA" = agent-1 ]`,
+		})
+		assert.NoError(t, err)
+		entries := byName(index)
+		assert.Len(t, entries, 2)
+
+		e := entries["agent-1"]
+		assert.Empty(t, e.Error)
+		assert.Equal(t, "agent-1", e.Branch)
+		assert.Equal(t, 2, e.Commits)
+		assert.Equal(t, 2, e.Files)
+		assert.Equal(t, 3, e.Added)
+		assert.Equal(t, handlers.TestStatusPassed, e.TestStatus)
+		patches, err := filepath.Glob(filepath.Join(outDir, e.Output, "*.patch"))
+		assert.NoError(t, err)
+		assert.Len(t, patches, 2)
+
+		e = entries["agent-2"]
+		assert.Empty(t, e.Error)
+		assert.Equal(t, 0, e.Commits)
+		assert.Equal(t, 1, e.Uncommitted)
+		assert.Empty(t, e.Output)
+		assert.Equal(t, handlers.TestStatusFailed, e.TestStatus)
+		assert.FileExists(t, filepath.Join(outDir, e.TestLog))
+
+		data, err := os.ReadFile(filepath.Join(outDir, handlers.CollectIndexFile))
+		assert.NoError(t, err)
+		var written handlers.CollectIndex
+		assert.NoError(t, json.Unmarshal(data, &written))
+		assert.Equal(t, index.Entries, written.Entries)
+	})
+
+	t.Run("bundle", func(t *testing.T) {
+		outDir := t.TempDir()
+		index, err := handlers.Collect(context.Background(), handlers.CollectOptions{
+			RepoDir:  repoDir,
+			Replicas: []string{"agent-1"},
+			OutDir:   outDir,
+			Format:   handlers.CollectFormatBundle,
+		})
+		assert.NoError(t, err)
+		if !assert.Len(t, index.Entries, 1) {
+			return
+		}
+		e := index.Entries[0]
+		assert.Empty(t, e.Error)
+		assert.Empty(t, e.TestStatus)
+		bundle := filepath.Join(outDir, e.Output)
+		_, err = utils.RunGit(context.Background(), filepath.Join(repoDir, "base"), "bundle", "verify", "--quiet", bundle)
+		assert.NoError(t, err)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := handlers.Collect(context.Background(), handlers.CollectOptions{RepoDir: repoDir, All: true, OutDir: t.TempDir(), Format: "zip"})
+		assert.Error(t, err)
+		_, err = handlers.Collect(context.Background(), handlers.CollectOptions{RepoDir: repoDir, OutDir: t.TempDir(), Format: handlers.CollectFormatPatch})
+		assert.Error(t, err)
+		_, err = handlers.Collect(context.Background(), handlers.CollectOptions{RepoDir: repoDir, Replicas: []string{"base"}, OutDir: t.TempDir(), Format: handlers.CollectFormatPatch})
+		assert.Error(t, err)
+	})
+}
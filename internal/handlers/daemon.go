@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// StateDirName is the directory under the git-replicator root where git-replicator keeps its own state.
+const StateDirName = ".git-replicator"
+
+const daemonStatusFile = "daemon-status.json"
+
+// DaemonStatusPath returns the path of the status file the daemon writes under rootDir.
+func DaemonStatusPath(rootDir string) string {
+	return filepath.Join(rootDir, StateDirName, daemonStatusFile)
+}
+
+type DaemonOptions struct {
+	// GitReplicatorRoot is the primary root, where the status file is written.
+	GitReplicatorRoot string
+	// Roots are the roots whose repositories are synced. When empty, only GitReplicatorRoot is synced.
+	Roots []string
+	// Interval is the time between the start of two syncs.
+	Interval time.Duration
+	// Jobs and Timeout limit the fetches of a sync like FetchOptions.
+	Jobs    int
+	Timeout time.Duration
+	// Once runs a single sync and returns.
+	Once bool
+}
+
+// DaemonStatus is written to the status file after every sync.
+type DaemonStatus struct {
+	PID       int              `json:"pid"`
+	StartedAt time.Time        `json:"started_at"`
+	LastRunAt time.Time        `json:"last_run_at"`
+	NextRunAt time.Time        `json:"next_run_at,omitzero"`
+	Repos     []RepoSyncStatus `json:"repos"`
+}
+
+// RepoSyncStatus is the sync state of the base of a repository.
+type RepoSyncStatus struct {
+	Dir           string        `json:"dir"`
+	LastAttemptAt time.Time     `json:"last_attempt_at"`
+	LastSuccessAt time.Time     `json:"last_success_at,omitzero"`
+	Duration      time.Duration `json:"duration"`
+	Error         string        `json:"error,omitempty"`
+}
+
+// RunDaemon fetches origin in the base of every repository under opts.Roots every opts.Interval until ctx is canceled,
+// writing the result of each sync to the status file. Repositories added while it runs are picked up by the next sync.
+func RunDaemon(ctx context.Context, opts DaemonOptions, fetchFunc FetchFunc) error {
+	if !opts.Once && opts.Interval <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+	status := DaemonStatus{PID: os.Getpid(), StartedAt: time.Now()}
+	var tick <-chan time.Time
+	if !opts.Once {
+		ticker := time.NewTicker(opts.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		var err error
+		if status, err = SyncRepos(ctx, opts, status, time.Now(), fetchFunc); err != nil {
+			// Keep running, the next sync may succeed
+			slog.Error("sync failed", "err", err)
+		}
+		if !opts.Once {
+			status.NextRunAt = time.Now().Add(opts.Interval)
+		}
+		if err := WriteDaemonStatus(opts.GitReplicatorRoot, status); err != nil {
+			slog.Error("failed to write status", "err", err)
+		}
+		if opts.Once {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-tick:
+		}
+	}
+}
+
+// SyncRepos fetches origin in the base of every repository under opts.Roots and returns prev updated with the results.
+// Only the remote-tracking branches of base move; its checked out branch is left for Update.
+func SyncRepos(ctx context.Context, opts DaemonOptions, prev DaemonStatus, now time.Time, fetchFunc FetchFunc) (DaemonStatus, error) {
+	status := prev
+	status.LastRunAt = now
+	roots := opts.Roots
+	if len(roots) == 0 {
+		roots = []string{opts.GitReplicatorRoot}
+	}
+	var repoDirs []string
+	for _, root := range roots {
+		repos, err := List(ctx, root)
+		if err != nil {
+			return status, err
+		}
+		for _, repo := range repos {
+			repoDirs = append(repoDirs, filepath.Dir(repo.Path))
+		}
+	}
+	results, err := FetchAll(ctx, FetchOptions{RepoDirs: repoDirs, BaseOnly: true, Jobs: opts.Jobs, Timeout: opts.Timeout}, fetchFunc)
+	if err != nil {
+		return status, err
+	}
+
+	lastSuccess := map[string]time.Time{}
+	for _, r := range prev.Repos {
+		lastSuccess[r.Dir] = r.LastSuccessAt
+	}
+	status.Repos = make([]RepoSyncStatus, 0, len(results))
+	for _, r := range results {
+		s := RepoSyncStatus{Dir: r.RepoDir, LastAttemptAt: now, LastSuccessAt: lastSuccess[r.RepoDir], Duration: r.Duration, Error: r.Error}
+		if r.Error == "" {
+			s.LastSuccessAt = now
+			slog.Debug("fetched", "repo", r.RepoDir, "duration", r.Duration)
+		} else {
+			slog.Warn("fetch failed", "repo", r.RepoDir, "err", r.Error)
+		}
+		status.Repos = append(status.Repos, s)
+	}
+	return status, nil
+}
+
+// WriteDaemonStatus atomically replaces the status file under rootDir with status.
+func WriteDaemonStatus(rootDir string, status DaemonStatus) error {
+	path := DaemonStatusPath(rootDir)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	data, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode daemon status: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write daemon status: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write daemon status: %w", err)
+	}
+	return nil
+}
+
+// ReadDaemonStatus reads the status file under rootDir.
+func ReadDaemonStatus(rootDir string) (DaemonStatus, error) {
+	var status DaemonStatus
+	data, err := os.ReadFile(DaemonStatusPath(rootDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return status, fmt.Errorf("no daemon status found at %s: is the daemon running?", DaemonStatusPath(rootDir))
+		}
+		return status, fmt.Errorf("failed to read daemon status: %w", err)
+	}
+	if err := json.Unmarshal(data, &status); err != nil {
+		return status, fmt.Errorf("failed to decode daemon status: %w", err)
+	}
+	return status, nil
+}
@@ -0,0 +1,118 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+)
+
+func TestSyncRepos(t *testing.T) {
+	rootDir := t.TempDir()
+	good := filepath.Join(rootDir, "github.com", "owner", "good")
+	bad := filepath.Join(rootDir, "github.com", "owner", "bad")
+	for _, repoDir := range []string{good, bad} {
+		if err := os.MkdirAll(filepath.Join(repoDir, "base", ".git"), 0o755); err != nil {
+			t.Fatalf("failed to create %s: %v", repoDir, err)
+		}
+	}
+	fetchFunc := func(ctx context.Context, dir string) error {
+		if filepath.Dir(dir) == bad {
+			return errors.New("network down")
+		}
+		return nil
+	}
+
+	earlier := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := earlier.Add(time.Hour)
+	prev := handlers.DaemonStatus{PID: 42, Repos: []handlers.RepoSyncStatus{{Dir: bad, LastAttemptAt: earlier, LastSuccessAt: earlier}}}
+	status, err := handlers.SyncRepos(context.Background(), handlers.DaemonOptions{GitReplicatorRoot: rootDir, Jobs: 2}, prev, now, fetchFunc)
+	assert.NoError(t, err)
+	assert.Equal(t, 42, status.PID)
+	assert.Equal(t, now, status.LastRunAt)
+	if assert.Len(t, status.Repos, 2) {
+		// The failed repository keeps its last success
+		assert.Equal(t, bad, status.Repos[0].Dir)
+		assert.Equal(t, now, status.Repos[0].LastAttemptAt)
+		assert.Equal(t, earlier, status.Repos[0].LastSuccessAt)
+		assert.Equal(t, "network down", status.Repos[0].Error)
+		assert.Equal(t, good, status.Repos[1].Dir)
+		assert.Equal(t, now, status.Repos[1].LastSuccessAt)
+		assert.Empty(t, status.Repos[1].Error)
+	}
+
+	_, err = handlers.SyncRepos(context.Background(), handlers.DaemonOptions{GitReplicatorRoot: filepath.Join(rootDir, "missing")}, prev, now, fetchFunc)
+	assert.Error(t, err)
+
+	// Every root is synced
+	otherRoot := t.TempDir()
+	other := filepath.Join(otherRoot, "gitlab.com", "owner", "other")
+	if err := os.MkdirAll(filepath.Join(other, "base", ".git"), 0o755); err != nil {
+		t.Fatalf("failed to create %s: %v", other, err)
+	}
+	status, err = handlers.SyncRepos(context.Background(), handlers.DaemonOptions{GitReplicatorRoot: rootDir, Roots: []string{rootDir, otherRoot}}, handlers.DaemonStatus{}, now, fetchFunc)
+	assert.NoError(t, err)
+	var dirs []string
+	for _, r := range status.Repos {
+		dirs = append(dirs, r.Dir)
+	}
+	assert.Equal(t, []string{bad, good, other}, dirs)
+}
+
+func TestRunDaemon(t *testing.T) {
+	rootDir := t.TempDir()
+	repoDir := filepath.Join(rootDir, "github.com", "owner", "repo")
+	if err := os.MkdirAll(filepath.Join(repoDir, "base", ".git"), 0o755); err != nil {
+		t.Fatalf("failed to create %s: %v", repoDir, err)
+	}
+	var fetches atomic.Int32
+	fetchFunc := func(ctx context.Context, dir string) error {
+		fetches.Add(1)
+		return nil
+	}
+
+	t.Run("no status yet", func(t *testing.T) {
+		_, err := handlers.ReadDaemonStatus(rootDir)
+		assert.Error(t, err)
+	})
+
+	t.Run("once", func(t *testing.T) {
+		fetches.Store(0)
+		err := handlers.RunDaemon(context.Background(), handlers.DaemonOptions{GitReplicatorRoot: rootDir, Once: true}, fetchFunc)
+		assert.NoError(t, err)
+		assert.Equal(t, int32(1), fetches.Load())
+		status, err := handlers.ReadDaemonStatus(rootDir)
+		assert.NoError(t, err)
+		assert.Equal(t, os.Getpid(), status.PID)
+		assert.True(t, status.NextRunAt.IsZero())
+		if assert.Len(t, status.Repos, 1) {
+			assert.Equal(t, repoDir, status.Repos[0].Dir)
+			assert.False(t, status.Repos[0].LastSuccessAt.IsZero())
+		}
+	})
+
+	t.Run("until canceled", func(t *testing.T) {
+		fetches.Store(0)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() {
+			done <- handlers.RunDaemon(ctx, handlers.DaemonOptions{GitReplicatorRoot: rootDir, Interval: 10 * time.Millisecond}, fetchFunc)
+		}()
+		assert.Eventually(t, func() bool { return fetches.Load() >= 3 }, 5*time.Second, 5*time.Millisecond)
+		cancel()
+		assert.NoError(t, <-done)
+		status, err := handlers.ReadDaemonStatus(rootDir)
+		assert.NoError(t, err)
+		assert.False(t, status.NextRunAt.IsZero())
+	})
+
+	t.Run("invalid interval", func(t *testing.T) {
+		assert.Error(t, handlers.RunDaemon(context.Background(), handlers.DaemonOptions{GitReplicatorRoot: rootDir}, fetchFunc))
+	})
+}
@@ -3,16 +3,102 @@ package handlers
 import (
 	"context"
 	"fmt"
+	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/terakoya76/git-replicator/internal/utils"
 )
 
+type DeleteOptions struct {
+	GitReplicatorRoot string
+	RepoDir           string
+	BranchName        string
+	// Force skips the safety checks for uncommitted, stashed and unpushed work and for leases of other owners.
+	Force bool
+	// Owner is the lease owner deleting the directory; replicas leased by anyone else are refused.
+	Owner string
+	// AllowBase allows deleting the base directory holding the canonical clone.
+	AllowBase bool
+	// Permanent removes the directory instead of moving it to the trash.
+	Permanent bool
+}
+
+// UnsafeDeleteError is returned when deleting a branch directory would lose work.
+type UnsafeDeleteError struct {
+	Dir   string
+	State utils.WorkState
+}
+
+func (e *UnsafeDeleteError) Error() string {
+	return fmt.Sprintf("refusing to delete %s: work would be lost (use --force to delete anyway)\n%s", e.Dir, e.State.Report())
+}
+
 // DeleteBranchDir deletes the branch directory under the given repo for a branch name.
-func DeleteBranchDir(ctx context.Context, repoDir, branchName string) error {
-	branchDir := filepath.Join(repoDir, branchName)
+// The directory is moved to $root/.trash so that it can be restored, unless opts.Permanent is set.
+// The directory must be a direct child of opts.RepoDir and a git checkout of the same repository; base is protected unless opts.AllowBase is set.
+// Unless opts.Force is set, it refuses to delete a checkout leased by another owner or with uncommitted changes, stashes or commits not on any remote.
+func DeleteBranchDir(ctx context.Context, opts DeleteOptions) error {
+	branchDir, err := resolveExistingReplica(opts.RepoDir, opts.BranchName, opts.AllowBase)
+	if err != nil {
+		return err
+	}
+	if !opts.Force {
+		if err := checkLease(branchDir, opts.Owner, time.Now()); err != nil {
+			return fmt.Errorf("refusing to delete: %w (use --force to delete anyway)", err)
+		}
+		if err := checkSafeToDelete(ctx, branchDir); err != nil {
+			return err
+		}
+	}
+	if !opts.Permanent {
+		entry, err := moveToTrash(opts.GitReplicatorRoot, opts.RepoDir, opts.BranchName, branchDir, time.Now())
+		if err != nil {
+			return err
+		}
+		// Mark the metadata kept with the directory in the trash only once it is there, so that a failed move leaves it untouched
+		trashed := filepath.Join(entry.Path, trashReplicaDir)
+		markDeleted := func(meta *ReplicaMetadata) { meta.Status = MetadataStatusDeleted }
+		if err := UpdateMetadata(trashed, time.Now(), markDeleted); err != nil {
+			return fmt.Errorf("moved %s to trash but failed to update metadata: %w", branchDir, err)
+		}
+		return nil
+	}
 	if err := utils.RemoveDir(branchDir); err != nil {
 		return fmt.Errorf("failed to delete branch directory %s: %w", branchDir, err)
 	}
 	return nil
 }
+
+// resolveExistingReplica returns the path of an existing replica directory of repoDir, verifying that it is a git checkout of the same repository.
+func resolveExistingReplica(repoDir, name string, allowBase bool) (string, error) {
+	if name == utils.BaseDirName && !allowBase {
+		return "", fmt.Errorf("refusing to operate on %q: it holds the canonical clone (use --allow-base to override)", name)
+	}
+	dir, err := utils.ResolveReplicaDir(repoDir, name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(dir); err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("branch directory does not exist: %s", dir)
+		}
+		return "", fmt.Errorf("failed to stat branch directory %s: %w", dir, err)
+	}
+	if err := utils.VerifyCheckout(dir, repoDir); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// checkSafeToDelete returns an *UnsafeDeleteError if removing the git checkout at dir would lose work.
+func checkSafeToDelete(ctx context.Context, dir string) error {
+	state, err := utils.InspectWorkState(ctx, dir)
+	if err != nil {
+		return fmt.Errorf("failed to inspect %s (use --force to delete anyway): %w", dir, err)
+	}
+	if !state.Clean() {
+		return &UnsafeDeleteError{Dir: dir, State: state}
+	}
+	return nil
+}
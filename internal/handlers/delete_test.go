@@ -6,36 +6,35 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/terakoya76/git-replicator/internal/handlers"
 )
 
 func TestDeleteBranchDir(t *testing.T) {
 	tmpDir := t.TempDir()
-	repoDir := filepath.Join(tmpDir, "repo")
+	origin := newTestOrigin(t)
+	repoDir := filepath.Join(tmpDir, "github.com", "owner", "repo")
 	branchName := "feature-x"
 	branchDir := filepath.Join(repoDir, branchName)
+	otherRepoDir := filepath.Join(tmpDir, "github.com", "owner", "other")
 
 	tests := []struct {
 		name       string
 		branch     string
+		allowBase  bool
 		prepare    func()
 		wantErr    bool
-		checkAfter func(branchDir string) error
+		checkAfter func() error
 	}{
 		{
 			name:   "delete existing branch dir",
 			branch: branchName,
 			prepare: func() {
-				if err := os.MkdirAll(branchDir, 0o755); err != nil {
-					t.Fatalf("failed to create branch dir: %v", err)
-				}
-				filePath := filepath.Join(branchDir, "dummy.txt")
-				if err := os.WriteFile(filePath, []byte("dummy"), 0o644); err != nil {
-					t.Fatalf("failed to create file: %v", err)
-				}
+				cloneTestRepo(t, origin, branchDir)
+				setTestRemoteURL(t, branchDir, "https://github.com/owner/repo.git")
 			},
 			wantErr: false,
-			checkAfter: func(branchDir string) error {
+			checkAfter: func() error {
 				if _, err := os.Stat(branchDir); !os.IsNotExist(err) {
 					return err
 				}
@@ -43,26 +42,94 @@ func TestDeleteBranchDir(t *testing.T) {
 			},
 		},
 		{
-			name:   "delete already deleted branch dir",
+			name:    "delete already deleted branch dir",
+			branch:  branchName,
+			prepare: func() {},
+			wantErr: true,
+		},
+		{
+			name:   "delete non-git branch dir",
 			branch: branchName,
 			prepare: func() {
-				_ = os.RemoveAll(branchDir)
+				writeTestFile(t, filepath.Join(branchDir, "dummy.txt"), "dummy")
 			},
-			wantErr: false,
-			checkAfter: func(branchDir string) error {
-				if _, err := os.Stat(branchDir); !os.IsNotExist(err) {
-					return err
-				}
-				return nil
+			wantErr: true,
+			checkAfter: func() error {
+				_, err := os.Stat(branchDir)
+				return err
+			},
+		},
+		{
+			name:   "delete checkout of another repository",
+			branch: branchName,
+			prepare: func() {
+				cloneTestRepo(t, origin, branchDir)
+				setTestRemoteURL(t, branchDir, "https://github.com/owner/other.git")
+			},
+			wantErr: true,
+			checkAfter: func() error {
+				_, err := os.Stat(branchDir)
+				return err
+			},
+		},
+		{
+			name:   "path traversal to parent",
+			branch: "..",
+			prepare: func() {
+				cloneTestRepo(t, origin, otherRepoDir)
+			},
+			wantErr: true,
+			checkAfter: func() error {
+				_, err := os.Stat(otherRepoDir)
+				return err
 			},
 		},
 		{
-			name:    "delete non-existent branch dir",
-			branch:  "nonexistent",
+			name:    "path traversal to sibling repository",
+			branch:  "../other",
 			prepare: func() {},
-			wantErr: false,
-			checkAfter: func(branchDir string) error {
-				if _, err := os.Stat(branchDir); !os.IsNotExist(err) {
+			wantErr: true,
+			checkAfter: func() error {
+				_, err := os.Stat(otherRepoDir)
+				return err
+			},
+		},
+		{
+			name:   "symlink pointing outside the repo dir",
+			branch: "link",
+			prepare: func() {
+				if err := os.Symlink(otherRepoDir, filepath.Join(repoDir, "link")); err != nil {
+					t.Fatalf("failed to create symlink: %v", err)
+				}
+			},
+			wantErr: true,
+			checkAfter: func() error {
+				_, err := os.Stat(otherRepoDir)
+				return err
+			},
+		},
+		{
+			name:   "base is protected",
+			branch: "base",
+			prepare: func() {
+				baseDir := filepath.Join(repoDir, "base")
+				cloneTestRepo(t, origin, baseDir)
+				setTestRemoteURL(t, baseDir, "https://github.com/owner/repo.git")
+			},
+			wantErr: true,
+			checkAfter: func() error {
+				_, err := os.Stat(filepath.Join(repoDir, "base"))
+				return err
+			},
+		},
+		{
+			name:      "base with allow base",
+			branch:    "base",
+			allowBase: true,
+			prepare:   func() {},
+			wantErr:   false,
+			checkAfter: func() error {
+				if _, err := os.Stat(filepath.Join(repoDir, "base")); !os.IsNotExist(err) {
 					return err
 				}
 				return nil
@@ -72,14 +139,125 @@ func TestDeleteBranchDir(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			_ = os.RemoveAll(branchDir)
 			tt.prepare()
-			branchDirPath := filepath.Join(repoDir, tt.branch)
-			err := handlers.DeleteBranchDir(context.Background(), repoDir, tt.branch)
+			opts := handlers.DeleteOptions{GitReplicatorRoot: tmpDir, RepoDir: repoDir, BranchName: tt.branch, AllowBase: tt.allowBase}
+			err := handlers.DeleteBranchDir(context.Background(), opts)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("DeleteBranchDir() error = %v, wantErr %v", err, tt.wantErr)
 			}
-			if err := tt.checkAfter(branchDirPath); err != nil {
-				t.Errorf("post-check failed: %v", err)
+			if tt.checkAfter != nil {
+				if err := tt.checkAfter(); err != nil {
+					t.Errorf("post-check failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestDeleteBranchDirSafetyChecks(t *testing.T) {
+	origin := newTestOrigin(t)
+	rootDir := t.TempDir()
+	repoDir := filepath.Join(rootDir, "github.com", "owner", "repo")
+	branchName := "feature-x"
+	branchDir := filepath.Join(repoDir, branchName)
+
+	tests := []struct {
+		name        string
+		prepare     func()
+		force       bool
+		permanent   bool
+		wantErr     bool
+		wantReport  string
+		wantDeleted bool
+	}{
+		{
+			name:        "clean clone",
+			prepare:     func() {},
+			wantDeleted: true,
+		},
+		{
+			name: "uncommitted changes",
+			prepare: func() {
+				writeTestFile(t, filepath.Join(branchDir, "README.md"), "changed\n")
+			},
+			wantErr:    true,
+			wantReport: "uncommitted changes (1):\n    README.md",
+		},
+		{
+			name: "untracked file",
+			prepare: func() {
+				writeTestFile(t, filepath.Join(branchDir, "new.txt"), "new\n")
+			},
+			wantErr:    true,
+			wantReport: "untracked files (1):\n    new.txt",
+		},
+		{
+			name: "stash",
+			prepare: func() {
+				writeTestFile(t, filepath.Join(branchDir, ".git", "refs", "stash"), "0000000000000000000000000000000000000001\n")
+			},
+			wantErr:    true,
+			wantReport: "stashes: 1",
+		},
+		{
+			name: "unpushed commits",
+			prepare: func() {
+				commitTestFile(t, branchDir, "a.txt", "a\n")
+				commitTestFile(t, branchDir, "b.txt", "b\n")
+			},
+			wantErr:    true,
+			wantReport: "commits not on any remote:\n    main: 2",
+		},
+		{
+			name: "unpushed commits with force",
+			prepare: func() {
+				commitTestFile(t, branchDir, "a.txt", "a\n")
+			},
+			force:       true,
+			wantDeleted: true,
+		},
+		{
+			name:        "clean clone removed permanently",
+			prepare:     func() {},
+			permanent:   true,
+			wantDeleted: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_ = os.RemoveAll(branchDir)
+			cloneTestRepo(t, origin, branchDir)
+			setTestRemoteURL(t, branchDir, "https://github.com/owner/repo.git")
+			tt.prepare()
+
+			opts := handlers.DeleteOptions{
+				GitReplicatorRoot: rootDir,
+				RepoDir:           repoDir,
+				BranchName:        branchName,
+				Force:             tt.force,
+				Permanent:         tt.permanent,
+			}
+			before, err := handlers.ListTrash(context.Background(), rootDir)
+			assert.NoError(t, err)
+			err = handlers.DeleteBranchDir(context.Background(), opts)
+			if tt.wantErr {
+				var unsafeErr *handlers.UnsafeDeleteError
+				assert.ErrorAs(t, err, &unsafeErr)
+				assert.Contains(t, err.Error(), tt.wantReport)
+			} else {
+				assert.NoError(t, err)
+			}
+			_, statErr := os.Stat(branchDir)
+			assert.Equal(t, tt.wantDeleted, os.IsNotExist(statErr))
+
+			after, err := handlers.ListTrash(context.Background(), rootDir)
+			assert.NoError(t, err)
+			if tt.wantDeleted && !tt.permanent {
+				assert.Len(t, after, len(before)+1)
+			} else {
+				assert.Len(t, after, len(before))
 			}
 		})
 	}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+type DiffOptions struct {
+	RepoDir string
+	// From and To are branch directory names; the diff shows the changes from From to To.
+	From string
+	To   string
+	// WorkTree compares the working trees, including uncommitted and untracked files, instead of the HEAD commits.
+	WorkTree bool
+	// Patch includes the full patch in addition to the diff stat.
+	Patch bool
+}
+
+// DiffCommit is a commit reachable from only one side of a diff.
+type DiffCommit struct {
+	Hash    string `json:"hash"`
+	Subject string `json:"subject"`
+}
+
+// DiffFile is the diff stat of a single file. Added and Deleted are zero for binary files.
+type DiffFile struct {
+	Path    string `json:"path"`
+	Added   int    `json:"added"`
+	Deleted int    `json:"deleted"`
+	Binary  bool   `json:"binary,omitempty"`
+}
+
+// DiffResult compares two branch directories.
+type DiffResult struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// OnlyFrom and OnlyTo are the commits reachable from the HEAD of one side but not the other, newest first.
+	OnlyFrom []DiffCommit `json:"only_from"`
+	OnlyTo   []DiffCommit `json:"only_to"`
+	Files    []DiffFile   `json:"files"`
+	Patch    string       `json:"patch,omitempty"`
+}
+
+// Diff compares two branch directories of the same repository without adding remotes or fetching between them.
+func Diff(ctx context.Context, opts DiffOptions) (DiffResult, error) {
+	result := DiffResult{From: opts.From, To: opts.To}
+	fromDir, err := resolveExistingReplica(opts.RepoDir, opts.From, true)
+	if err != nil {
+		return result, err
+	}
+	toDir, err := resolveExistingReplica(opts.RepoDir, opts.To, true)
+	if err != nil {
+		return result, err
+	}
+	fromHead, err := headHash(fromDir)
+	if err != nil {
+		return result, err
+	}
+	toHead, err := headHash(toDir)
+	if err != nil {
+		return result, err
+	}
+
+	// Run everything in From with the objects of To available, so that both sides can be compared by hash
+	env := utils.AlternateObjectsEnv(toDir)
+	if result.OnlyFrom, err = logRange(ctx, fromDir, env, toHead, fromHead); err != nil {
+		return result, err
+	}
+	if result.OnlyTo, err = logRange(ctx, fromDir, env, fromHead, toHead); err != nil {
+		return result, err
+	}
+
+	fromTree, toTree := fromHead, toHead
+	if opts.WorkTree {
+		// Keep the snapshots out of the object stores of both checkouts
+		objectDir, err := os.MkdirTemp("", "git-replicator-objects-*")
+		if err != nil {
+			return result, fmt.Errorf("failed to create temporary object directory: %w", err)
+		}
+		defer os.RemoveAll(objectDir)
+		if fromTree, err = utils.SnapshotWorktree(ctx, fromDir, objectDir); err != nil {
+			return result, err
+		}
+		if toTree, err = utils.SnapshotWorktree(ctx, toDir, objectDir); err != nil {
+			return result, err
+		}
+		env = utils.AlternateObjectDirsEnv(filepath.Join(toDir, ".git", "objects"), objectDir)
+	}
+	numstat, err := utils.RunGitEnv(ctx, fromDir, env, "-c", "core.quotePath=false", "diff", "--no-renames", "--numstat", fromTree, toTree)
+	if err != nil {
+		return result, err
+	}
+	if result.Files, err = parseNumstat(numstat); err != nil {
+		return result, err
+	}
+	if opts.Patch {
+		if result.Patch, err = utils.RunGitEnv(ctx, fromDir, env, "diff", "--no-renames", "--no-color", fromTree, toTree); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+func headHash(dir string) (string, error) {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to open repo %s: %w", dir, err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return "", fmt.Errorf("failed to get HEAD of %s: %w", dir, err)
+	}
+	return head.Hash().String(), nil
+}
+
+// logRange returns the commits reachable from tip but not from exclude.
+func logRange(ctx context.Context, dir string, env []string, exclude, tip string) ([]DiffCommit, error) {
+	out, err := utils.RunGitEnv(ctx, dir, env, "log", "--format=%H%x09%s", exclude+".."+tip)
+	if err != nil {
+		return nil, err
+	}
+	var commits []DiffCommit
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if line == "" {
+			continue
+		}
+		hash, subject, _ := strings.Cut(line, "\t")
+		commits = append(commits, DiffCommit{Hash: hash, Subject: subject})
+	}
+	return commits, nil
+}
+
+// parseNumstat parses the output of git diff --numstat.
+func parseNumstat(out string) ([]DiffFile, error) {
+	var files []DiffFile
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("unexpected diff stat line: %q", line)
+		}
+		file := DiffFile{Path: fields[2]}
+		if fields[0] == "-" && fields[1] == "-" {
+			file.Binary = true
+		} else {
+			var err error
+			if file.Added, err = strconv.Atoi(fields[0]); err != nil {
+				return nil, fmt.Errorf("unexpected diff stat line: %q", line)
+			}
+			if file.Deleted, err = strconv.Atoi(fields[1]); err != nil {
+				return nil, fmt.Errorf("unexpected diff stat line: %q", line)
+			}
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
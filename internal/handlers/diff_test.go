@@ -0,0 +1,70 @@
+package handlers_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+)
+
+func TestDiff(t *testing.T) {
+	origin := newTestOrigin(t)
+	repoDir := filepath.Join(t.TempDir(), "github.com", "owner", "repo")
+	for _, branch := range []string{"base", "a", "b"} {
+		dir := filepath.Join(repoDir, branch)
+		cloneTestRepo(t, origin, dir)
+		setTestRemoteURL(t, dir, "https://github.com/owner/repo.git")
+	}
+	aDir, bDir := filepath.Join(repoDir, "a"), filepath.Join(repoDir, "b")
+	commitTestFile(t, aDir, "README.md", "# test\nfrom a\n")
+	commitTestFile(t, aDir, "a.txt", "a\n")
+	commitTestFile(t, bDir, "b.txt", "b1\nb2\n")
+	writeTestFile(t, filepath.Join(bDir, "wip.txt"), "wip\n")
+
+	t.Run("replica against base", func(t *testing.T) {
+		result, err := handlers.Diff(context.Background(), handlers.DiffOptions{RepoDir: repoDir, From: "base", To: "a"})
+		assert.NoError(t, err)
+		assert.Empty(t, result.OnlyFrom)
+		if assert.Len(t, result.OnlyTo, 2) {
+			assert.Equal(t, "update a.txt", result.OnlyTo[0].Subject)
+			assert.Equal(t, "update README.md", result.OnlyTo[1].Subject)
+		}
+		assert.Equal(t, []handlers.DiffFile{
+			{Path: "README.md", Added: 1, Deleted: 0},
+			{Path: "a.txt", Added: 1, Deleted: 0},
+		}, result.Files)
+		assert.Empty(t, result.Patch)
+	})
+
+	t.Run("two replicas with patch", func(t *testing.T) {
+		result, err := handlers.Diff(context.Background(), handlers.DiffOptions{RepoDir: repoDir, From: "a", To: "b", Patch: true})
+		assert.NoError(t, err)
+		assert.Len(t, result.OnlyFrom, 2)
+		if assert.Len(t, result.OnlyTo, 1) {
+			assert.Equal(t, "update b.txt", result.OnlyTo[0].Subject)
+		}
+		assert.Equal(t, []handlers.DiffFile{
+			{Path: "README.md", Added: 0, Deleted: 1},
+			{Path: "a.txt", Added: 0, Deleted: 1},
+			{Path: "b.txt", Added: 2, Deleted: 0},
+		}, result.Files)
+		assert.Contains(t, result.Patch, "+b2")
+		assert.NotContains(t, result.Patch, "wip")
+	})
+
+	t.Run("working trees", func(t *testing.T) {
+		result, err := handlers.Diff(context.Background(), handlers.DiffOptions{RepoDir: repoDir, From: "base", To: "b", WorkTree: true})
+		assert.NoError(t, err)
+		assert.Equal(t, []handlers.DiffFile{
+			{Path: "b.txt", Added: 2, Deleted: 0},
+			{Path: "wip.txt", Added: 1, Deleted: 0},
+		}, result.Files)
+	})
+
+	t.Run("missing replica", func(t *testing.T) {
+		_, err := handlers.Diff(context.Background(), handlers.DiffOptions{RepoDir: repoDir, From: "base", To: "missing"})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+// ReplicaDiskUsage is the disk usage of a branch directory.
+type ReplicaDiskUsage struct {
+	RepoDir string `json:"repo_dir"`
+	Branch  string `json:"branch"`
+	Dir     string `json:"dir"`
+	utils.DiskUsage
+	// Alternates are the object directories the replica borrows objects from; their size is counted where they live.
+	Alternates []string `json:"alternates,omitempty"`
+	// Blocked describes the work that deleting the replica would lose; empty for clean replicas.
+	Blocked string `json:"blocked,omitempty"`
+}
+
+// RepoDiskUsage is the disk usage of a repository and its branch directories.
+type RepoDiskUsage struct {
+	Dir string `json:"dir"`
+	utils.DiskUsage
+	Replicas []ReplicaDiskUsage `json:"replicas"`
+}
+
+// DiskUsageReport is the disk usage of a set of repositories.
+type DiskUsageReport struct {
+	Repos []RepoDiskUsage `json:"repos"`
+	Total utils.DiskUsage `json:"total"`
+	// Reclaimable are the largest replicas that can be deleted without losing work, largest first.
+	Reclaimable []ReplicaDiskUsage `json:"reclaimable"`
+}
+
+type DiskUsageOptions struct {
+	RepoDirs []string
+	// Top is the number of reclaimable replicas to report.
+	Top int
+	// Owner is the lease owner asking; replicas leased by anyone else are not reclaimable.
+	Owner string
+}
+
+// ReportDiskUsage measures base and every replica of opts.RepoDirs.
+// Files hardlinked between checkouts are counted in the first checkout measured, base before the replicas, and objects borrowed via alternates are counted where they live, so totals are not double counted.
+func ReportDiskUsage(ctx context.Context, opts DiskUsageOptions) (DiskUsageReport, error) {
+	var report DiskUsageReport
+	var candidates []ReplicaDiskUsage
+	seen := utils.FileSet{}
+	for _, repoDir := range opts.RepoDirs {
+		replicas, err := listReplicas(ctx, repoDir)
+		if err != nil {
+			return report, err
+		}
+		repo := RepoDiskUsage{Dir: repoDir}
+		for _, branch := range append([]string{utils.BaseDirName}, replicas...) {
+			r := ReplicaDiskUsage{RepoDir: repoDir, Branch: branch, Dir: filepath.Join(repoDir, branch)}
+			if r.DiskUsage, err = utils.MeasureDiskUsage(r.Dir, seen); err != nil {
+				return report, err
+			}
+			if r.Alternates, err = utils.Alternates(r.Dir); err != nil {
+				return report, err
+			}
+			repo.DiskUsage = repo.DiskUsage.Add(r.DiskUsage)
+			if branch != utils.BaseDirName {
+				if r.Blocked = blockedReason(ctx, r.Dir, opts.Owner, time.Now()); r.Blocked == "" {
+					candidates = append(candidates, r)
+				}
+			}
+			repo.Replicas = append(repo.Replicas, r)
+		}
+		report.Total = report.Total.Add(repo.DiskUsage)
+		report.Repos = append(report.Repos, repo)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Total() > candidates[j].Total()
+	})
+	report.Reclaimable = candidates[:min(max(opts.Top, 0), len(candidates))]
+	return report, nil
+}
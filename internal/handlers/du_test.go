@@ -0,0 +1,80 @@
+package handlers_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+)
+
+func TestReportDiskUsage(t *testing.T) {
+	origin := newTestOrigin(t)
+	repoDir := filepath.Join(t.TempDir(), "github.com", "owner", "repo")
+	baseDir := filepath.Join(repoDir, "base")
+	cloneTestRepo(t, origin, baseDir)
+	for _, branch := range []string{"small", "large", "dirty"} {
+		dir := filepath.Join(repoDir, branch)
+		cloneTestRepo(t, origin, dir)
+		setTestRemoteURL(t, dir, "https://github.com/owner/repo.git")
+	}
+	writeTestFile(t, filepath.Join(repoDir, "large", ".git", "big.bin"), strings.Repeat("x", 1<<16))
+	writeTestFile(t, filepath.Join(repoDir, "dirty", "wip.txt"), strings.Repeat("x", 1<<17))
+
+	// small hardlinks the objects of base, as a local clone does
+	packDir := filepath.Join(baseDir, ".git", "objects", "pack")
+	packs, err := os.ReadDir(packDir)
+	if err != nil {
+		t.Fatalf("failed to read packs: %v", err)
+	}
+	var packSize int64
+	for _, p := range packs {
+		target := filepath.Join(repoDir, "small", ".git", "objects", "pack", "shared-"+p.Name())
+		if err := os.Link(filepath.Join(packDir, p.Name()), target); err != nil {
+			t.Fatalf("failed to link %s: %v", p.Name(), err)
+		}
+		info, err := p.Info()
+		if err != nil {
+			t.Fatalf("failed to stat %s: %v", p.Name(), err)
+		}
+		packSize += info.Size()
+	}
+	writeTestFile(t, filepath.Join(repoDir, "small", ".git", "objects", "info", "alternates"), baseDir+"/.git/objects\n")
+
+	report, err := handlers.ReportDiskUsage(context.Background(), handlers.DiskUsageOptions{RepoDirs: []string{repoDir}, Top: 5})
+	assert.NoError(t, err)
+	if !assert.Len(t, report.Repos, 1) {
+		return
+	}
+	repo := report.Repos[0]
+	var branches []string
+	var sum int64
+	for _, r := range repo.Replicas {
+		branches = append(branches, r.Branch)
+		sum += r.Total()
+	}
+	assert.Equal(t, []string{"base", "dirty", "large", "small"}, branches)
+	assert.Equal(t, sum, repo.Total())
+	assert.Equal(t, repo.DiskUsage, report.Total)
+
+	small := repo.Replicas[3]
+	assert.Positive(t, packSize)
+	assert.Equal(t, packSize, small.Shared)
+	assert.Equal(t, []string{filepath.Join(baseDir, ".git", "objects")}, small.Alternates)
+	assert.Equal(t, "1 untracked", repo.Replicas[1].Blocked)
+	assert.Greater(t, repo.Replicas[1].Worktree, int64(1<<17))
+
+	// dirty is the largest replica but would lose work, so it is not reclaimable
+	var reclaimable []string
+	for _, r := range report.Reclaimable {
+		reclaimable = append(reclaimable, r.Branch)
+	}
+	assert.Equal(t, []string{"large", "small"}, reclaimable)
+
+	report, err = handlers.ReportDiskUsage(context.Background(), handlers.DiskUsageOptions{RepoDirs: []string{repoDir}, Top: 1})
+	assert.NoError(t, err)
+	assert.Len(t, report.Reclaimable, 1)
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+type EvaluateOptions struct {
+	ExecOptions
+	// ScorePattern extracts the score from the output of the command: the first group of its last match, or the whole match without groups.
+	// Nil takes the score from the last line of the output if it is a number.
+	ScorePattern *regexp.Regexp
+	// LowerIsBetter ranks lower scores first, e.g. for durations or error counts.
+	LowerIsBetter bool
+}
+
+// Evaluation is the outcome of the evaluation command in a replica.
+type Evaluation struct {
+	// Rank starts at 1 for the best replica.
+	Rank int `json:"rank"`
+	ExecResult
+	Passed bool `json:"passed"`
+	// Score is nil when the output contained no score.
+	Score *float64 `json:"score"`
+}
+
+// Evaluate runs opts.Command in the selected replicas like Exec and ranks them: replicas whose command succeeded come first,
+// ordered by score, then by duration. opts.LogDir is required, the scores are read from the logs.
+func Evaluate(ctx context.Context, opts EvaluateOptions) ([]Evaluation, error) {
+	if opts.LogDir == "" {
+		return nil, fmt.Errorf("log directory is required")
+	}
+	results, err := Exec(ctx, opts.ExecOptions)
+	if err != nil {
+		return nil, err
+	}
+	evaluations := make([]Evaluation, len(results))
+	for i, r := range results {
+		e := Evaluation{ExecResult: r, Passed: r.ExitCode == 0}
+		if r.LogFile != "" {
+			if data, err := os.ReadFile(r.LogFile); err == nil {
+				e.Score = parseScore(string(data), opts.ScorePattern)
+			}
+		}
+		evaluations[i] = e
+	}
+
+	sort.SliceStable(evaluations, func(i, j int) bool {
+		a, b := evaluations[i], evaluations[j]
+		if a.Passed != b.Passed {
+			return a.Passed
+		}
+		if (a.Score == nil) != (b.Score == nil) {
+			return a.Score != nil
+		}
+		if a.Score != nil && *a.Score != *b.Score {
+			return (*a.Score < *b.Score) == opts.LowerIsBetter
+		}
+		return a.Duration < b.Duration
+	})
+	for i := range evaluations {
+		evaluations[i].Rank = i + 1
+	}
+	return evaluations, nil
+}
+
+// parseScore returns the score in output according to pattern, or the number on the last non-empty line of output without a pattern.
+func parseScore(output string, pattern *regexp.Regexp) *float64 {
+	var s string
+	if pattern != nil {
+		matches := pattern.FindAllStringSubmatch(output, -1)
+		if len(matches) == 0 {
+			return nil
+		}
+		last := matches[len(matches)-1]
+		s = last[0]
+		if len(last) > 1 {
+			s = last[1]
+		}
+	} else {
+		lines := strings.Split(strings.TrimSpace(output), "\n")
+		s = lines[len(lines)-1]
+	}
+	score, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return nil
+	}
+	return &score
+}
+
+// CheckoutInBase fetches the branch checked out in the replica name into base and checks it out there, e.g. to promote the winner of an evaluation.
+// It refuses to touch a base with uncommitted changes.
+func CheckoutInBase(ctx context.Context, repoDir, name string) (string, error) {
+	dir, ref, err := replicaBranch(repoDir, name)
+	if err != nil {
+		return "", err
+	}
+	baseDir := filepath.Join(repoDir, utils.BaseDirName)
+	state, err := utils.InspectWorkState(ctx, baseDir)
+	if err != nil {
+		return "", err
+	}
+	if len(state.Modified) > 0 {
+		return "", fmt.Errorf("base has uncommitted changes:\n%s", state.Report())
+	}
+	if _, err := utils.RunGit(ctx, baseDir, "fetch", "--quiet", dir, ref.String()); err != nil {
+		return "", err
+	}
+	// -B also works when base already has the branch checked out, e.g. when picking again after more work
+	if _, err := utils.RunGit(ctx, baseDir, "checkout", "--quiet", "-B", ref.Short(), "FETCH_HEAD"); err != nil {
+		return "", err
+	}
+	return ref.Short(), nil
+}
+
+// FetchIntoBase fetches the branch checked out in the replica name into a branch of the same name in base without checking it out,
+// so that base stays on its default branch.
+func FetchIntoBase(ctx context.Context, repoDir, name string) (string, error) {
+	dir, ref, err := replicaBranch(repoDir, name)
+	if err != nil {
+		return "", err
+	}
+	baseDir := filepath.Join(repoDir, utils.BaseDirName)
+	baseRepo, err := git.PlainOpen(baseDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to open base: %w", err)
+	}
+	baseHead, err := baseRepo.Head()
+	if err != nil {
+		return "", fmt.Errorf("failed to get HEAD of base: %w", err)
+	}
+	if baseHead.Name() == ref {
+		return "", fmt.Errorf("branch %s is checked out in base, switch base to its default branch first", ref.Short())
+	}
+	// Force the update so that picking again after more work replaces the branch
+	refspec := fmt.Sprintf("+%s:%s", ref, ref)
+	if _, err := utils.RunGit(ctx, baseDir, "fetch", "--quiet", dir, refspec); err != nil {
+		return "", err
+	}
+	return ref.Short(), nil
+}
+
+// replicaBranch returns the directory of the replica name and the branch checked out in it.
+func replicaBranch(repoDir, name string) (string, plumbing.ReferenceName, error) {
+	dir, err := resolveExistingReplica(repoDir, name, false)
+	if err != nil {
+		return "", "", err
+	}
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to open repo: %w", err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get HEAD: %w", err)
+	}
+	if !head.Name().IsBranch() {
+		return "", "", fmt.Errorf("HEAD of %s is detached", dir)
+	}
+	return dir, head.Name(), nil
+}
@@ -0,0 +1,160 @@
+package handlers_test
+
+import (
+	"context"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+func TestEvaluate(t *testing.T) {
+	origin := newTestOrigin(t)
+	repoDir := filepath.Join(t.TempDir(), "github.com", "owner", "repo")
+	for _, branch := range []string{"base", "a", "b", "c", "d"} {
+		dir := filepath.Join(repoDir, branch)
+		cloneTestRepo(t, origin, dir)
+		setTestRemoteURL(t, dir, "https://github.com/owner/repo.git")
+	}
+	// a scores 0.5, b 0.9, c fails with a high score and d prints no score
+	script := `case "$GIT_REPLICATOR_REPLICA" in
+a) echo "coverage: 50%"; echo 0.5;;
+b) echo "coverage: 90%"; echo 0.9;;
+c) echo "coverage: 99%"; echo 0.99; exit 1;;
+d) echo done;;
+esac`
+
+	ranking := func(evaluations []handlers.Evaluation) string {
+		var names []string
+		for _, e := range evaluations {
+			names = append(names, e.Name)
+		}
+		return strings.Join(names, " ")
+	}
+	evaluate := func(t *testing.T, pattern *regexp.Regexp, lowerIsBetter bool) []handlers.Evaluation {
+		evaluations, err := handlers.Evaluate(context.Background(), handlers.EvaluateOptions{
+			ExecOptions:   handlers.ExecOptions{RepoDir: repoDir, Command: []string{"sh", "-c", script}, Jobs: 2, LogDir: t.TempDir()},
+			ScorePattern:  pattern,
+			LowerIsBetter: lowerIsBetter,
+		})
+		assert.NoError(t, err)
+		return evaluations
+	}
+
+	t.Run("last line", func(t *testing.T) {
+		evaluations := evaluate(t, nil, false)
+		assert.Equal(t, "b a d c", ranking(evaluations))
+		assert.Equal(t, 1, evaluations[0].Rank)
+		assert.True(t, evaluations[0].Passed)
+		assert.Equal(t, 0.9, *evaluations[0].Score)
+		assert.Nil(t, evaluations[2].Score)
+		assert.False(t, evaluations[3].Passed)
+	})
+
+	t.Run("pattern, lower is better", func(t *testing.T) {
+		evaluations := evaluate(t, regexp.MustCompile(`coverage: (\d+)%`), true)
+		assert.Equal(t, "a b d c", ranking(evaluations))
+		assert.Equal(t, 50.0, *evaluations[0].Score)
+	})
+
+	t.Run("no log dir", func(t *testing.T) {
+		_, err := handlers.Evaluate(context.Background(), handlers.EvaluateOptions{ExecOptions: handlers.ExecOptions{RepoDir: repoDir, Command: []string{"true"}}})
+		assert.Error(t, err)
+	})
+}
+
+func TestFetchIntoBase(t *testing.T) {
+	setTestGitIdentity(t)
+	origin := newTestOrigin(t)
+	repoDir := filepath.Join(t.TempDir(), "github.com", "owner", "repo")
+	baseDir := filepath.Join(repoDir, "base")
+	for _, branch := range []string{"base", "winner"} {
+		dir := filepath.Join(repoDir, branch)
+		repo := cloneTestRepo(t, origin, dir)
+		setTestRemoteURL(t, dir, "https://github.com/owner/repo.git")
+		if branch != "base" {
+			head, err := repo.Head()
+			if err != nil {
+				t.Fatalf("failed to get HEAD: %v", err)
+			}
+			checkoutTestBranch(t, dir, branch, head.Hash())
+		}
+	}
+	winnerDir := filepath.Join(repoDir, "winner")
+	commit := commitTestFile(t, winnerDir, "win.txt", "win\n")
+	baseHead, err := utils.RunGit(context.Background(), baseDir, "rev-parse", "--abbrev-ref", "HEAD")
+	assert.NoError(t, err)
+
+	branch, err := handlers.FetchIntoBase(context.Background(), repoDir, "winner")
+	assert.NoError(t, err)
+	assert.Equal(t, "winner", branch)
+	out, err := utils.RunGit(context.Background(), baseDir, "rev-parse", "refs/heads/winner")
+	assert.NoError(t, err)
+	assert.Equal(t, commit.String(), strings.TrimSpace(out))
+	// Base stays on its default branch
+	out, err = utils.RunGit(context.Background(), baseDir, "rev-parse", "--abbrev-ref", "HEAD")
+	assert.NoError(t, err)
+	assert.Equal(t, baseHead, out)
+	assert.NoFileExists(t, filepath.Join(baseDir, "win.txt"))
+
+	// Picking again after more work updates the branch, even when it was rewritten
+	_, err = utils.RunGit(context.Background(), winnerDir, "reset", "--quiet", "--hard", "HEAD~1")
+	assert.NoError(t, err)
+	commit = commitTestFile(t, winnerDir, "more.txt", "more\n")
+	_, err = handlers.FetchIntoBase(context.Background(), repoDir, "winner")
+	assert.NoError(t, err)
+	out, err = utils.RunGit(context.Background(), baseDir, "rev-parse", "refs/heads/winner")
+	assert.NoError(t, err)
+	assert.Equal(t, commit.String(), strings.TrimSpace(out))
+
+	_, err = utils.RunGit(context.Background(), baseDir, "checkout", "--quiet", "winner")
+	assert.NoError(t, err)
+	_, err = handlers.FetchIntoBase(context.Background(), repoDir, "winner")
+	assert.ErrorContains(t, err, "checked out in base")
+}
+
+func TestCheckoutInBase(t *testing.T) {
+	setTestGitIdentity(t)
+	origin := newTestOrigin(t)
+	repoDir := filepath.Join(t.TempDir(), "github.com", "owner", "repo")
+	baseDir := filepath.Join(repoDir, "base")
+	for _, branch := range []string{"base", "winner"} {
+		dir := filepath.Join(repoDir, branch)
+		repo := cloneTestRepo(t, origin, dir)
+		setTestRemoteURL(t, dir, "https://github.com/owner/repo.git")
+		if branch != "base" {
+			head, err := repo.Head()
+			if err != nil {
+				t.Fatalf("failed to get HEAD: %v", err)
+			}
+			checkoutTestBranch(t, dir, branch, head.Hash())
+		}
+	}
+	winnerDir := filepath.Join(repoDir, "winner")
+	commitTestFile(t, winnerDir, "win.txt", "win\n")
+
+	branch, err := handlers.CheckoutInBase(context.Background(), repoDir, "winner")
+	assert.NoError(t, err)
+	assert.Equal(t, "winner", branch)
+	out, err := utils.RunGit(context.Background(), baseDir, "rev-parse", "--abbrev-ref", "HEAD")
+	assert.NoError(t, err)
+	assert.Equal(t, "winner", strings.TrimSpace(out))
+	assert.FileExists(t, filepath.Join(baseDir, "win.txt"))
+
+	// Picking again after more work updates the checked out branch
+	commit := commitTestFile(t, winnerDir, "more.txt", "more\n")
+	_, err = handlers.CheckoutInBase(context.Background(), repoDir, "winner")
+	assert.NoError(t, err)
+	out, err = utils.RunGit(context.Background(), baseDir, "rev-parse", "HEAD")
+	assert.NoError(t, err)
+	assert.Equal(t, commit.String(), strings.TrimSpace(out))
+	assert.FileExists(t, filepath.Join(baseDir, "more.txt"))
+
+	writeTestFile(t, filepath.Join(baseDir, "win.txt"), "changed\n")
+	_, err = handlers.CheckoutInBase(context.Background(), repoDir, "winner")
+	assert.ErrorContains(t, err, "uncommitted changes")
+}
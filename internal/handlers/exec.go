@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+// ExecReplicaEnv is set to the branch directory name in the environment of commands run by Exec.
+const ExecReplicaEnv = "GIT_REPLICATOR_REPLICA"
+
+type ExecOptions struct {
+	RepoDir string
+	// Pattern is a glob pattern (see path.Match) selecting replicas by directory name. Empty selects every replica.
+	Pattern     string
+	IncludeBase bool
+	Command     []string
+	// Jobs is the number of commands run concurrently.
+	Jobs int
+	// LogDir, if set, receives the output of each replica in <name>.log.
+	LogDir string
+	// Output receives the output of every command, each line prefixed with the replica name, or with Group,
+	// the whole output of each replica once its command has finished. Nil discards it.
+	Output io.Writer
+	Group  bool
+	// Owner is the lease owner running the command. Replicas leased by anyone else are skipped unless IgnoreLeases is set.
+	Owner        string
+	IgnoreLeases bool
+}
+
+// ExecResult is the outcome of running the command in a replica.
+type ExecResult struct {
+	Name string `json:"name"`
+	Dir  string `json:"dir"`
+	// ExitCode is -1 when the command could not be started.
+	ExitCode int           `json:"exit_code"`
+	Duration time.Duration `json:"duration"`
+	LogFile  string        `json:"log_file,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Exec runs opts.Command in every selected replica of opts.RepoDir with at most opts.Jobs running at a time.
+func Exec(ctx context.Context, opts ExecOptions) ([]ExecResult, error) {
+	if len(opts.Command) == 0 {
+		return nil, fmt.Errorf("no command given")
+	}
+	if _, err := path.Match(opts.Pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", opts.Pattern, err)
+	}
+	names, err := listReplicas(ctx, opts.RepoDir)
+	if err != nil {
+		return nil, err
+	}
+	if opts.IncludeBase {
+		names = append([]string{utils.BaseDirName}, names...)
+	}
+	var results []*ExecResult
+	for _, name := range names {
+		if matchPattern(opts.Pattern, name) {
+			results = append(results, &ExecResult{Name: name, Dir: filepath.Join(opts.RepoDir, name)})
+		}
+	}
+	if opts.LogDir != "" {
+		if err := os.MkdirAll(opts.LogDir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create log directory: %w", err)
+		}
+	}
+
+	output := &syncWriter{w: opts.Output}
+	if output.w == nil {
+		output.w = io.Discard
+	}
+	sem := make(chan struct{}, max(opts.Jobs, 1))
+	var wg sync.WaitGroup
+	for _, r := range results {
+		if !opts.IgnoreLeases {
+			if err := checkLease(r.Dir, opts.Owner, time.Now()); err != nil {
+				r.ExitCode, r.Error = -1, err.Error()
+				continue
+			}
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			runInReplica(ctx, r, opts, output)
+		}()
+	}
+	wg.Wait()
+
+	execResults := make([]ExecResult, len(results))
+	for i, r := range results {
+		execResults[i] = *r
+	}
+	return execResults, nil
+}
+
+// runInReplica runs opts.Command in r.Dir and records the outcome in r.
+func runInReplica(ctx context.Context, r *ExecResult, opts ExecOptions, output *syncWriter) {
+	var writers []io.Writer
+	if opts.LogDir != "" {
+		r.LogFile = filepath.Join(opts.LogDir, r.Name+".log")
+		f, err := os.Create(r.LogFile)
+		if err != nil {
+			r.ExitCode, r.Error = -1, fmt.Sprintf("failed to create log file: %s", err)
+			return
+		}
+		defer f.Close()
+		writers = append(writers, f)
+	}
+	var grouped bytes.Buffer
+	prefixed := &prefixWriter{prefix: "[" + r.Name + "] ", out: output}
+	if opts.Group {
+		writers = append(writers, &grouped)
+	} else {
+		writers = append(writers, prefixed)
+	}
+	w := io.MultiWriter(writers...)
+
+	cmd := exec.CommandContext(ctx, opts.Command[0], opts.Command[1:]...)
+	cmd.Dir = r.Dir
+	cmd.Env = append(os.Environ(), ExecReplicaEnv+"="+r.Name)
+	cmd.Stdout = w
+	cmd.Stderr = w
+	start := time.Now()
+	err := cmd.Run()
+	r.Duration = time.Since(start)
+	prefixed.Flush()
+	if opts.Group {
+		output.Write([]byte(fmt.Sprintf("==> %s <==\n%s", r.Name, grouped.String())))
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+	case errors.As(err, &exitErr):
+		r.ExitCode = exitErr.ExitCode()
+		r.Error = err.Error()
+	default:
+		r.ExitCode, r.Error = -1, err.Error()
+	}
+}
+
+// syncWriter serializes writes from concurrent commands.
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
+
+// prefixWriter writes complete lines to out, each preceded by prefix, so that lines of concurrent commands are not interleaved.
+type prefixWriter struct {
+	prefix string
+	out    io.Writer
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		if _, err := p.out.Write(append([]byte(p.prefix), p.buf[:i+1]...)); err != nil {
+			return len(b), err
+		}
+		p.buf = p.buf[i+1:]
+	}
+}
+
+// Flush writes the last line if it is not terminated by a newline.
+func (p *prefixWriter) Flush() {
+	if len(p.buf) > 0 {
+		p.out.Write(append(append([]byte(p.prefix), p.buf...), '\n'))
+		p.buf = nil
+	}
+}
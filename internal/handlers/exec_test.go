@@ -0,0 +1,124 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+)
+
+func TestExec(t *testing.T) {
+	origin := newTestOrigin(t)
+	repoDir := filepath.Join(t.TempDir(), "github.com", "owner", "repo")
+	for _, branch := range []string{"base", "agent-1", "agent-2", "other"} {
+		dir := filepath.Join(repoDir, branch)
+		cloneTestRepo(t, origin, dir)
+		setTestRemoteURL(t, dir, "https://github.com/owner/repo.git")
+	}
+	script := `echo "out $GIT_REPLICATOR_REPLICA $(basename "$PWD")"; echo err >&2; printf tail; [ "$GIT_REPLICATOR_REPLICA" != agent-2 ]`
+
+	exitCodes := func(results []handlers.ExecResult) map[string]int {
+		codes := map[string]int{}
+		for _, r := range results {
+			codes[r.Name] = r.ExitCode
+		}
+		return codes
+	}
+
+	t.Run("prefixed output and logs", func(t *testing.T) {
+		logDir := filepath.Join(t.TempDir(), "logs")
+		var out bytes.Buffer
+		results, err := handlers.Exec(context.Background(), handlers.ExecOptions{
+			RepoDir: repoDir,
+			Pattern: "agent-*",
+			Command: []string{"sh", "-c", script},
+			Jobs:    2,
+			LogDir:  logDir,
+			Output:  &out,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]int{"agent-1": 0, "agent-2": 1}, exitCodes(results))
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		sort.Strings(lines)
+		assert.Equal(t, []string{
+			"[agent-1] err",
+			"[agent-1] out agent-1 agent-1",
+			"[agent-1] tail",
+			"[agent-2] err",
+			"[agent-2] out agent-2 agent-2",
+			"[agent-2] tail",
+		}, lines)
+
+		data, err := os.ReadFile(filepath.Join(logDir, "agent-1.log"))
+		assert.NoError(t, err)
+		assert.Contains(t, string(data), "out agent-1 agent-1\n")
+		assert.Equal(t, filepath.Join(logDir, "agent-1.log"), results[0].LogFile)
+	})
+
+	t.Run("grouped output with base", func(t *testing.T) {
+		var out bytes.Buffer
+		results, err := handlers.Exec(context.Background(), handlers.ExecOptions{
+			RepoDir:     repoDir,
+			IncludeBase: true,
+			Command:     []string{"sh", "-c", "echo one; echo two"},
+			Jobs:        4,
+			Output:      &out,
+			Group:       true,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]int{"base": 0, "agent-1": 0, "agent-2": 0, "other": 0}, exitCodes(results))
+		assert.Contains(t, out.String(), "==> base <==\none\ntwo\n")
+		assert.Contains(t, out.String(), "==> other <==\none\ntwo\n")
+		assert.Empty(t, results[0].LogFile)
+	})
+
+	t.Run("command not found", func(t *testing.T) {
+		results, err := handlers.Exec(context.Background(), handlers.ExecOptions{RepoDir: repoDir, Pattern: "other", Command: []string{"git-replicator-no-such-command"}})
+		assert.NoError(t, err)
+		if assert.Len(t, results, 1) {
+			assert.Equal(t, -1, results[0].ExitCode)
+			assert.NotEmpty(t, results[0].Error)
+		}
+	})
+
+	t.Run("leased replicas are skipped", func(t *testing.T) {
+		_, err := handlers.Claim(context.Background(), handlers.ClaimOptions{RepoDir: repoDir, Name: "agent-1", Owner: "alice", Now: time.Now()})
+		assert.NoError(t, err)
+		t.Cleanup(func() {
+			_ = os.Remove(handlers.LeasePath(filepath.Join(repoDir, "agent-1")))
+		})
+
+		opts := handlers.ExecOptions{RepoDir: repoDir, Pattern: "agent-1", Command: []string{"true"}, Owner: "bob"}
+		results, err := handlers.Exec(context.Background(), opts)
+		assert.NoError(t, err)
+		if assert.Len(t, results, 1) {
+			assert.Equal(t, -1, results[0].ExitCode)
+			assert.Contains(t, results[0].Error, "is leased by alice")
+		}
+
+		opts.Owner = "alice"
+		results, err = handlers.Exec(context.Background(), opts)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]int{"agent-1": 0}, exitCodes(results))
+
+		opts.Owner, opts.IgnoreLeases = "bob", true
+		results, err = handlers.Exec(context.Background(), opts)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]int{"agent-1": 0}, exitCodes(results))
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		_, err := handlers.Exec(context.Background(), handlers.ExecOptions{RepoDir: repoDir})
+		assert.Error(t, err)
+		_, err = handlers.Exec(context.Background(), handlers.ExecOptions{RepoDir: repoDir, Pattern: "[", Command: []string{"true"}})
+		assert.Error(t, err)
+	})
+}
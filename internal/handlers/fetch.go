@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+type FetchOptions struct {
+	RepoDirs []string
+	// BaseOnly fetches only the base directory of each repository.
+	BaseOnly bool
+	// Jobs is the number of fetches run concurrently.
+	Jobs int
+	// Timeout limits each fetch. Zero means no limit.
+	Timeout time.Duration
+}
+
+const (
+	FetchSourceOrigin = "origin"
+	FetchSourceBase   = "base"
+)
+
+// FetchResult is the outcome of fetching a single branch directory.
+type FetchResult struct {
+	RepoDir string `json:"repo_dir"`
+	Branch  string `json:"branch"`
+	Dir     string `json:"dir"`
+	// Source is FetchSourceOrigin, or FetchSourceBase when the remote-tracking branches of the replica were fetched from the local base checkout.
+	Source   string        `json:"source"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// FetchAll fetches origin in base and, unless opts.BaseOnly is set, every replica of opts.RepoDirs, running up to opts.Jobs fetches at a time.
+// Base is fetched first. Replicas then fetch the remote-tracking branches of base from the local checkout instead of fetching origin again,
+// unless base is a single branch clone that does not track the branches of the replicas.
+// Failures are reported in the Error field of each result.
+func FetchAll(ctx context.Context, opts FetchOptions, fetchFunc FetchFunc) ([]FetchResult, error) {
+	var bases, replicas []*FetchResult
+	for _, repoDir := range opts.RepoDirs {
+		bases = append(bases, &FetchResult{RepoDir: repoDir, Branch: utils.BaseDirName, Dir: filepath.Join(repoDir, utils.BaseDirName), Source: FetchSourceOrigin})
+		if opts.BaseOnly {
+			continue
+		}
+		branches, err := listReplicas(ctx, repoDir)
+		if err != nil {
+			return nil, err
+		}
+		if len(branches) == 0 {
+			continue
+		}
+		source := FetchSourceOrigin
+		allBranches, err := utils.TracksAllBranches(filepath.Join(repoDir, utils.BaseDirName))
+		if err != nil {
+			return nil, err
+		}
+		if allBranches {
+			source = FetchSourceBase
+		}
+		for _, branch := range branches {
+			replicas = append(replicas, &FetchResult{RepoDir: repoDir, Branch: branch, Dir: filepath.Join(repoDir, branch), Source: source})
+		}
+	}
+
+	failedBases := map[string]bool{}
+	runFetches(ctx, opts, bases, func(ctx context.Context, r *FetchResult) error {
+		return fetchFunc(ctx, r.Dir)
+	})
+	for _, r := range bases {
+		if r.Error != "" {
+			failedBases[r.RepoDir] = true
+		}
+	}
+	runFetches(ctx, opts, replicas, func(ctx context.Context, r *FetchResult) error {
+		if r.Source == FetchSourceOrigin {
+			return fetchFunc(ctx, r.Dir)
+		}
+		if failedBases[r.RepoDir] {
+			return errors.New("skipped: fetching base failed")
+		}
+		return utils.FetchRemoteRefs(ctx, r.Dir, filepath.Join(r.RepoDir, utils.BaseDirName))
+	})
+
+	results := make([]FetchResult, 0, len(bases)+len(replicas))
+	for _, r := range append(bases, replicas...) {
+		results = append(results, *r)
+	}
+	// Group the results by repository, base first
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].RepoDir < results[j].RepoDir
+	})
+	return results, nil
+}
+
+// runFetches runs fetch for every result with at most opts.Jobs at a time and records the duration and error of each.
+func runFetches(ctx context.Context, opts FetchOptions, results []*FetchResult, fetch func(ctx context.Context, r *FetchResult) error) {
+	sem := make(chan struct{}, max(opts.Jobs, 1))
+	var wg sync.WaitGroup
+	for _, r := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			fetchCtx := ctx
+			if opts.Timeout > 0 {
+				var cancel context.CancelFunc
+				fetchCtx, cancel = context.WithTimeout(ctx, opts.Timeout)
+				defer cancel()
+			}
+			start := time.Now()
+			err := fetch(fetchCtx, r)
+			r.Duration = time.Since(start)
+			if err != nil {
+				if errors.Is(fetchCtx.Err(), context.DeadlineExceeded) {
+					err = fmt.Errorf("timed out after %s: %w", opts.Timeout, err)
+				}
+				r.Error = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,106 @@
+package handlers_test
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/stretchr/testify/assert"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+func TestFetchAll(t *testing.T) {
+	origin := newTestOrigin(t)
+	repoDir := filepath.Join(t.TempDir(), "github.com", "owner", "repo")
+	baseDir := filepath.Join(repoDir, "base")
+	for _, branch := range []string{"base", "a", "b"} {
+		dir := filepath.Join(repoDir, branch)
+		cloneTestRepo(t, origin, dir)
+		setTestRemoteURL(t, dir, "https://github.com/owner/repo.git")
+	}
+	newHead := commitTestFile(t, origin, "new.txt", "new\n")
+
+	// fetchOrigin fetches the local origin instead of the configured remote URL
+	var fetched []string
+	fetchOrigin := func(ctx context.Context, dir string) error {
+		fetched = append(fetched, filepath.Base(dir))
+		_, err := utils.RunGit(ctx, dir, "fetch", "--quiet", origin, "+refs/heads/*:refs/remotes/origin/*")
+		return err
+	}
+	originMain := func(dir string) plumbing.Hash {
+		repo, err := git.PlainOpen(dir)
+		if err != nil {
+			t.Fatalf("failed to open %s: %v", dir, err)
+		}
+		ref, err := repo.Reference(plumbing.NewRemoteReferenceName("origin", "main"), true)
+		if err != nil {
+			t.Fatalf("failed to read origin/main of %s: %v", dir, err)
+		}
+		return ref.Hash()
+	}
+
+	t.Run("base only", func(t *testing.T) {
+		fetched = nil
+		results, err := handlers.FetchAll(context.Background(), handlers.FetchOptions{RepoDirs: []string{repoDir}, BaseOnly: true, Jobs: 1}, fetchOrigin)
+		assert.NoError(t, err)
+		if assert.Len(t, results, 1) {
+			assert.Equal(t, "base", results[0].Branch)
+			assert.Empty(t, results[0].Error)
+		}
+		assert.Equal(t, []string{"base"}, fetched)
+		assert.Equal(t, newHead, originMain(baseDir))
+	})
+
+	t.Run("replicas fetch from base", func(t *testing.T) {
+		fetched = nil
+		results, err := handlers.FetchAll(context.Background(), handlers.FetchOptions{RepoDirs: []string{repoDir}, Jobs: 1}, fetchOrigin)
+		assert.NoError(t, err)
+		sources := map[string]string{}
+		for _, r := range results {
+			assert.Empty(t, r.Error)
+			sources[r.Branch] = r.Source
+		}
+		assert.Equal(t, map[string]string{"base": handlers.FetchSourceOrigin, "a": handlers.FetchSourceBase, "b": handlers.FetchSourceBase}, sources)
+		assert.Equal(t, []string{"base"}, fetched)
+		assert.Equal(t, newHead, originMain(filepath.Join(repoDir, "a")))
+		assert.Equal(t, newHead, originMain(filepath.Join(repoDir, "b")))
+	})
+
+	t.Run("single branch base", func(t *testing.T) {
+		_, err := utils.RunGit(context.Background(), baseDir, "config", "remote.origin.fetch", "+refs/heads/main:refs/remotes/origin/main")
+		assert.NoError(t, err)
+		t.Cleanup(func() {
+			_, err := utils.RunGit(context.Background(), baseDir, "config", "remote.origin.fetch", "+refs/heads/*:refs/remotes/origin/*")
+			assert.NoError(t, err)
+		})
+		fetched = nil
+		results, err := handlers.FetchAll(context.Background(), handlers.FetchOptions{RepoDirs: []string{repoDir}, Jobs: 1}, fetchOrigin)
+		assert.NoError(t, err)
+		for _, r := range results {
+			assert.Empty(t, r.Error)
+			assert.Equal(t, handlers.FetchSourceOrigin, r.Source)
+		}
+		assert.ElementsMatch(t, []string{"base", "a", "b"}, fetched)
+	})
+
+	t.Run("failures and timeouts are reported per replica", func(t *testing.T) {
+		failing := func(ctx context.Context, dir string) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		results, err := handlers.FetchAll(context.Background(), handlers.FetchOptions{RepoDirs: []string{repoDir}, Jobs: 4, Timeout: 50 * time.Millisecond}, failing)
+		assert.NoError(t, err)
+		errs := map[string]string{}
+		for _, r := range results {
+			errs[r.Branch] = r.Error
+		}
+		assert.True(t, strings.HasPrefix(errs["base"], "timed out after 50ms"), errs["base"])
+		assert.Equal(t, "skipped: fetching base failed", errs["a"])
+		assert.Equal(t, "skipped: fetching base failed", errs["b"])
+	})
+}
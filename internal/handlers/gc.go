@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+// ReplicaUsage describes when a replica was last worked on and how much disk it uses.
+type ReplicaUsage struct {
+	RepoDir      string    `json:"repo_dir"`
+	Branch       string    `json:"branch"`
+	Dir          string    `json:"dir"`
+	LastCommit   time.Time `json:"last_commit,omitzero"`
+	LastModified time.Time `json:"last_modified,omitzero"`
+	Size         int64     `json:"size,omitempty"`
+}
+
+// LastActivity returns the later of the last commit time and the last file modification time.
+func (u ReplicaUsage) LastActivity() time.Time {
+	if u.LastModified.After(u.LastCommit) {
+		return u.LastModified
+	}
+	return u.LastCommit
+}
+
+// GetReplicaUsage returns the usage of the branch directory of repoDir.
+func GetReplicaUsage(ctx context.Context, repoDir, branch string) (ReplicaUsage, error) {
+	dir := filepath.Join(repoDir, branch)
+	usage := ReplicaUsage{RepoDir: repoDir, Branch: branch, Dir: dir}
+	var err error
+	if usage.LastCommit, err = utils.LastCommitTime(dir); err != nil {
+		return usage, err
+	}
+	if usage.LastModified, err = utils.LastModified(dir); err != nil {
+		return usage, err
+	}
+	if usage.Size, err = utils.DirSize(dir); err != nil {
+		return usage, err
+	}
+	return usage, nil
+}
+
+type GCOptions struct {
+	RepoDirs []string
+	// MaxAge selects replicas without activity for longer than this. Zero disables the policy.
+	MaxAge time.Duration
+	// Keep selects all but the Keep most recently active replicas of each repository. Zero disables the policy.
+	Keep int
+	// DiskBudget selects the least recently active replicas until the replicas of all repositories fit into this many bytes. Zero disables the policy.
+	DiskBudget int64
+	// Force skips the safety checks, so that no candidate is blocked.
+	Force bool
+	// Owner is the lease owner collecting the replicas; only leases of other owners block a candidate.
+	Owner string
+	Now   time.Time
+}
+
+// GCCandidate is a replica selected for garbage collection.
+type GCCandidate struct {
+	ReplicaUsage
+	Reason string `json:"reason"`
+	// Blocked describes the work that would be lost; blocked candidates are not deleted.
+	Blocked string `json:"blocked,omitempty"`
+	// UsageError reports why the usage of the replica could not be read; such replicas are not deleted either.
+	UsageError string `json:"usage_error,omitempty"`
+}
+
+// Deletable reports whether the candidate can be deleted.
+func (c GCCandidate) Deletable() bool {
+	return c.Blocked == "" && c.UsageError == ""
+}
+
+// PlanGC selects the replicas of opts.RepoDirs to garbage collect according to the policies in opts.
+// Candidates that would lose work are included with Blocked set and do not count towards the disk budget.
+// Replicas whose usage cannot be read are included with UsageError set and are left out of every policy.
+func PlanGC(ctx context.Context, opts GCOptions) ([]GCCandidate, error) {
+	if opts.MaxAge <= 0 && opts.Keep <= 0 && opts.DiskBudget <= 0 {
+		return nil, fmt.Errorf("at least one of max age, keep or disk budget is required")
+	}
+
+	var candidates []GCCandidate
+	var all []ReplicaUsage
+	byRepo := map[string][]ReplicaUsage{}
+	var total int64
+	for _, repoDir := range opts.RepoDirs {
+		replicas, err := listReplicas(ctx, repoDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, branch := range replicas {
+			usage, err := GetReplicaUsage(ctx, repoDir, branch)
+			if err != nil {
+				candidates = append(candidates, GCCandidate{ReplicaUsage: usage, UsageError: err.Error()})
+				continue
+			}
+			all = append(all, usage)
+			byRepo[repoDir] = append(byRepo[repoDir], usage)
+			total += usage.Size
+		}
+	}
+
+	selected := map[string]bool{}
+	var freed int64
+	selectReplica := func(usage ReplicaUsage, reason string) {
+		if selected[usage.Dir] {
+			return
+		}
+		selected[usage.Dir] = true
+		c := GCCandidate{ReplicaUsage: usage, Reason: reason}
+		if !opts.Force {
+			c.Blocked = blockedReason(ctx, usage.Dir, opts.Owner, opts.Now)
+		}
+		if c.Blocked == "" {
+			freed += usage.Size
+		}
+		candidates = append(candidates, c)
+	}
+
+	if opts.MaxAge > 0 {
+		for _, usage := range all {
+			if age := opts.Now.Sub(usage.LastActivity()); age > opts.MaxAge {
+				selectReplica(usage, fmt.Sprintf("untouched for %s", formatAge(age)))
+			}
+		}
+	}
+	if opts.Keep > 0 {
+		for _, usages := range byRepo {
+			sorted := append([]ReplicaUsage(nil), usages...)
+			sort.Slice(sorted, func(i, j int) bool {
+				return sorted[i].LastActivity().After(sorted[j].LastActivity())
+			})
+			for i := opts.Keep; i < len(sorted); i++ {
+				selectReplica(sorted[i], fmt.Sprintf("more than %d replicas in repository", opts.Keep))
+			}
+		}
+	}
+	if opts.DiskBudget > 0 {
+		sorted := append([]ReplicaUsage(nil), all...)
+		sort.Slice(sorted, func(i, j int) bool {
+			return sorted[i].LastActivity().Before(sorted[j].LastActivity())
+		})
+		for _, usage := range sorted {
+			if total-freed <= opts.DiskBudget {
+				break
+			}
+			selectReplica(usage, fmt.Sprintf("total size %s over disk budget %s", utils.FormatSize(total-freed), utils.FormatSize(opts.DiskBudget)))
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].RepoDir != candidates[j].RepoDir {
+			return candidates[i].RepoDir < candidates[j].RepoDir
+		}
+		return candidates[i].LastActivity().Before(candidates[j].LastActivity())
+	})
+	return candidates, nil
+}
+
+// blockedReason returns the lease of another owner than owner on dir or a summary of the work that deleting it would lose, or "" if it is safe to delete.
+func blockedReason(ctx context.Context, dir, owner string, now time.Time) string {
+	if reason := leaseBlockedReason(dir, owner, now); reason != "" {
+		return reason
+	}
+	state, err := utils.InspectWorkState(ctx, dir)
+	if err != nil {
+		return err.Error()
+	}
+	if state.Clean() {
+		return ""
+	}
+	return state.Summary()
+}
+
+// leaseBlockedReason returns the valid lease of another owner than owner on dir, or "" if there is none.
+func leaseBlockedReason(dir, owner string, now time.Time) string {
+	err := checkLease(dir, owner, now)
+	var leased *LeasedError
+	if errors.As(err, &leased) {
+		return "leased by " + leased.Lease.String()
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// formatAge formats a duration in whole days, or hours below one day.
+func formatAge(d time.Duration) string {
+	if d >= 24*time.Hour {
+		return fmt.Sprintf("%dd", int(d/(24*time.Hour)))
+	}
+	return fmt.Sprintf("%dh", int(d/time.Hour))
+}
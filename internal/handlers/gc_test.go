@@ -0,0 +1,126 @@
+package handlers_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+)
+
+func TestPlanGC(t *testing.T) {
+	now := time.Now()
+	day := 24 * time.Hour
+
+	origin := filepath.Join(t.TempDir(), "origin")
+	cloneTestRepo(t, newTestOrigin(t), origin)
+	commitTestFileAt(t, origin, "old.txt", "old\n", now.Add(-100*day))
+
+	repoDir := filepath.Join(t.TempDir(), "github.com", "owner", "repo")
+	cloneTestRepo(t, origin, filepath.Join(repoDir, "base"))
+	for branch, age := range map[string]time.Duration{"a": 40 * day, "b": 20 * day, "c": 2 * day, "d": 1 * day} {
+		dir := filepath.Join(repoDir, branch)
+		cloneTestRepo(t, origin, dir)
+		setTestRemoteURL(t, dir, "https://github.com/owner/repo.git")
+		if branch == "a" {
+			writeTestFile(t, filepath.Join(dir, "wip.txt"), "wip\n")
+		}
+		touchTestTree(t, dir, now.Add(-age))
+	}
+
+	branchesOf := func(candidates []handlers.GCCandidate) []string {
+		var branches []string
+		for _, c := range candidates {
+			branches = append(branches, c.Branch)
+		}
+		return branches
+	}
+
+	t.Run("no policy", func(t *testing.T) {
+		_, err := handlers.PlanGC(context.Background(), handlers.GCOptions{RepoDirs: []string{repoDir}, Now: now})
+		assert.Error(t, err)
+	})
+
+	t.Run("max age", func(t *testing.T) {
+		candidates, err := handlers.PlanGC(context.Background(), handlers.GCOptions{RepoDirs: []string{repoDir}, MaxAge: 10 * day, Now: now})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a", "b"}, branchesOf(candidates))
+		assert.Equal(t, "untouched for 40d", candidates[0].Reason)
+		assert.Equal(t, "1 untracked", candidates[0].Blocked)
+		assert.Equal(t, "untouched for 20d", candidates[1].Reason)
+		assert.Empty(t, candidates[1].Blocked)
+	})
+
+	t.Run("keep", func(t *testing.T) {
+		candidates, err := handlers.PlanGC(context.Background(), handlers.GCOptions{RepoDirs: []string{repoDir}, Keep: 3, Now: now})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a"}, branchesOf(candidates))
+		assert.Equal(t, "more than 3 replicas in repository", candidates[0].Reason)
+	})
+
+	t.Run("disk budget skips blocked replicas", func(t *testing.T) {
+		var sizes []int64
+		var total int64
+		for _, branch := range []string{"a", "b", "c", "d"} {
+			usage, err := handlers.GetReplicaUsage(context.Background(), repoDir, branch)
+			assert.NoError(t, err)
+			sizes = append(sizes, usage.Size)
+			total += usage.Size
+		}
+		// Freeing b is enough, but a is blocked and frees nothing
+		candidates, err := handlers.PlanGC(context.Background(), handlers.GCOptions{RepoDirs: []string{repoDir}, DiskBudget: total - sizes[1], Now: now})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a", "b"}, branchesOf(candidates))
+		assert.NotEmpty(t, candidates[0].Blocked)
+		assert.Empty(t, candidates[1].Blocked)
+	})
+
+	t.Run("only leases of other owners block", func(t *testing.T) {
+		_, err := handlers.Claim(context.Background(), handlers.ClaimOptions{RepoDir: repoDir, Name: "b", Owner: "agent-1", Now: now})
+		assert.NoError(t, err)
+		t.Cleanup(func() {
+			_, err := handlers.Release(handlers.ReleaseOptions{RepoDir: repoDir, Name: "b", Owner: "agent-1", Now: now})
+			assert.NoError(t, err)
+		})
+
+		candidates, err := handlers.PlanGC(context.Background(), handlers.GCOptions{RepoDirs: []string{repoDir}, MaxAge: 10 * day, Owner: "agent-2", Now: now})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a", "b"}, branchesOf(candidates))
+		assert.Contains(t, candidates[1].Blocked, "leased by agent-1")
+
+		candidates, err = handlers.PlanGC(context.Background(), handlers.GCOptions{RepoDirs: []string{repoDir}, MaxAge: 10 * day, Owner: "agent-1", Now: now})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a", "b"}, branchesOf(candidates))
+		assert.Empty(t, candidates[1].Blocked)
+	})
+
+	t.Run("force does not block", func(t *testing.T) {
+		candidates, err := handlers.PlanGC(context.Background(), handlers.GCOptions{RepoDirs: []string{repoDir}, MaxAge: 30 * day, Force: true, Now: now})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a"}, branchesOf(candidates))
+		assert.Empty(t, candidates[0].Blocked)
+	})
+
+	t.Run("unreadable replicas are reported", func(t *testing.T) {
+		broken := filepath.Join(repoDir, "broken")
+		cloneTestRepo(t, origin, broken)
+		setTestRemoteURL(t, broken, "https://github.com/owner/repo.git")
+		t.Cleanup(func() {
+			assert.NoError(t, os.RemoveAll(broken))
+		})
+		// HEAD points at a commit that does not exist
+		writeTestFile(t, filepath.Join(broken, ".git", "refs", "heads", "broken"), strings.Repeat("1", 40)+"\n")
+		writeTestFile(t, filepath.Join(broken, ".git", "HEAD"), "ref: refs/heads/broken\n")
+
+		candidates, err := handlers.PlanGC(context.Background(), handlers.GCOptions{RepoDirs: []string{repoDir}, MaxAge: 10 * day, Now: now})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"broken", "a", "b"}, branchesOf(candidates))
+		assert.Contains(t, candidates[0].UsageError, "failed to read HEAD commit")
+		assert.False(t, candidates[0].Deletable())
+		assert.True(t, candidates[2].Deletable())
+	})
+}
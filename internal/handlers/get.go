@@ -11,18 +11,27 @@ import (
 	"github.com/terakoya76/git-replicator/internal/utils"
 )
 
-func Get(ctx context.Context, url string, rootDir string) error {
+// BaseDir returns the base directory ($root/<host>/<owner>/<repo>/base) that Get clones the given url into.
+func BaseDir(url string, rootDir string) (string, error) {
+	// Parse the URL to extract host, owner, and repo
+	u, err := utils.ParseGitURL(url)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse git url: %w", err)
+	}
+	return filepath.Join(rootDir, u.Host, u.Owner, u.Repo, utils.BaseDirName), nil
+}
+
+// Get clones url into its base directory under rootDir with cloneFunc. It does nothing if the base directory is already a clone of url.
+func Get(ctx context.Context, url string, rootDir string, cloneFunc CloneFunc) error {
 	cloneURL := url
 	if !strings.HasSuffix(url, ".git") {
 		cloneURL = url + ".git"
 	}
 
-	// Parse the URL to extract host, owner, and repo
-	u, err := utils.ParseGitURL(url)
+	dir, err := BaseDir(url, rootDir)
 	if err != nil {
-		return fmt.Errorf("failed to parse git url: %w", err)
+		return err
 	}
-	dir := filepath.Join(rootDir, u.Host, u.Owner, u.Repo, "base")
 	gitIndex := filepath.Join(dir, ".git", "index")
 	if _, err := os.Stat(dir); err == nil {
 		// Directory exists, check if it's a git repo
@@ -48,7 +57,7 @@ func Get(ctx context.Context, url string, rootDir string) error {
 		return fmt.Errorf("directory %s exists but is not a git repo", dir)
 	}
 	// Directory does not exist, clone directly into the target directory
-	err = utils.DefaultCloneFunc(ctx, cloneURL, dir)
+	err = cloneFunc(ctx, cloneURL, dir)
 	if err != nil {
 		return fmt.Errorf("git clone failed: %w", err)
 	}
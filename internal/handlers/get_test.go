@@ -58,7 +58,7 @@ func TestGet(t *testing.T) {
 		for _, tt := range tests {
 			t.Run(tt.name, func(t *testing.T) {
 				cleanupTestRepo(t, validRepoURL, tmpDir)
-				err := handlers.Get(context.Background(), tt.url, tmpDir)
+				err := handlers.Get(context.Background(), tt.url, tmpDir, utils.DefaultCloneFunc)
 				if tt.wantErr {
 					assert.Error(t, err)
 				} else {
@@ -79,7 +79,7 @@ func TestGet(t *testing.T) {
 			t.Fatalf("failed to mkdir parent dir: %v", err)
 		}
 		assert.NoError(t, os.Mkdir(dir, 0o755))
-		err := handlers.Get(context.Background(), validRepoURL, tmpDir)
+		err := handlers.Get(context.Background(), validRepoURL, tmpDir, utils.DefaultCloneFunc)
 		assert.Error(t, err)
 	})
 
@@ -97,7 +97,7 @@ func TestGet(t *testing.T) {
 		if err := f.Close(); err != nil {
 			t.Errorf("failed to close file: %v", err)
 		}
-		err = handlers.Get(context.Background(), validRepoURL, tmpDir)
+		err = handlers.Get(context.Background(), validRepoURL, tmpDir, utils.DefaultCloneFunc)
 		assert.Error(t, err)
 	})
 
@@ -117,7 +117,7 @@ func TestGet(t *testing.T) {
 		if err := f.Close(); err != nil {
 			t.Errorf("failed to close file: %v", err)
 		}
-		err = handlers.Get(context.Background(), validRepoURL, tmpDir)
+		err = handlers.Get(context.Background(), validRepoURL, tmpDir, utils.DefaultCloneFunc)
 		assert.NoError(t, err)
 	})
 
@@ -137,7 +137,7 @@ func TestGet(t *testing.T) {
 		if err := f.Close(); err != nil {
 			t.Errorf("failed to close file: %v", err)
 		}
-		err = handlers.Get(context.Background(), validRepoURL, tmpDir)
+		err = handlers.Get(context.Background(), validRepoURL, tmpDir, utils.DefaultCloneFunc)
 		assert.Error(t, err)
 	})
 }
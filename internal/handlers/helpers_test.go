@@ -0,0 +1,129 @@
+package handlers_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+// newTestOrigin creates a local repository with a single commit on main that can be cloned without network access.
+func newTestOrigin(t *testing.T) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "origin")
+	if _, err := git.PlainInitWithOptions(dir, &git.PlainInitOptions{
+		InitOptions: git.InitOptions{DefaultBranch: plumbing.NewBranchReferenceName("main")},
+	}); err != nil {
+		t.Fatalf("failed to init origin: %v", err)
+	}
+	commitTestFile(t, dir, "README.md", "# test\n")
+	return dir
+}
+
+// cloneTestRepo clones the local origin into dir.
+func cloneTestRepo(t *testing.T, origin, dir string) *git.Repository {
+	t.Helper()
+	repo, err := git.PlainCloneContext(context.Background(), dir, false, &git.CloneOptions{URL: origin})
+	if err != nil {
+		t.Fatalf("failed to clone %s: %v", origin, err)
+	}
+	return repo
+}
+
+// commitTestFile writes name with content in the checkout at dir and commits it.
+func commitTestFile(t *testing.T, dir, name, content string) plumbing.Hash {
+	t.Helper()
+	return commitTestFileAt(t, dir, name, content, time.Now())
+}
+
+// commitTestFileAt is like commitTestFile with the commit dated when.
+func commitTestFileAt(t *testing.T, dir, name, content string, when time.Time) plumbing.Hash {
+	t.Helper()
+	writeTestFile(t, filepath.Join(dir, name), content)
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatalf("failed to open repo: %v", err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("failed to get worktree: %v", err)
+	}
+	if _, err := wt.Add(name); err != nil {
+		t.Fatalf("failed to add %s: %v", name, err)
+	}
+	hash, err := wt.Commit("update "+name, &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: when},
+	})
+	if err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	return hash
+}
+
+// writeTestFile writes content to path, creating parent directories.
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+// setTestRemoteURL points the origin remote of the checkout at dir to url.
+func setTestRemoteURL(t *testing.T, dir, url string) {
+	t.Helper()
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatalf("failed to open repo: %v", err)
+	}
+	cfg, err := repo.Config()
+	if err != nil {
+		t.Fatalf("failed to read config: %v", err)
+	}
+	cfg.Remotes["origin"].URLs = []string{url}
+	if err := repo.SetConfig(cfg); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+}
+
+// touchTestTree sets the modification time of every file under dir, including .git, to when.
+func touchTestTree(t *testing.T, dir string, when time.Time) {
+	t.Helper()
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Chtimes(path, when, when)
+	})
+	if err != nil {
+		t.Fatalf("failed to touch %s: %v", dir, err)
+	}
+}
+
+// fetchTestOrigin returns a FetchFunc that fetches the local origin instead of the configured remote URL, which points at a host the tests cannot reach.
+func fetchTestOrigin(origin string) handlers.FetchFunc {
+	return func(ctx context.Context, dir string) error {
+		_, err := utils.RunGit(ctx, dir, "fetch", "--quiet", origin, "+refs/heads/*:refs/remotes/origin/*")
+		return err
+	}
+}
+
+// setTestGitIdentity sets the identity the git CLI uses for the commits it creates, e.g. during a rebase.
+func setTestGitIdentity(t *testing.T) {
+	t.Helper()
+	for _, key := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(key, "test")
+	}
+	for _, key := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(key, "test@example.com")
+	}
+}
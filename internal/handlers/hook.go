@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// RunHook runs command with sh -c in the branch directory name of repoDir, writing its output to w.
+// The name of the branch directory is available to the command as $GIT_REPLICATOR_REPLICA.
+func RunHook(ctx context.Context, repoDir, name, command string, w io.Writer) error {
+	if w == nil {
+		w = io.Discard
+	}
+	dir := filepath.Join(repoDir, name)
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), ExecReplicaEnv+"="+name)
+	cmd.Stdout = w
+	cmd.Stderr = w
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("hook %q failed in %s: %w", command, dir, err)
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+)
+
+func TestRunHook(t *testing.T) {
+	repoDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(repoDir, "feature"), 0o755); err != nil {
+		t.Fatalf("failed to create replica: %v", err)
+	}
+
+	var out bytes.Buffer
+	err := handlers.RunHook(context.Background(), repoDir, "feature", `echo "$GIT_REPLICATOR_REPLICA $(basename "$PWD")"; echo err >&2`, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, "feature feature\nerr\n", out.String())
+
+	assert.NoError(t, handlers.RunHook(context.Background(), repoDir, "feature", "true", nil))
+	err = handlers.RunHook(context.Background(), repoDir, "feature", "exit 3", nil)
+	assert.ErrorContains(t, err, `hook "exit 3" failed`)
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/terakoya76/git-replicator/internal/config"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+// TmuxFunc defines a function type for running tmux commands
+// This allows for dependency injection in tests
+type TmuxFunc func(ctx context.Context, args ...string) (string, error)
+
+type LaunchOptions struct {
+	RepoDir string
+	// Replicas are the branch directory names to launch the agent in. All launches it in every replica instead.
+	Replicas []string
+	All      bool
+	// Profile is rendered for each replica and its command typed into the shell of the new window. An empty command starts only the shell.
+	Profile config.Profile
+}
+
+const (
+	LaunchStatusLaunched = "launched"
+	LaunchStatusRunning  = "already running"
+)
+
+// LaunchResult describes the tmux window of a replica.
+type LaunchResult struct {
+	Name    string `json:"name"`
+	Dir     string `json:"dir"`
+	Session string `json:"session"`
+	// Window is the tmux window ID, e.g. "@3".
+	Window string `json:"window"`
+	Status string `json:"status"`
+}
+
+// TmuxSessionName returns the name of the tmux session holding the agent windows of repoDir, e.g. "terakoya76/git-replicator".
+// Dots and colons, which tmux does not allow in session names, are replaced by underscores.
+func TmuxSessionName(repoDir string) string {
+	name := filepath.Base(filepath.Dir(repoDir)) + "/" + filepath.Base(repoDir)
+	return strings.NewReplacer(".", "_", ":", "_").Replace(name)
+}
+
+// Launch opens a tmux window for each selected replica in the session of opts.RepoDir, creating the session if needed,
+// with its working directory set according to opts.Profile, and runs the command of the profile in it. Replicas that already have a window are left alone.
+func Launch(ctx context.Context, opts LaunchOptions, tmux TmuxFunc) ([]LaunchResult, error) {
+	names := opts.Replicas
+	if opts.All {
+		var err error
+		if names, err = listReplicas(ctx, opts.RepoDir); err != nil {
+			return nil, err
+		}
+	} else if len(names) == 0 {
+		return nil, fmt.Errorf("no replicas to launch")
+	}
+	dirs := make([]string, len(names))
+	for i, name := range names {
+		dir, err := resolveExistingReplica(opts.RepoDir, name, true)
+		if err != nil {
+			return nil, err
+		}
+		dirs[i] = dir
+	}
+
+	session := TmuxSessionName(opts.RepoDir)
+	var results []LaunchResult
+	for _, dir := range dirs {
+		// Windows are named after the directory, so that every spelling of a branch with slashes finds them
+		name := filepath.Base(dir)
+		r := LaunchResult{Name: name, Dir: dir, Session: session}
+		windows, err := tmuxWindows(ctx, session, tmux)
+		if err != nil {
+			return results, err
+		}
+		if id, ok := windows[name]; ok {
+			r.Window, r.Status = id, LaunchStatusRunning
+			results = append(results, r)
+			continue
+		}
+
+		agent, err := prepareAgent(opts.RepoDir, r.Dir, opts.Profile)
+		if err != nil {
+			return results, err
+		}
+		args := []string{"new-window", "-d", "-t", "=" + session + ":"}
+		if windows == nil {
+			args = []string{"new-session", "-d", "-s", session}
+		}
+		args = append(args, "-n", name, "-c", agent.Dir, "-P", "-F", "#{window_id}")
+		for _, kv := range agent.Env {
+			args = append(args, "-e", kv)
+		}
+		out, err := tmux(ctx, args...)
+		if err != nil {
+			return results, err
+		}
+		r.Window, r.Status = strings.TrimSpace(out), LaunchStatusLaunched
+		// Type the command into the shell, so that the window stays open with its output when the agent exits
+		if agent.Command != "" {
+			if _, err := tmux(ctx, "send-keys", "-t", r.Window, agent.Command, "Enter"); err != nil {
+				return results, err
+			}
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// FindAgentWindow returns the tmux session of repoDir and the ID of the window of the replica name in it.
+func FindAgentWindow(ctx context.Context, repoDir, name string, tmux TmuxFunc) (string, string, error) {
+	dir, err := utils.ResolveReplicaDir(repoDir, name)
+	if err != nil {
+		return "", "", err
+	}
+	session := TmuxSessionName(repoDir)
+	windows, err := tmuxWindows(ctx, session, tmux)
+	if err != nil {
+		return "", "", err
+	}
+	id, ok := windows[filepath.Base(dir)]
+	if !ok {
+		return "", "", fmt.Errorf("no agent window for %s in tmux session %s (start one with: git-replicator launch %s)", name, session, name)
+	}
+	return session, id, nil
+}
+
+// Stop closes the tmux window of the replica name, ending the agent running in it.
+func Stop(ctx context.Context, repoDir, name string, tmux TmuxFunc) error {
+	_, id, err := FindAgentWindow(ctx, repoDir, name, tmux)
+	if err != nil {
+		return err
+	}
+	_, err = tmux(ctx, "kill-window", "-t", id)
+	return err
+}
+
+// StopAll closes the tmux session of repoDir with the windows of all its replicas.
+func StopAll(ctx context.Context, repoDir string, tmux TmuxFunc) error {
+	session := TmuxSessionName(repoDir)
+	windows, err := tmuxWindows(ctx, session, tmux)
+	if err != nil {
+		return err
+	}
+	if windows == nil {
+		return fmt.Errorf("no tmux session %s", session)
+	}
+	_, err = tmux(ctx, "kill-session", "-t", "="+session)
+	return err
+}
+
+// tmuxWindows returns the window IDs of session by window name, or nil if the session does not exist.
+func tmuxWindows(ctx context.Context, session string, tmux TmuxFunc) (map[string]string, error) {
+	if _, err := tmux(ctx, "has-session", "-t", "="+session); err != nil {
+		if errors.Is(err, utils.ErrTmuxNoSession) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	out, err := tmux(ctx, "list-windows", "-t", "="+session, "-F", "#{window_id} #{window_name}")
+	if err != nil {
+		return nil, err
+	}
+	windows := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if id, name, ok := strings.Cut(line, " "); ok {
+			windows[name] = id
+		}
+	}
+	return windows, nil
+}
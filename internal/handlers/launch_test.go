@@ -0,0 +1,133 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/terakoya76/git-replicator/internal/config"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+// newTestTmux returns a TmuxFunc running tmux on a private server, which is killed when the test ends.
+func newTestTmux(t *testing.T) handlers.TmuxFunc {
+	t.Helper()
+	if _, err := exec.LookPath("tmux"); err != nil {
+		t.Skip("tmux is not installed")
+	}
+	socket := fmt.Sprintf("git-replicator-test-%d", time.Now().UnixNano())
+	t.Cleanup(func() {
+		_, _ = utils.RunTmux(context.Background(), socket, "kill-server")
+	})
+	return func(ctx context.Context, args ...string) (string, error) {
+		return utils.RunTmux(ctx, socket, args...)
+	}
+}
+
+func TestTmuxSessionName(t *testing.T) {
+	assert.Equal(t, "terakoya76/git-replicator", handlers.TmuxSessionName("/root/github.com/terakoya76/git-replicator"))
+	assert.Equal(t, "owner/repo_js", handlers.TmuxSessionName("/root/github.com/owner/repo.js"))
+}
+
+func TestLaunchTmuxFailure(t *testing.T) {
+	origin := newTestOrigin(t)
+	repoDir := filepath.Join(t.TempDir(), "github.com", "owner", "repo")
+	for _, branch := range []string{"base", "a"} {
+		dir := filepath.Join(repoDir, branch)
+		cloneTestRepo(t, origin, dir)
+		setTestRemoteURL(t, dir, "https://github.com/owner/repo.git")
+	}
+	// A tmux failure other than a missing session is not taken for an empty session
+	tmux := func(ctx context.Context, args ...string) (string, error) {
+		if args[0] == "has-session" {
+			return "", errors.New("tmux has-session failed: permission denied")
+		}
+		t.Fatalf("unexpected tmux %v", args)
+		return "", nil
+	}
+	_, err := handlers.Launch(context.Background(), handlers.LaunchOptions{RepoDir: repoDir, Replicas: []string{"a"}}, tmux)
+	assert.ErrorContains(t, err, "permission denied")
+}
+
+func TestLaunch(t *testing.T) {
+	tmux := newTestTmux(t)
+	origin := newTestOrigin(t)
+	repoDir := filepath.Join(t.TempDir(), "github.com", "owner", "repo")
+	for _, branch := range []string{"base", "a", "b", "feature-foo"} {
+		dir := filepath.Join(repoDir, branch)
+		cloneTestRepo(t, origin, dir)
+		setTestRemoteURL(t, dir, "https://github.com/owner/repo.git")
+	}
+	ctx := context.Background()
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := handlers.Launch(ctx, handlers.LaunchOptions{RepoDir: repoDir}, tmux)
+		assert.Error(t, err)
+		_, err = handlers.Launch(ctx, handlers.LaunchOptions{RepoDir: repoDir, Replicas: []string{"missing"}}, tmux)
+		assert.Error(t, err)
+	})
+
+	t.Run("launch", func(t *testing.T) {
+		results, err := handlers.Launch(ctx, handlers.LaunchOptions{RepoDir: repoDir, Replicas: []string{"a"}, Profile: config.Profile{Command: "echo started-$GIT_REPLICATOR_REPLICA"}}, tmux)
+		assert.NoError(t, err)
+		assert.Len(t, results, 1)
+		assert.Equal(t, "owner/repo", results[0].Session)
+		assert.Equal(t, handlers.LaunchStatusLaunched, results[0].Status)
+
+		out, err := tmux(ctx, "display-message", "-p", "-t", results[0].Window, "#{pane_current_path}")
+		assert.NoError(t, err)
+		assert.Equal(t, filepath.Join(repoDir, "a"), strings.TrimSpace(out))
+		assert.Eventually(t, func() bool {
+			out, _ := tmux(ctx, "capture-pane", "-p", "-t", results[0].Window)
+			return strings.Contains(out, "started-a\n")
+		}, 5*time.Second, 50*time.Millisecond)
+	})
+
+	t.Run("all skips running windows", func(t *testing.T) {
+		results, err := handlers.Launch(ctx, handlers.LaunchOptions{RepoDir: repoDir, All: true}, tmux)
+		assert.NoError(t, err)
+		statuses := map[string]string{}
+		for _, r := range results {
+			statuses[r.Name] = r.Status
+		}
+		assert.Equal(t, map[string]string{"a": handlers.LaunchStatusRunning, "b": handlers.LaunchStatusLaunched, "feature-foo": handlers.LaunchStatusLaunched}, statuses)
+	})
+
+	t.Run("branch names with slashes", func(t *testing.T) {
+		results, err := handlers.Launch(ctx, handlers.LaunchOptions{RepoDir: repoDir, Replicas: []string{"feature/foo"}}, tmux)
+		assert.NoError(t, err)
+		if assert.Len(t, results, 1) {
+			assert.Equal(t, "feature-foo", results[0].Name)
+			assert.Equal(t, handlers.LaunchStatusRunning, results[0].Status)
+		}
+		_, slashID, err := handlers.FindAgentWindow(ctx, repoDir, "feature/foo", tmux)
+		assert.NoError(t, err)
+		_, dashID, err := handlers.FindAgentWindow(ctx, repoDir, "feature-foo", tmux)
+		assert.NoError(t, err)
+		assert.Equal(t, dashID, slashID)
+		assert.NoError(t, handlers.Stop(ctx, repoDir, "feature/foo", tmux))
+		_, _, err = handlers.FindAgentWindow(ctx, repoDir, "feature-foo", tmux)
+		assert.Error(t, err)
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		_, _, err := handlers.FindAgentWindow(ctx, repoDir, "a", tmux)
+		assert.NoError(t, err)
+		assert.NoError(t, handlers.Stop(ctx, repoDir, "a", tmux))
+		_, _, err = handlers.FindAgentWindow(ctx, repoDir, "a", tmux)
+		assert.Error(t, err)
+		assert.Error(t, handlers.Stop(ctx, repoDir, "a", tmux))
+
+		assert.NoError(t, handlers.StopAll(ctx, repoDir, tmux))
+		_, _, err = handlers.FindAgentWindow(ctx, repoDir, "b", tmux)
+		assert.Error(t, err)
+		assert.Error(t, handlers.StopAll(ctx, repoDir, tmux))
+	})
+}
@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+)
+
+// LeaseOwnerEnv overrides the default lease owner, the name of the current user.
+// Agents running as the same user must set it, or pass --owner, to tell their leases apart.
+const LeaseOwnerEnv = "GIT_REPLICATOR_OWNER"
+
+// ReplicaStateDir returns the directory holding the git-replicator state of the replica at dir.
+// It lives inside .git so that it never shows up as a change in the worktree.
+func ReplicaStateDir(dir string) string {
+	return filepath.Join(dir, ".git", "git-replicator")
+}
+
+// LeasePath returns the path of the lease file of the replica at dir.
+func LeasePath(dir string) string {
+	return filepath.Join(ReplicaStateDir(dir), "lease.json")
+}
+
+// DefaultLeaseOwner returns $GIT_REPLICATOR_OWNER, or the name of the current user.
+func DefaultLeaseOwner() string {
+	if owner := os.Getenv(LeaseOwnerEnv); owner != "" {
+		return owner
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return "unknown"
+}
+
+// Lease records who is working in a replica.
+type Lease struct {
+	Owner      string    `json:"owner"`
+	PID        int       `json:"pid,omitempty"`
+	Host       string    `json:"host,omitempty"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	// ExpiresAt is zero for leases that never expire.
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
+
+// Expired reports whether the lease is no longer valid at now and may be reclaimed by anyone.
+func (l Lease) Expired(now time.Time) bool {
+	return !l.ExpiresAt.IsZero() && !now.Before(l.ExpiresAt)
+}
+
+func (l Lease) String() string {
+	s := l.Owner
+	if l.PID != 0 || l.Host != "" {
+		s += fmt.Sprintf(" (pid %d on %s)", l.PID, l.Host)
+	}
+	if !l.ExpiresAt.IsZero() {
+		s += " until " + l.ExpiresAt.Local().Format(time.DateTime)
+	}
+	return s
+}
+
+// LeasedError is returned when a replica is leased by another owner.
+type LeasedError struct {
+	Dir   string
+	Lease Lease
+}
+
+func (e *LeasedError) Error() string {
+	return fmt.Sprintf("replica %s is leased by %s", e.Dir, e.Lease)
+}
+
+// ReadLease returns the lease of the replica at dir, or nil if it has none.
+func ReadLease(dir string) (*Lease, error) {
+	data, err := os.ReadFile(LeasePath(dir))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read lease: %w", err)
+	}
+	var lease Lease
+	if err := json.Unmarshal(data, &lease); err != nil {
+		return nil, fmt.Errorf("failed to parse lease %s: %w", LeasePath(dir), err)
+	}
+	return &lease, nil
+}
+
+// checkLease returns a *LeasedError if the replica at dir holds a valid lease of an owner other than owner.
+func checkLease(dir, owner string, now time.Time) error {
+	lease, err := ReadLease(dir)
+	if err != nil {
+		return err
+	}
+	if lease != nil && lease.Owner != owner && !lease.Expired(now) {
+		return &LeasedError{Dir: dir, Lease: *lease}
+	}
+	return nil
+}
+
+type ClaimOptions struct {
+	RepoDir string
+	// Name is the replica to claim. Empty claims the first replica without a valid lease.
+	Name  string
+	Owner string
+	PID   int
+	// TTL is how long the lease is valid. Zero means that it never expires.
+	TTL time.Duration
+	// Force takes over a valid lease of another owner.
+	Force bool
+	Now   time.Time
+}
+
+// ClaimResult is the replica leased by Claim.
+type ClaimResult struct {
+	Name  string `json:"name"`
+	Dir   string `json:"dir"`
+	Lease Lease  `json:"lease"`
+}
+
+// Claim leases a replica of opts.RepoDir to opts.Owner. Claiming a replica already leased by the same owner renews the lease,
+// and expired leases of other owners are taken over.
+func Claim(ctx context.Context, opts ClaimOptions) (ClaimResult, error) {
+	if opts.Owner == "" {
+		return ClaimResult{}, fmt.Errorf("lease owner is required")
+	}
+	host, _ := os.Hostname()
+	lease := Lease{Owner: opts.Owner, PID: opts.PID, Host: host, AcquiredAt: opts.Now}
+	if opts.TTL > 0 {
+		lease.ExpiresAt = opts.Now.Add(opts.TTL)
+	}
+
+	if opts.Name != "" {
+		dir, err := resolveExistingReplica(opts.RepoDir, opts.Name, false)
+		if err != nil {
+			return ClaimResult{}, err
+		}
+		if err := claimReplica(dir, lease, opts.Force); err != nil {
+			return ClaimResult{}, err
+		}
+		return ClaimResult{Name: opts.Name, Dir: dir, Lease: lease}, nil
+	}
+
+	names, err := listReplicas(ctx, opts.RepoDir)
+	if err != nil {
+		return ClaimResult{}, err
+	}
+	for _, name := range names {
+		dir := filepath.Join(opts.RepoDir, name)
+		err := claimReplica(dir, lease, false)
+		if err == nil {
+			return ClaimResult{Name: name, Dir: dir, Lease: lease}, nil
+		}
+		var leased *LeasedError
+		if !errors.As(err, &leased) {
+			return ClaimResult{}, err
+		}
+	}
+	return ClaimResult{}, fmt.Errorf("no free replica in %s (create one with: git-replicator switch <branch>)", opts.RepoDir)
+}
+
+// claimReplica writes lease into the replica at dir unless it holds a valid lease of another owner.
+func claimReplica(dir string, lease Lease, force bool) error {
+	path := LeasePath(dir)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	data, err := json.MarshalIndent(lease, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode lease: %w", err)
+	}
+
+	// Creating the file exclusively lets only one of several concurrent claims of a free replica win
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err == nil {
+		_, err = f.Write(data)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write lease: %w", err)
+		}
+		return nil
+	}
+	if !errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("failed to create lease: %w", err)
+	}
+
+	current, err := ReadLease(dir)
+	if err != nil {
+		return err
+	}
+	if current != nil && current.Owner != lease.Owner && !current.Expired(lease.AcquiredAt) && !force {
+		return &LeasedError{Dir: dir, Lease: *current}
+	}
+	tmp := path + ".tmp-" + fmt.Sprint(os.Getpid())
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write lease: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write lease: %w", err)
+	}
+	// Another owner may have taken over the same expired lease at the same time; the last write wins
+	written, err := ReadLease(dir)
+	if err != nil {
+		return err
+	}
+	if written == nil || written.Owner != lease.Owner || !written.AcquiredAt.Equal(lease.AcquiredAt) {
+		if written == nil {
+			return fmt.Errorf("lease of %s was released concurrently", dir)
+		}
+		return &LeasedError{Dir: dir, Lease: *written}
+	}
+	return nil
+}
+
+type ReleaseOptions struct {
+	RepoDir string
+	Name    string
+	Owner   string
+	// Force releases a valid lease of another owner.
+	Force bool
+	Now   time.Time
+}
+
+// Release removes the lease of a replica held by opts.Owner. Expired leases of other owners are removed as well.
+func Release(opts ReleaseOptions) (Lease, error) {
+	dir, err := resolveExistingReplica(opts.RepoDir, opts.Name, false)
+	if err != nil {
+		return Lease{}, err
+	}
+	lease, err := ReadLease(dir)
+	if err != nil {
+		return Lease{}, err
+	}
+	if lease == nil {
+		return Lease{}, fmt.Errorf("replica %s is not leased", dir)
+	}
+	if lease.Owner != opts.Owner && !lease.Expired(opts.Now) && !opts.Force {
+		return Lease{}, &LeasedError{Dir: dir, Lease: *lease}
+	}
+	if err := os.Remove(LeasePath(dir)); err != nil {
+		return Lease{}, fmt.Errorf("failed to remove lease: %w", err)
+	}
+	return *lease, nil
+}
@@ -0,0 +1,146 @@
+package handlers_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+func TestClaim(t *testing.T) {
+	origin := newTestOrigin(t)
+	repoDir := filepath.Join(t.TempDir(), "github.com", "owner", "repo")
+	for _, branch := range []string{"base", "a", "b"} {
+		dir := filepath.Join(repoDir, branch)
+		cloneTestRepo(t, origin, dir)
+		setTestRemoteURL(t, dir, "https://github.com/owner/repo.git")
+	}
+	now := time.Now().Truncate(time.Second)
+	ctx := context.Background()
+	claim := func(name, owner string, ttl time.Duration, force bool, at time.Time) (handlers.ClaimResult, error) {
+		return handlers.Claim(ctx, handlers.ClaimOptions{RepoDir: repoDir, Name: name, Owner: owner, PID: 42, TTL: ttl, Force: force, Now: at})
+	}
+
+	t.Run("claim named replica", func(t *testing.T) {
+		result, err := claim("a", "alice", time.Hour, false, now)
+		assert.NoError(t, err)
+		assert.Equal(t, filepath.Join(repoDir, "a"), result.Dir)
+
+		lease, err := handlers.ReadLease(result.Dir)
+		assert.NoError(t, err)
+		if assert.NotNil(t, lease) {
+			assert.Equal(t, "alice", lease.Owner)
+			assert.Equal(t, 42, lease.PID)
+			assert.True(t, lease.ExpiresAt.Equal(now.Add(time.Hour)))
+		}
+		// The lease file is not part of the worktree
+		state, err := utils.InspectWorkState(ctx, result.Dir)
+		assert.NoError(t, err)
+		assert.True(t, state.Clean())
+	})
+
+	t.Run("claim leased replica", func(t *testing.T) {
+		_, err := claim("a", "bob", time.Hour, false, now)
+		var leased *handlers.LeasedError
+		assert.ErrorAs(t, err, &leased)
+		assert.Equal(t, "alice", leased.Lease.Owner)
+
+		// Renewing the own lease
+		_, err = claim("a", "alice", 2*time.Hour, false, now.Add(time.Minute))
+		assert.NoError(t, err)
+		lease, err := handlers.ReadLease(filepath.Join(repoDir, "a"))
+		assert.NoError(t, err)
+		assert.True(t, lease.ExpiresAt.Equal(now.Add(time.Minute+2*time.Hour)))
+	})
+
+	t.Run("claim first free replica", func(t *testing.T) {
+		result, err := claim("", "bob", 0, false, now)
+		assert.NoError(t, err)
+		assert.Equal(t, "b", result.Name)
+		assert.True(t, result.Lease.ExpiresAt.IsZero())
+
+		_, err = claim("", "carol", 0, false, now)
+		assert.ErrorContains(t, err, "no free replica")
+	})
+
+	t.Run("expired lease is reclaimable", func(t *testing.T) {
+		later := now.Add(3 * time.Hour)
+		result, err := claim("", "carol", time.Hour, false, later)
+		assert.NoError(t, err)
+		assert.Equal(t, "a", result.Name)
+	})
+
+	t.Run("force", func(t *testing.T) {
+		_, err := claim("b", "dave", time.Hour, true, now)
+		assert.NoError(t, err)
+		lease, err := handlers.ReadLease(filepath.Join(repoDir, "b"))
+		assert.NoError(t, err)
+		assert.Equal(t, "dave", lease.Owner)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := claim("base", "alice", 0, false, now)
+		assert.Error(t, err)
+		_, err = claim("missing", "alice", 0, false, now)
+		assert.Error(t, err)
+		_, err = claim("a", "", 0, false, now)
+		assert.Error(t, err)
+	})
+}
+
+func TestRelease(t *testing.T) {
+	origin := newTestOrigin(t)
+	repoDir := filepath.Join(t.TempDir(), "github.com", "owner", "repo")
+	dir := filepath.Join(repoDir, "a")
+	cloneTestRepo(t, origin, dir)
+	setTestRemoteURL(t, dir, "https://github.com/owner/repo.git")
+	now := time.Now()
+
+	_, err := handlers.Release(handlers.ReleaseOptions{RepoDir: repoDir, Name: "a", Owner: "alice", Now: now})
+	assert.ErrorContains(t, err, "is not leased")
+
+	_, err = handlers.Claim(context.Background(), handlers.ClaimOptions{RepoDir: repoDir, Name: "a", Owner: "alice", TTL: time.Hour, Now: now})
+	assert.NoError(t, err)
+
+	_, err = handlers.Release(handlers.ReleaseOptions{RepoDir: repoDir, Name: "a", Owner: "bob", Now: now})
+	var leased *handlers.LeasedError
+	assert.ErrorAs(t, err, &leased)
+
+	lease, err := handlers.Release(handlers.ReleaseOptions{RepoDir: repoDir, Name: "a", Owner: "bob", Now: now.Add(2 * time.Hour)})
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", lease.Owner)
+	_, err = os.Stat(handlers.LeasePath(dir))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestLeaseBlocksDeletion(t *testing.T) {
+	origin := newTestOrigin(t)
+	rootDir := t.TempDir()
+	repoDir := filepath.Join(rootDir, "github.com", "owner", "repo")
+	dir := filepath.Join(repoDir, "a")
+	cloneTestRepo(t, origin, dir)
+	setTestRemoteURL(t, dir, "https://github.com/owner/repo.git")
+	_, err := handlers.Claim(context.Background(), handlers.ClaimOptions{RepoDir: repoDir, Name: "a", Owner: "alice", Now: time.Now()})
+	assert.NoError(t, err)
+
+	candidates, err := handlers.PlanGC(context.Background(), handlers.GCOptions{RepoDirs: []string{repoDir}, MaxAge: time.Nanosecond, Now: time.Now().Add(time.Hour)})
+	assert.NoError(t, err)
+	if assert.Len(t, candidates, 1) {
+		assert.Contains(t, candidates[0].Blocked, "leased by alice")
+	}
+
+	opts := handlers.DeleteOptions{GitReplicatorRoot: rootDir, RepoDir: repoDir, BranchName: "a", Owner: "bob"}
+	err = handlers.DeleteBranchDir(context.Background(), opts)
+	var leased *handlers.LeasedError
+	assert.ErrorAs(t, err, &leased)
+	assert.DirExists(t, dir)
+
+	opts.Owner = "alice"
+	assert.NoError(t, handlers.DeleteBranchDir(context.Background(), opts))
+	assert.NoDirExists(t, dir)
+}
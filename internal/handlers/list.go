@@ -4,15 +4,22 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
+	"time"
+
+	"github.com/terakoya76/git-replicator/internal/utils"
 )
 
 type RepoInfo struct {
-	Host  string
-	Owner string
-	Repo  string
-	Path  string
+	Host  string `json:"host"`
+	Owner string `json:"owner"`
+	Repo  string `json:"repo"`
+	// Path is the base directory of the repository.
+	Path string `json:"path"`
 }
 
 // List traverses the baseDir and returns a list of repositories found under the structure baseDir/host/owner/repo/base/.git
@@ -33,8 +40,12 @@ func List(ctx context.Context, baseDir string) ([]RepoInfo, error) {
 		if rel == "." || rel == "" {
 			return nil
 		}
+		// Skip hidden directories such as the trash
+		if strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
 		walkParts := strings.Split(rel, string(filepath.Separator))
-		if len(walkParts) == 4 && walkParts[3] == "base" {
+		if len(walkParts) == 4 && walkParts[3] == utils.BaseDirName {
 			gitDir := filepath.Join(path, ".git")
 			stat, err := os.Stat(gitDir)
 			if err == nil && stat.IsDir() {
@@ -55,3 +66,161 @@ func List(ctx context.Context, baseDir string) ([]RepoInfo, error) {
 	}
 	return repos, nil
 }
+
+const (
+	ListSortName     = "name"
+	ListSortActivity = "activity"
+	ListSortSize     = "size"
+)
+
+// ListSorts lists the values accepted by ListOptions.SortBy.
+var ListSorts = []string{ListSortName, ListSortActivity, ListSortSize}
+
+type ListOptions struct {
+	// Host, Owner and Repo are glob patterns (see path.Match) the repository must match. Empty patterns match everything.
+	Host  string
+	Owner string
+	Repo  string
+	// SortBy is one of ListSorts. Activity sorts the most recently active first, size the largest first.
+	SortBy string
+	// WithReplicas includes the replicas of each repository.
+	WithReplicas bool
+}
+
+// RepoDetail is a repository found by ListRepos.
+type RepoDetail struct {
+	RepoInfo
+	// Root is the git-replicator root the repository was found under.
+	Root string `json:"root"`
+	// Dir is the repository directory holding base and the replicas.
+	Dir string `json:"dir"`
+	// LastActivity and Size cover base and all replicas. Each is only set when sorting by it, and so are those of the replicas.
+	LastActivity time.Time      `json:"last_activity,omitzero"`
+	Size         int64          `json:"size,omitempty"`
+	Replicas     []ReplicaUsage `json:"replicas,omitempty"`
+	// Error reports why the replicas or their usage could not be read.
+	Error string `json:"error,omitempty"`
+}
+
+// ListRepos returns the repositories under every directory of rootDirs that match the filters in opts, sorted by opts.SortBy.
+func ListRepos(ctx context.Context, rootDirs []string, opts ListOptions) ([]RepoDetail, error) {
+	sortBy := opts.SortBy
+	if sortBy == "" {
+		sortBy = ListSortName
+	}
+	if !slices.Contains(ListSorts, sortBy) {
+		return nil, fmt.Errorf("unsupported sort: %s (supported: %s)", sortBy, strings.Join(ListSorts, ", "))
+	}
+	for _, pattern := range []string{opts.Host, opts.Owner, opts.Repo} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+
+	var details []RepoDetail
+	for _, rootDir := range rootDirs {
+		repos, err := List(ctx, rootDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, repo := range repos {
+			if !matchPattern(opts.Host, repo.Host) || !matchPattern(opts.Owner, repo.Owner) || !matchPattern(opts.Repo, repo.Repo) {
+				continue
+			}
+			detail := RepoDetail{RepoInfo: repo, Root: rootDir, Dir: filepath.Dir(repo.Path)}
+			if opts.WithReplicas || sortBy != ListSortName {
+				// A broken repository is reported along with the others
+				if err := fillRepoUsage(ctx, &detail, sortBy, opts.WithReplicas); err != nil {
+					detail.Error = err.Error()
+				}
+			}
+			details = append(details, detail)
+		}
+	}
+
+	sort.SliceStable(details, func(i, j int) bool {
+		a, b := details[i], details[j]
+		switch sortBy {
+		case ListSortActivity:
+			return a.LastActivity.After(b.LastActivity)
+		case ListSortSize:
+			return a.Size > b.Size
+		default:
+			return a.Dir < b.Dir
+		}
+	})
+	for _, detail := range details {
+		sortReplicaUsages(detail.Replicas, sortBy)
+	}
+	return details, nil
+}
+
+// fillRepoUsage sets the last activity or size of detail from its base and replicas, depending on sortBy, and its replicas if withReplicas is set.
+func fillRepoUsage(ctx context.Context, detail *RepoDetail, sortBy string, withReplicas bool) error {
+	base, err := listReplicaUsage(detail.Dir, utils.BaseDirName, sortBy)
+	if err != nil {
+		return err
+	}
+	detail.LastActivity, detail.Size = base.LastActivity(), base.Size
+	replicas, err := listReplicas(ctx, detail.Dir)
+	if err != nil {
+		return err
+	}
+	for _, branch := range replicas {
+		usage, err := listReplicaUsage(detail.Dir, branch, sortBy)
+		if err != nil {
+			return err
+		}
+		if usage.LastActivity().After(detail.LastActivity) {
+			detail.LastActivity = usage.LastActivity()
+		}
+		detail.Size += usage.Size
+		if withReplicas {
+			detail.Replicas = append(detail.Replicas, usage)
+		}
+	}
+	return nil
+}
+
+// listReplicaUsage returns the usage of the branch directory of repoDir needed to sort by sortBy, skipping the costly walks otherwise.
+func listReplicaUsage(repoDir, branch, sortBy string) (ReplicaUsage, error) {
+	dir := filepath.Join(repoDir, branch)
+	usage := ReplicaUsage{RepoDir: repoDir, Branch: branch, Dir: dir}
+	var err error
+	switch sortBy {
+	case ListSortActivity:
+		if usage.LastCommit, err = utils.LastCommitTime(dir); err != nil {
+			return usage, err
+		}
+		if usage.LastModified, err = utils.LastModified(dir); err != nil {
+			return usage, err
+		}
+	case ListSortSize:
+		if usage.Size, err = utils.DirSize(dir); err != nil {
+			return usage, err
+		}
+	}
+	return usage, nil
+}
+
+func sortReplicaUsages(usages []ReplicaUsage, sortBy string) {
+	sort.SliceStable(usages, func(i, j int) bool {
+		a, b := usages[i], usages[j]
+		switch sortBy {
+		case ListSortActivity:
+			return a.LastActivity().After(b.LastActivity())
+		case ListSortSize:
+			return a.Size > b.Size
+		default:
+			return a.Branch < b.Branch
+		}
+	})
+}
+
+func matchPattern(pattern, name string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
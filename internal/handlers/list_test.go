@@ -4,8 +4,12 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/stretchr/testify/assert"
 	"github.com/terakoya76/git-replicator/internal/handlers"
 )
@@ -107,3 +111,140 @@ func TestList(t *testing.T) {
 		})
 	}
 }
+
+func TestListRepos(t *testing.T) {
+	now := time.Now()
+	day := 24 * time.Hour
+	rootDir := t.TempDir()
+
+	// newRepo creates a repository under rootDir whose base was last active age ago
+	newRepo := func(host, owner, name string, age time.Duration) string {
+		origin := filepath.Join(t.TempDir(), "origin")
+		cloneTestRepo(t, newTestOrigin(t), origin)
+		commitTestFileAt(t, origin, "old.txt", "old\n", now.Add(-age))
+		repoDir := filepath.Join(rootDir, host, owner, name)
+		cloneTestRepo(t, origin, filepath.Join(repoDir, "base"))
+		touchTestTree(t, filepath.Join(repoDir, "base"), now.Add(-age))
+		return repoDir
+	}
+	active := newRepo("github.com", "alice", "active", 1*day)
+	stale := newRepo("github.com", "alice", "stale", 30*day)
+	other := newRepo("gitlab.com", "bob", "tool", 10*day)
+
+	// A large replica makes stale the biggest repository, and a fresh replica of other makes it the most recently active
+	large := filepath.Join(stale, "large")
+	cloneTestRepo(t, filepath.Join(stale, "base"), large)
+	setTestRemoteURL(t, large, "https://github.com/alice/stale.git")
+	writeTestFile(t, filepath.Join(large, "blob.bin"), strings.Repeat("x", 1<<20))
+	touchTestTree(t, large, now.Add(-30*day))
+	for _, branch := range []string{"fresh", "older"} {
+		dir := filepath.Join(other, branch)
+		cloneTestRepo(t, filepath.Join(other, "base"), dir)
+		setTestRemoteURL(t, dir, "https://gitlab.com/bob/tool.git")
+	}
+	touchTestTree(t, filepath.Join(other, "older"), now.Add(-20*day))
+	commitTestFile(t, filepath.Join(other, "fresh"), "new.txt", "new\n")
+
+	dirsOf := func(repos []handlers.RepoDetail) []string {
+		var dirs []string
+		for _, r := range repos {
+			dirs = append(dirs, r.Dir)
+		}
+		return dirs
+	}
+
+	tests := []struct {
+		name    string
+		opts    handlers.ListOptions
+		want    []string
+		wantErr bool
+	}{
+		{name: "all by name", opts: handlers.ListOptions{}, want: []string{active, stale, other}},
+		{name: "host filter", opts: handlers.ListOptions{Host: "gitlab.*"}, want: []string{other}},
+		{name: "owner and repo filter", opts: handlers.ListOptions{Owner: "alice", Repo: "st*"}, want: []string{stale}},
+		{name: "no match", opts: handlers.ListOptions{Repo: "missing"}, want: nil},
+		{name: "by activity", opts: handlers.ListOptions{SortBy: handlers.ListSortActivity}, want: []string{other, active, stale}},
+		{name: "by size", opts: handlers.ListOptions{SortBy: handlers.ListSortSize}, want: []string{stale, other, active}},
+		{name: "invalid sort", opts: handlers.ListOptions{SortBy: "color"}, wantErr: true},
+		{name: "invalid pattern", opts: handlers.ListOptions{Host: "["}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repos, err := handlers.ListRepos(context.Background(), []string{rootDir}, tt.opts)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, dirsOf(repos))
+			for _, r := range repos {
+				assert.Empty(t, r.Replicas)
+			}
+		})
+	}
+
+	t.Run("multiple roots", func(t *testing.T) {
+		otherRoot := t.TempDir()
+		work := filepath.Join(otherRoot, "github.example.com", "team", "service")
+		cloneTestRepo(t, newTestOrigin(t), filepath.Join(work, "base"))
+
+		repos, err := handlers.ListRepos(context.Background(), []string{rootDir, otherRoot}, handlers.ListOptions{Owner: "[bt]*"})
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{other, work}, dirsOf(repos))
+		for _, r := range repos {
+			if r.Dir == work {
+				assert.Equal(t, otherRoot, r.Root)
+			} else {
+				assert.Equal(t, rootDir, r.Root)
+			}
+		}
+	})
+
+	t.Run("with replicas", func(t *testing.T) {
+		repos, err := handlers.ListRepos(context.Background(), []string{rootDir}, handlers.ListOptions{Owner: "bob", SortBy: handlers.ListSortActivity, WithReplicas: true})
+		assert.NoError(t, err)
+		if assert.Len(t, repos, 1) {
+			assert.Equal(t, filepath.Join(other, "base"), repos[0].Path)
+			var branches []string
+			for _, replica := range repos[0].Replicas {
+				branches = append(branches, replica.Branch)
+			}
+			assert.Equal(t, []string{"fresh", "older"}, branches)
+			assert.False(t, repos[0].LastActivity.IsZero())
+			// Sizes are only computed to sort by them
+			assert.Zero(t, repos[0].Size)
+		}
+	})
+
+	t.Run("with replicas by name", func(t *testing.T) {
+		repos, err := handlers.ListRepos(context.Background(), []string{rootDir}, handlers.ListOptions{Owner: "bob", WithReplicas: true})
+		assert.NoError(t, err)
+		if assert.Len(t, repos, 1) {
+			assert.Len(t, repos[0].Replicas, 2)
+			assert.True(t, repos[0].LastActivity.IsZero())
+			assert.Zero(t, repos[0].Size)
+		}
+	})
+
+	t.Run("broken repository is reported inline", func(t *testing.T) {
+		otherRoot := t.TempDir()
+		good := filepath.Join(otherRoot, "github.com", "alice", "good")
+		cloneTestRepo(t, newTestOrigin(t), filepath.Join(good, "base"))
+		broken := filepath.Join(otherRoot, "github.com", "alice", "broken")
+		brokenRepo, err := git.PlainInit(filepath.Join(broken, "base"), false)
+		assert.NoError(t, err)
+		// HEAD points at a commit that does not exist
+		ref := plumbing.NewHashReference(plumbing.Master, plumbing.NewHash("1111111111111111111111111111111111111111"))
+		assert.NoError(t, brokenRepo.Storer.SetReference(ref))
+
+		repos, err := handlers.ListRepos(context.Background(), []string{otherRoot}, handlers.ListOptions{SortBy: handlers.ListSortActivity})
+		assert.NoError(t, err)
+		if assert.Len(t, repos, 2) {
+			assert.Equal(t, good, repos[0].Dir)
+			assert.Empty(t, repos[0].Error)
+			assert.Equal(t, broken, repos[1].Dir)
+			assert.NotEmpty(t, repos[1].Error)
+		}
+	})
+}
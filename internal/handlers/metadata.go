@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+)
+
+const (
+	MetadataStatusActive  = "active"
+	MetadataStatusPushed  = "pushed"
+	MetadataStatusDeleted = "deleted"
+)
+
+// ReplicaMetadata records what a replica is for. It is kept in <replica>/.git/git-replicator/metadata.json.
+type ReplicaMetadata struct {
+	CreatedAt time.Time `json:"created_at,omitzero"`
+	CreatedBy string    `json:"created_by,omitempty"`
+	// SourceRef and SourceCommit are the branch and commit the replica was created from.
+	SourceRef    string    `json:"source_ref,omitempty"`
+	SourceCommit string    `json:"source_commit,omitempty"`
+	Task         string    `json:"task,omitempty"`
+	Labels       []string  `json:"labels,omitempty"`
+	Status       string    `json:"status,omitempty"`
+	UpdatedAt    time.Time `json:"updated_at,omitzero"`
+}
+
+// MetadataPath returns the path of the metadata file of the replica at dir.
+func MetadataPath(dir string) string {
+	return filepath.Join(ReplicaStateDir(dir), "metadata.json")
+}
+
+// ReadMetadata returns the metadata of the replica at dir, or empty metadata if it has none.
+func ReadMetadata(dir string) (ReplicaMetadata, error) {
+	var meta ReplicaMetadata
+	data, err := os.ReadFile(MetadataPath(dir))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return meta, nil
+		}
+		return meta, fmt.Errorf("failed to read metadata: %w", err)
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return meta, fmt.Errorf("failed to parse metadata %s: %w", MetadataPath(dir), err)
+	}
+	return meta, nil
+}
+
+// WriteMetadata replaces the metadata of the replica at dir.
+func WriteMetadata(dir string, meta ReplicaMetadata) error {
+	path := MetadataPath(dir)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write metadata: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write metadata: %w", err)
+	}
+	return nil
+}
+
+// UpdateMetadata applies update to the metadata of the replica at dir and stamps it with now.
+func UpdateMetadata(dir string, now time.Time, update func(meta *ReplicaMetadata)) error {
+	meta, err := ReadMetadata(dir)
+	if err != nil {
+		return err
+	}
+	update(&meta)
+	meta.UpdatedAt = now
+	return WriteMetadata(dir, meta)
+}
+
+// MetadataUpdate describes changes to the metadata of a replica. Nil fields are left unchanged.
+type MetadataUpdate struct {
+	Task         *string
+	Status       *string
+	AddLabels    []string
+	RemoveLabels []string
+}
+
+// Apply applies u to meta. Labels are kept sorted and unique.
+func (u MetadataUpdate) Apply(meta *ReplicaMetadata) {
+	if u.Task != nil {
+		meta.Task = *u.Task
+	}
+	if u.Status != nil {
+		meta.Status = *u.Status
+	}
+	labels := slices.DeleteFunc(append(meta.Labels, u.AddLabels...), func(label string) bool {
+		return slices.Contains(u.RemoveLabels, label)
+	})
+	slices.Sort(labels)
+	meta.Labels = slices.Compact(labels)
+}
+
+// SetMetadata applies u to the metadata of an existing replica of repoDir and returns the result.
+func SetMetadata(repoDir, name string, u MetadataUpdate, now time.Time) (ReplicaMetadata, error) {
+	dir, err := resolveExistingReplica(repoDir, name, true)
+	if err != nil {
+		return ReplicaMetadata{}, err
+	}
+	if err := UpdateMetadata(dir, now, u.Apply); err != nil {
+		return ReplicaMetadata{}, err
+	}
+	return ReadMetadata(dir)
+}
+
+// newReplicaMetadata returns the metadata of a replica freshly cloned into dir, before its branch is switched.
+func newReplicaMetadata(dir, creator, task string, labels []string, now time.Time) ReplicaMetadata {
+	meta := ReplicaMetadata{CreatedAt: now, CreatedBy: creator, Task: task, Status: MetadataStatusActive, UpdatedAt: now}
+	MetadataUpdate{AddLabels: labels}.Apply(&meta)
+	if repo, err := git.PlainOpen(dir); err == nil {
+		if head, err := repo.Head(); err == nil {
+			meta.SourceRef = head.Name().Short()
+			meta.SourceCommit = head.Hash().String()
+		}
+	}
+	return meta
+}
+
+// GetMetadata returns the metadata of an existing replica of repoDir.
+func GetMetadata(repoDir, name string) (ReplicaMetadata, error) {
+	dir, err := resolveExistingReplica(repoDir, name, true)
+	if err != nil {
+		return ReplicaMetadata{}, err
+	}
+	return ReadMetadata(dir)
+}
@@ -0,0 +1,161 @@
+package handlers_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+func TestMetadataUpdateApply(t *testing.T) {
+	task, status := "fix login", "review"
+	tests := []struct {
+		name   string
+		meta   handlers.ReplicaMetadata
+		update handlers.MetadataUpdate
+		want   handlers.ReplicaMetadata
+	}{
+		{
+			name:   "no changes",
+			meta:   handlers.ReplicaMetadata{Task: "t", Status: "active", Labels: []string{"a"}},
+			update: handlers.MetadataUpdate{},
+			want:   handlers.ReplicaMetadata{Task: "t", Status: "active", Labels: []string{"a"}},
+		},
+		{
+			name:   "set task and status",
+			meta:   handlers.ReplicaMetadata{Task: "t", Status: "active"},
+			update: handlers.MetadataUpdate{Task: &task, Status: &status},
+			want:   handlers.ReplicaMetadata{Task: task, Status: status},
+		},
+		{
+			name:   "labels are sorted and unique",
+			meta:   handlers.ReplicaMetadata{Labels: []string{"b", "x"}},
+			update: handlers.MetadataUpdate{AddLabels: []string{"a", "b", "c"}, RemoveLabels: []string{"x", "c"}},
+			want:   handlers.ReplicaMetadata{Labels: []string{"a", "b"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.update.Apply(&tt.meta)
+			assert.Equal(t, tt.want, tt.meta)
+		})
+	}
+}
+
+func TestReplicaMetadata(t *testing.T) {
+	origin := newTestOrigin(t)
+	rootDir := t.TempDir()
+	repoDir := filepath.Join(rootDir, "github.com", "owner", "repo")
+	baseDir := filepath.Join(repoDir, "base")
+	cloneTestRepo(t, origin, baseDir)
+	setTestRemoteURL(t, baseDir, "https://github.com/owner/repo.git")
+	ctx := context.Background()
+
+	opts := handlers.SwitchOptions{
+		RepoDir:           repoDir,
+		BranchName:        "feature",
+		GitReplicatorRoot: rootDir,
+		Creator:           "alice",
+		Task:              "add metadata",
+		Labels:            []string{"v2", "agent"},
+	}
+	getRemoteURL := func(string, string) (string, error) { return origin, nil }
+	cloneFunc := func(ctx context.Context, url, dir string) error {
+		cloneTestRepo(t, url, dir)
+		setTestRemoteURL(t, dir, "https://github.com/owner/repo.git")
+		return nil
+	}
+	before := time.Now()
+	assert.NoError(t, handlers.Switch(ctx, opts, getRemoteURL, cloneFunc, utils.DefaultSwitchBranchFunc))
+	dir := filepath.Join(repoDir, "feature")
+
+	meta, err := handlers.GetMetadata(repoDir, "feature")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", meta.CreatedBy)
+	assert.Equal(t, "add metadata", meta.Task)
+	assert.Equal(t, []string{"agent", "v2"}, meta.Labels)
+	assert.Equal(t, handlers.MetadataStatusActive, meta.Status)
+	assert.Equal(t, "main", meta.SourceRef)
+	assert.Len(t, meta.SourceCommit, 40)
+	assert.False(t, meta.CreatedAt.Before(before))
+
+	state, err := utils.InspectWorkState(ctx, dir)
+	assert.NoError(t, err)
+	assert.True(t, state.Clean(), "metadata must not show up in the worktree")
+
+	t.Run("branch and status show metadata", func(t *testing.T) {
+		infos, err := handlers.DescribeBranchDirs(ctx, repoDir)
+		assert.NoError(t, err)
+		tasks := map[string]string{}
+		for _, info := range infos {
+			tasks[info.Name] = info.Task
+		}
+		assert.Equal(t, map[string]string{"base": "", "feature": "add metadata"}, tasks)
+
+		statuses, err := handlers.Status(ctx, handlers.StatusOptions{RepoDir: repoDir, Jobs: 1})
+		assert.NoError(t, err)
+		for _, s := range statuses {
+			if s.Name == "feature" {
+				assert.Equal(t, handlers.MetadataStatusActive, s.ReplicaMetadata.Status)
+			}
+		}
+	})
+
+	t.Run("set", func(t *testing.T) {
+		status := "review"
+		meta, err := handlers.SetMetadata(repoDir, "feature", handlers.MetadataUpdate{Status: &status, RemoveLabels: []string{"v2"}}, time.Now())
+		assert.NoError(t, err)
+		assert.Equal(t, "review", meta.Status)
+		assert.Equal(t, []string{"agent"}, meta.Labels)
+		assert.Equal(t, "add metadata", meta.Task)
+
+		_, err = handlers.SetMetadata(repoDir, "missing", handlers.MetadataUpdate{Status: &status}, time.Now())
+		assert.Error(t, err)
+	})
+
+	t.Run("push marks active replicas as pushed", func(t *testing.T) {
+		status := handlers.MetadataStatusActive
+		_, err := handlers.SetMetadata(repoDir, "feature", handlers.MetadataUpdate{Status: &status}, time.Now())
+		assert.NoError(t, err)
+		pushFunc := func(context.Context, string, string, bool) error { return nil }
+		_, err = handlers.Push(ctx, handlers.PushOptions{RepoDir: repoDir, Replicas: []string{"feature"}}, pushFunc)
+		assert.NoError(t, err)
+		meta, err := handlers.ReadMetadata(dir)
+		assert.NoError(t, err)
+		assert.Equal(t, handlers.MetadataStatusPushed, meta.Status)
+	})
+
+	t.Run("failed delete keeps the status", func(t *testing.T) {
+		// Another root whose trash cannot be created
+		otherRoot := t.TempDir()
+		writeTestFile(t, filepath.Join(otherRoot, handlers.TrashDirName), "not a directory\n")
+		err := handlers.DeleteBranchDir(ctx, handlers.DeleteOptions{GitReplicatorRoot: otherRoot, RepoDir: repoDir, BranchName: "feature", Force: true})
+		assert.Error(t, err)
+		meta, err := handlers.ReadMetadata(dir)
+		assert.NoError(t, err)
+		assert.Equal(t, handlers.MetadataStatusPushed, meta.Status)
+	})
+
+	t.Run("delete and restore", func(t *testing.T) {
+		err := handlers.DeleteBranchDir(ctx, handlers.DeleteOptions{GitReplicatorRoot: rootDir, RepoDir: repoDir, BranchName: "feature", Force: true})
+		assert.NoError(t, err)
+		entries, err := handlers.ListTrash(ctx, rootDir)
+		assert.NoError(t, err)
+		if assert.Len(t, entries, 1) {
+			meta, err := handlers.ReadMetadata(filepath.Join(entries[0].Path, "replica"))
+			assert.NoError(t, err)
+			assert.Equal(t, handlers.MetadataStatusDeleted, meta.Status)
+		}
+
+		_, err = handlers.Restore(ctx, handlers.RestoreOptions{GitReplicatorRoot: rootDir, RepoDir: repoDir, BranchName: "feature"})
+		assert.NoError(t, err)
+		meta, err := handlers.ReadMetadata(dir)
+		assert.NoError(t, err)
+		assert.Equal(t, handlers.MetadataStatusActive, meta.Status)
+		assert.Equal(t, "add metadata", meta.Task)
+	})
+}
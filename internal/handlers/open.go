@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/terakoya76/git-replicator/internal/config"
+)
+
+type OpenOptions struct {
+	RepoDir string
+	Name    string
+	Profile config.Profile
+	// Stdin, Stdout and Stderr are connected to the command, e.g. the terminal for interactive agents.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// agentCommand is the command of a profile prepared for a replica.
+type agentCommand struct {
+	Command string
+	Dir     string
+	// Env holds the KEY=VALUE pairs added to the environment, including ExecReplicaEnv.
+	Env []string
+}
+
+// Open runs the command of opts.Profile for the replica opts.Name of opts.RepoDir in the foreground and waits for it to exit.
+func Open(ctx context.Context, opts OpenOptions) error {
+	dir, err := resolveExistingReplica(opts.RepoDir, opts.Name, true)
+	if err != nil {
+		return err
+	}
+	if err := opts.Profile.Validate(); err != nil {
+		return err
+	}
+	agent, err := prepareAgent(opts.RepoDir, dir, opts.Profile)
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, "sh", "-c", agent.Command)
+	cmd.Dir = agent.Dir
+	cmd.Env = append(os.Environ(), agent.Env...)
+	cmd.Stdin = opts.Stdin
+	cmd.Stdout = opts.Stdout
+	cmd.Stderr = opts.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to run %q in %s: %w", agent.Command, agent.Dir, err)
+	}
+	return nil
+}
+
+// prepareAgent renders the command of profile for the replica name at dir.
+func prepareAgent(repoDir, dir string, profile config.Profile) (agentCommand, error) {
+	name := filepath.Base(dir)
+	data := config.ProfileData{Name: name, Dir: dir, RepoDir: repoDir}
+	if repo, err := git.PlainOpen(dir); err == nil {
+		if head, err := repo.Head(); err == nil && head.Name().IsBranch() {
+			data.Branch = head.Name().Short()
+		}
+	}
+	meta, err := ReadMetadata(dir)
+	if err != nil {
+		return agentCommand{}, err
+	}
+	data.Task = meta.Task
+
+	command, err := profile.Render(data)
+	if err != nil {
+		return agentCommand{}, err
+	}
+	env := append([]string{ExecReplicaEnv + "=" + name}, profile.Env...)
+	return agentCommand{Command: command, Dir: profile.WorkingDir(data), Env: env}, nil
+}
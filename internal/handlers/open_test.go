@@ -0,0 +1,88 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/terakoya76/git-replicator/internal/config"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+)
+
+func TestOpen(t *testing.T) {
+	origin := newTestOrigin(t)
+	repoDir := filepath.Join(t.TempDir(), "github.com", "owner", "repo")
+	dir := filepath.Join(repoDir, "feature")
+	cloneTestRepo(t, origin, dir)
+	setTestRemoteURL(t, dir, "https://github.com/owner/repo.git")
+	task := "review the diff"
+	_, err := handlers.SetMetadata(repoDir, "feature", handlers.MetadataUpdate{Task: &task}, time.Now())
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		replica string
+		profile config.Profile
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "template and env",
+			replica: "feature",
+			profile: config.Profile{Command: `echo "{{.Name}} {{.Branch}} {{.Task}} $GIT_REPLICATOR_REPLICA $MODE"`, Env: []string{"MODE=plan"}},
+			want:    "feature main review the diff feature plan\n",
+		},
+		{
+			name:    "replica workdir",
+			replica: "feature",
+			profile: config.Profile{Command: "pwd"},
+			want:    dir + "\n",
+		},
+		{
+			name:    "repo workdir",
+			replica: "feature",
+			profile: config.Profile{Command: "pwd", Workdir: config.WorkdirRepo},
+			want:    repoDir + "\n",
+		},
+		{
+			name:    "failing command",
+			replica: "feature",
+			profile: config.Profile{Command: "exit 1"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid profile",
+			replica: "feature",
+			profile: config.Profile{},
+			wantErr: true,
+		},
+		{
+			name:    "missing replica",
+			replica: "missing",
+			profile: config.Profile{Command: "true"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := handlers.Open(context.Background(), handlers.OpenOptions{
+				RepoDir: repoDir,
+				Name:    tt.replica,
+				Profile: tt.profile,
+				Stdin:   strings.NewReader(""),
+				Stdout:  &out,
+			})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, out.String())
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+// FetchFunc defines a function type for fetching origin in a checkout
+// This allows for dependency injection in tests
+type FetchFunc func(ctx context.Context, dir string) error
+
+type PruneOptions struct {
+	RepoDir string
+	// Fetch fetches origin in base and every replica first, so that branches deleted on the remote are detected.
+	Fetch bool
+	// Owner is the lease owner pruning the replicas; candidates leased by anyone else are blocked unless Force is set.
+	Owner string
+	Force bool
+}
+
+// PruneCandidate is a replica whose work is finished and that can be deleted.
+type PruneCandidate struct {
+	Branch string `json:"branch"`
+	Dir    string `json:"dir"`
+	Reason string `json:"reason"`
+	// Blocked is the lease of another owner that keeps the candidate from being deleted.
+	Blocked string `json:"blocked,omitempty"`
+}
+
+const (
+	PruneReasonMerged        = "merged into base"
+	PruneReasonRemoteDeleted = "branch deleted on remote"
+)
+
+// FindPrunable returns the replicas of opts.RepoDir whose branch has been merged into the base branch or whose upstream branch has been deleted on the remote.
+// Replicas still pointing at the commit they were created from, or at the tip of base when that commit is not recorded, have no work of their own yet and are left alone.
+func FindPrunable(ctx context.Context, opts PruneOptions, fetchFunc FetchFunc) ([]PruneCandidate, error) {
+	baseDir := filepath.Join(opts.RepoDir, utils.BaseDirName)
+	if opts.Fetch {
+		if err := fetchFunc(ctx, baseDir); err != nil {
+			return nil, err
+		}
+	}
+	base, err := git.PlainOpen(baseDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open base repo: %w", err)
+	}
+	baseHead, err := base.Head()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get base HEAD: %w", err)
+	}
+	baseTips := []plumbing.Hash{baseHead.Hash()}
+	if upstream, err := base.Reference(plumbing.NewRemoteReferenceName(git.DefaultRemoteName, baseHead.Name().Short()), true); err == nil {
+		baseTips = append(baseTips, upstream.Hash())
+	}
+	merged, err := utils.ReachableCommits(ctx, base, baseTips...)
+	if err != nil {
+		return nil, err
+	}
+
+	replicas, err := listReplicas(ctx, opts.RepoDir)
+	if err != nil {
+		return nil, err
+	}
+	var candidates []PruneCandidate
+	for _, branch := range replicas {
+		dir := filepath.Join(opts.RepoDir, branch)
+		if opts.Fetch {
+			if err := fetchFunc(ctx, dir); err != nil {
+				return nil, err
+			}
+		}
+		reason, err := pruneReason(dir, baseTips, merged)
+		if err != nil {
+			return nil, err
+		}
+		if reason == "" {
+			continue
+		}
+		c := PruneCandidate{Branch: branch, Dir: dir, Reason: reason}
+		if !opts.Force {
+			c.Blocked = leaseBlockedReason(dir, opts.Owner, time.Now())
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates, nil
+}
+
+// pruneReason returns why the replica at dir can be pruned, or "" if it cannot.
+func pruneReason(dir string, baseTips []plumbing.Hash, merged map[plumbing.Hash]bool) (string, error) {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to open repo %s: %w", dir, err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return "", fmt.Errorf("failed to get HEAD of %s: %w", dir, err)
+	}
+
+	if head.Name().IsBranch() {
+		cfg, err := repo.Config()
+		if err != nil {
+			return "", fmt.Errorf("failed to read config of %s: %w", dir, err)
+		}
+		if b, ok := cfg.Branches[head.Name().Short()]; ok && b.Remote != "" && b.Merge.IsBranch() {
+			upstream := plumbing.NewRemoteReferenceName(b.Remote, b.Merge.Short())
+			if _, err := repo.Reference(upstream, false); err == plumbing.ErrReferenceNotFound {
+				return PruneReasonRemoteDeleted, nil
+			}
+		}
+	}
+
+	// A replica has no work of its own until it moves past the commit it was created from.
+	// Without metadata recording that commit, a replica at a tip of base is assumed to be new.
+	meta, err := ReadMetadata(dir)
+	if err != nil {
+		return "", err
+	}
+	if meta.SourceCommit == head.Hash().String() {
+		return "", nil
+	}
+	if meta.SourceCommit == "" && slices.Contains(baseTips, head.Hash()) {
+		return "", nil
+	}
+	if merged[head.Hash()] {
+		return PruneReasonMerged, nil
+	}
+	return "", nil
+}
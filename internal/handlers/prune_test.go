@@ -0,0 +1,139 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/stretchr/testify/assert"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+)
+
+// checkoutTestBranch creates branch at hash in the checkout at dir and switches to it.
+func checkoutTestBranch(t *testing.T, dir, branch string, hash plumbing.Hash) {
+	t.Helper()
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatalf("failed to open repo: %v", err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("failed to get worktree: %v", err)
+	}
+	if err := wt.Checkout(&git.CheckoutOptions{Hash: hash, Branch: plumbing.NewBranchReferenceName(branch), Create: true}); err != nil {
+		t.Fatalf("failed to checkout %s: %v", branch, err)
+	}
+}
+
+func TestFindPrunable(t *testing.T) {
+	origin := newTestOrigin(t)
+	repo, err := git.PlainOpen(origin)
+	assert.NoError(t, err)
+	head, err := repo.Head()
+	assert.NoError(t, err)
+	first := head.Hash()
+	second := commitTestFile(t, origin, "second.txt", "second\n")
+
+	repoDir := filepath.Join(t.TempDir(), "github.com", "owner", "repo")
+	cloneTestRepo(t, origin, filepath.Join(repoDir, "base"))
+	newReplica := func(branch string) string {
+		dir := filepath.Join(repoDir, branch)
+		cloneTestRepo(t, origin, dir)
+		setTestRemoteURL(t, dir, "https://github.com/owner/repo.git")
+		return dir
+	}
+
+	merged := newReplica("merged")
+	checkoutTestBranch(t, merged, "merged", first)
+
+	newReplica("fresh")
+
+	// Created from an older base commit, without commits of its own
+	stale := newReplica("stale")
+	checkoutTestBranch(t, stale, "stale", first)
+	assert.NoError(t, handlers.WriteMetadata(stale, handlers.ReplicaMetadata{SourceCommit: first.String()}))
+
+	// Created from first, with work that was fast-forward merged into base
+	fastForward := newReplica("fast-forward")
+	checkoutTestBranch(t, fastForward, "fast-forward", second)
+	assert.NoError(t, handlers.WriteMetadata(fastForward, handlers.ReplicaMetadata{SourceCommit: first.String()}))
+
+	diverged := newReplica("diverged")
+	checkoutTestBranch(t, diverged, "diverged", second)
+	commitTestFile(t, diverged, "work.txt", "work\n")
+
+	gone := newReplica("gone")
+	checkoutTestBranch(t, gone, "gone", second)
+	goneRepo, err := git.PlainOpen(gone)
+	assert.NoError(t, err)
+	cfg, err := goneRepo.Config()
+	assert.NoError(t, err)
+	cfg.Branches["gone"] = &config.Branch{Name: "gone", Remote: "origin", Merge: plumbing.NewBranchReferenceName("gone")}
+	assert.NoError(t, goneRepo.SetConfig(cfg))
+
+	assert.NoError(t, os.MkdirAll(filepath.Join(repoDir, "junk"), 0o755))
+
+	t.Run("find merged and remote-deleted replicas", func(t *testing.T) {
+		candidates, err := handlers.FindPrunable(context.Background(), handlers.PruneOptions{RepoDir: repoDir}, nil)
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []handlers.PruneCandidate{
+			{Branch: "gone", Dir: gone, Reason: handlers.PruneReasonRemoteDeleted},
+			{Branch: "merged", Dir: merged, Reason: handlers.PruneReasonMerged},
+			{Branch: "fast-forward", Dir: fastForward, Reason: handlers.PruneReasonMerged},
+		}, candidates)
+	})
+
+	t.Run("leases of other owners block", func(t *testing.T) {
+		_, err := handlers.Claim(context.Background(), handlers.ClaimOptions{RepoDir: repoDir, Name: "merged", Owner: "agent-1", Now: time.Now()})
+		assert.NoError(t, err)
+		t.Cleanup(func() {
+			_, err := handlers.Release(handlers.ReleaseOptions{RepoDir: repoDir, Name: "merged", Owner: "agent-1", Now: time.Now()})
+			assert.NoError(t, err)
+		})
+		blocked := func(opts handlers.PruneOptions) map[string]string {
+			candidates, err := handlers.FindPrunable(context.Background(), opts, nil)
+			assert.NoError(t, err)
+			m := map[string]string{}
+			for _, c := range candidates {
+				m[c.Branch] = c.Blocked
+			}
+			return m
+		}
+
+		got := blocked(handlers.PruneOptions{RepoDir: repoDir, Owner: "agent-2"})
+		assert.Contains(t, got["merged"], "leased by agent-1")
+		assert.Empty(t, got["gone"])
+		assert.Empty(t, blocked(handlers.PruneOptions{RepoDir: repoDir, Owner: "agent-1"})["merged"])
+		assert.Empty(t, blocked(handlers.PruneOptions{RepoDir: repoDir, Owner: "agent-2", Force: true})["merged"])
+	})
+
+	t.Run("fetch every checkout first", func(t *testing.T) {
+		var fetched []string
+		fetchFunc := func(ctx context.Context, dir string) error {
+			fetched = append(fetched, filepath.Base(dir))
+			return nil
+		}
+		_, err := handlers.FindPrunable(context.Background(), handlers.PruneOptions{RepoDir: repoDir, Fetch: true}, fetchFunc)
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{"base", "merged", "fresh", "stale", "fast-forward", "diverged", "gone"}, fetched)
+	})
+
+	t.Run("fetch failure", func(t *testing.T) {
+		fetchFunc := func(ctx context.Context, dir string) error {
+			return errors.New("fetch error")
+		}
+		_, err := handlers.FindPrunable(context.Background(), handlers.PruneOptions{RepoDir: repoDir, Fetch: true}, fetchFunc)
+		assert.EqualError(t, err, "fetch error")
+	})
+
+	t.Run("no base", func(t *testing.T) {
+		_, err := handlers.FindPrunable(context.Background(), handlers.PruneOptions{RepoDir: t.TempDir()}, nil)
+		assert.Error(t, err)
+	})
+}
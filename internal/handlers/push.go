@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+// PushFunc defines a function type for pushing a branch of a checkout to origin
+// This allows for dependency injection in tests
+type PushFunc func(ctx context.Context, dir, branch string, forceWithLease bool) error
+
+type PushOptions struct {
+	RepoDir string
+	// Replicas are the branch directory names to push. All pushes every replica instead.
+	Replicas []string
+	All      bool
+	// ForceWithLease allows non-fast-forward pushes, e.g. after a rebase, as long as the remote branch has not moved since it was last fetched.
+	ForceWithLease bool
+}
+
+const (
+	PushStatusPushed   = "pushed"
+	PushStatusUpToDate = "up to date"
+	PushStatusSkipped  = "skipped"
+	PushStatusFailed   = "failed"
+)
+
+// PushResult is the outcome of pushing the branch of a replica.
+type PushResult struct {
+	Name string `json:"name"`
+	Dir  string `json:"dir"`
+	// Branch is the branch checked out in the replica, which is pushed to the branch of the same name on origin.
+	Branch string `json:"branch"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Warning reports a failure after a successful push, such as recording the upstream or the metadata of the replica.
+	Warning string `json:"warning,omitempty"`
+}
+
+// Push pushes the branch checked out in each selected replica to origin and sets it as the upstream of the branch.
+// Failures are reported in the Error field of each result.
+func Push(ctx context.Context, opts PushOptions, pushFunc PushFunc) ([]PushResult, error) {
+	names := opts.Replicas
+	if opts.All {
+		var err error
+		if names, err = listReplicas(ctx, opts.RepoDir); err != nil {
+			return nil, err
+		}
+	} else if len(names) == 0 {
+		return nil, fmt.Errorf("no replicas to push")
+	}
+	dirs := make([]string, len(names))
+	for i, name := range names {
+		dir, err := resolveExistingReplica(opts.RepoDir, name, false)
+		if err != nil {
+			return nil, err
+		}
+		dirs[i] = dir
+	}
+
+	results := make([]PushResult, 0, len(names))
+	for i, name := range names {
+		r := PushResult{Name: name, Dir: dirs[i]}
+		pushReplica(ctx, &r, opts.ForceWithLease, pushFunc)
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+func pushReplica(ctx context.Context, r *PushResult, forceWithLease bool, pushFunc PushFunc) {
+	repo, err := git.PlainOpen(r.Dir)
+	if err != nil {
+		r.Status, r.Error = PushStatusFailed, fmt.Sprintf("failed to open repo: %s", err)
+		return
+	}
+	head, err := repo.Head()
+	if err != nil {
+		r.Status, r.Error = PushStatusFailed, fmt.Sprintf("failed to get HEAD: %s", err)
+		return
+	}
+	if !head.Name().IsBranch() {
+		r.Status, r.Error = PushStatusSkipped, "HEAD is detached"
+		return
+	}
+	r.Branch = head.Name().Short()
+
+	r.Status = PushStatusPushed
+	if err := pushFunc(ctx, r.Dir, r.Branch, forceWithLease); err != nil {
+		if !errors.Is(err, git.NoErrAlreadyUpToDate) {
+			r.Status, r.Error = PushStatusFailed, err.Error()
+			return
+		}
+		r.Status = PushStatusUpToDate
+	}
+	// The branch is on origin now, so later failures do not fail the push
+	var warnings []string
+	if err := utils.SetUpstream(r.Dir, r.Branch); err != nil {
+		warnings = append(warnings, err.Error())
+	}
+	markPushed := func(meta *ReplicaMetadata) {
+		if meta.Status == "" || meta.Status == MetadataStatusActive {
+			meta.Status = MetadataStatusPushed
+		}
+	}
+	if err := UpdateMetadata(r.Dir, time.Now(), markPushed); err != nil {
+		warnings = append(warnings, err.Error())
+	}
+	r.Warning = strings.Join(warnings, "; ")
+}
@@ -0,0 +1,113 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/stretchr/testify/assert"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+func TestPush(t *testing.T) {
+	origin := newTestOrigin(t)
+	repoDir := filepath.Join(t.TempDir(), "github.com", "owner", "repo")
+	for _, branch := range []string{"base", "feature", "pushed", "broken", "detached"} {
+		dir := filepath.Join(repoDir, branch)
+		repo := cloneTestRepo(t, origin, dir)
+		setTestRemoteURL(t, dir, "https://github.com/owner/repo.git")
+		head, err := repo.Head()
+		if err != nil {
+			t.Fatalf("failed to get HEAD: %v", err)
+		}
+		if branch != "base" {
+			checkoutTestBranch(t, dir, branch, head.Hash())
+		}
+	}
+	if _, err := utils.RunGit(context.Background(), filepath.Join(repoDir, "detached"), "checkout", "--quiet", "--detach"); err != nil {
+		t.Fatalf("failed to detach HEAD: %v", err)
+	}
+
+	type pushCall struct {
+		dir            string
+		branch         string
+		forceWithLease bool
+	}
+	var calls []pushCall
+	pushFunc := func(ctx context.Context, dir, branch string, forceWithLease bool) error {
+		calls = append(calls, pushCall{filepath.Base(dir), branch, forceWithLease})
+		switch filepath.Base(dir) {
+		case "pushed":
+			return git.NoErrAlreadyUpToDate
+		case "broken":
+			return errors.New("permission denied")
+		}
+		return nil
+	}
+
+	t.Run("all replicas", func(t *testing.T) {
+		calls = nil
+		results, err := handlers.Push(context.Background(), handlers.PushOptions{RepoDir: repoDir, All: true, ForceWithLease: true}, pushFunc)
+		assert.NoError(t, err)
+		statuses := map[string]string{}
+		for _, r := range results {
+			statuses[r.Name] = r.Status
+		}
+		assert.Equal(t, map[string]string{
+			"broken":   handlers.PushStatusFailed,
+			"detached": handlers.PushStatusSkipped,
+			"feature":  handlers.PushStatusPushed,
+			"pushed":   handlers.PushStatusUpToDate,
+		}, statuses)
+		assert.ElementsMatch(t, []pushCall{{"broken", "broken", true}, {"feature", "feature", true}, {"pushed", "pushed", true}}, calls)
+
+		// Pushed branches track origin, failed ones are left alone
+		for branch, tracked := range map[string]bool{"feature": true, "pushed": true, "broken": false} {
+			repo, err := git.PlainOpen(filepath.Join(repoDir, branch))
+			assert.NoError(t, err)
+			cfg, err := repo.Config()
+			assert.NoError(t, err)
+			b, ok := cfg.Branches[branch]
+			assert.Equal(t, tracked, ok, branch)
+			if tracked && ok {
+				assert.Equal(t, "origin", b.Remote)
+				assert.Equal(t, plumbing.NewBranchReferenceName(branch), b.Merge)
+			}
+		}
+	})
+
+	t.Run("named replicas", func(t *testing.T) {
+		calls = nil
+		results, err := handlers.Push(context.Background(), handlers.PushOptions{RepoDir: repoDir, Replicas: []string{"feature"}}, pushFunc)
+		assert.NoError(t, err)
+		assert.Len(t, results, 1)
+		assert.Equal(t, []pushCall{{"feature", "feature", false}}, calls)
+	})
+
+	t.Run("metadata failure is a warning", func(t *testing.T) {
+		metaPath := handlers.MetadataPath(filepath.Join(repoDir, "feature"))
+		assert.NoError(t, os.RemoveAll(metaPath))
+		assert.NoError(t, os.MkdirAll(metaPath, 0o755))
+		t.Cleanup(func() { os.RemoveAll(metaPath) })
+
+		results, err := handlers.Push(context.Background(), handlers.PushOptions{RepoDir: repoDir, Replicas: []string{"feature"}}, pushFunc)
+		assert.NoError(t, err)
+		if assert.Len(t, results, 1) {
+			assert.Equal(t, handlers.PushStatusPushed, results[0].Status)
+			assert.Empty(t, results[0].Error)
+			assert.Contains(t, results[0].Warning, "metadata")
+		}
+	})
+
+	t.Run("invalid replicas", func(t *testing.T) {
+		for _, replicas := range [][]string{nil, {"base"}, {"missing"}, {"../repo"}} {
+			_, err := handlers.Push(context.Background(), handlers.PushOptions{RepoDir: repoDir, Replicas: replicas}, pushFunc)
+			assert.Error(t, err, replicas)
+		}
+	})
+}
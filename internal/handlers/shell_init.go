@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"fmt"
+	"sort"
+)
+
+const posixShellInit = `git-replicator() {
+  local dir
+  case "$1" in
+    switch|get)
+      dir="$(command git-replicator "$@" --print-path)" || return
+      ;;
+    cd)
+      dir="$(command git-replicator "$@")" || return
+      ;;
+    *)
+      command git-replicator "$@"
+      return
+      ;;
+  esac
+  if [ -n "$dir" ] && [ -d "$dir" ]; then
+    cd "$dir" || return
+  elif [ -n "$dir" ]; then
+    printf '%s\n' "$dir"
+  fi
+}
+`
+
+const fishShellInit = `function git-replicator
+  set -l dir
+  switch "$argv[1]"
+    case switch get
+      set dir (command git-replicator $argv --print-path); or return
+    case cd
+      set dir (command git-replicator $argv); or return
+    case '*'
+      command git-replicator $argv
+      return
+  end
+  if test -n "$dir"; and test -d "$dir"
+    cd "$dir"
+  else if test -n "$dir"
+    printf '%s\n' $dir
+  end
+end
+`
+
+var shellInitScripts = map[string]string{
+	"bash": posixShellInit,
+	"zsh":  posixShellInit,
+	"fish": fishShellInit,
+}
+
+// SupportedShells returns the shell names accepted by ShellInit.
+func SupportedShells() []string {
+	shells := make([]string, 0, len(shellInitScripts))
+	for shell := range shellInitScripts {
+		shells = append(shells, shell)
+	}
+	sort.Strings(shells)
+	return shells
+}
+
+// ShellInit returns a shell function wrapping git-replicator so that switch, get and cd change the working directory of the interactive shell.
+func ShellInit(shell string) (string, error) {
+	script, ok := shellInitScripts[shell]
+	if !ok {
+		return "", fmt.Errorf("unsupported shell: %s (supported: %v)", shell, SupportedShells())
+	}
+	return script, nil
+}
@@ -0,0 +1,49 @@
+package handlers_test
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+)
+
+func TestShellInit(t *testing.T) {
+	tests := []struct {
+		name    string
+		shell   string
+		wantErr bool
+	}{
+		{"bash", "bash", false},
+		{"zsh", "zsh", false},
+		{"fish", "fish", false},
+		{"unsupported shell", "tcsh", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script, err := handlers.ShellInit(tt.shell)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Contains(t, script, "--print-path")
+			assert.Contains(t, script, "command git-replicator")
+
+			// Syntax check when the shell is installed
+			if _, err := exec.LookPath(tt.shell); err != nil {
+				return
+			}
+			flag := "-n"
+			if tt.shell == "fish" {
+				flag = "--no-execute"
+			}
+			cmd := exec.Command(tt.shell, flag)
+			cmd.Stdin = strings.NewReader(script)
+			out, err := cmd.CombinedOutput()
+			assert.NoError(t, err, string(out))
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+// ReplicaStatus describes the git state of a branch directory.
+type ReplicaStatus struct {
+	// Name is the branch directory name.
+	Name string `json:"name"`
+	Dir  string `json:"dir"`
+	// Branch is the branch actually checked out, or empty when HEAD is detached.
+	Branch string `json:"branch"`
+	// Upstream is the remote-tracking branch configured for Branch, e.g. "origin/feature".
+	Upstream       string `json:"upstream,omitempty"`
+	UpstreamGone   bool   `json:"upstream_gone,omitempty"`
+	AheadUpstream  int    `json:"ahead_upstream"`
+	BehindUpstream int    `json:"behind_upstream"`
+	// AheadBase and BehindBase compare HEAD with the HEAD of the base directory.
+	AheadBase         int       `json:"ahead_base"`
+	BehindBase        int       `json:"behind_base"`
+	Modified          int       `json:"modified"`
+	Untracked         int       `json:"untracked"`
+	LastCommitTime    time.Time `json:"last_commit_time"`
+	LastCommitSubject string    `json:"last_commit_subject"`
+	// Mismatch is set when the directory name of the checked out branch differs from the directory name.
+	Mismatch bool   `json:"mismatch"`
+	Error    string `json:"error,omitempty"`
+	ReplicaMetadata
+}
+
+type StatusOptions struct {
+	RepoDir string
+	// Jobs is the number of branch directories inspected concurrently.
+	Jobs int
+}
+
+// Status collects the status of every branch directory of opts.RepoDir, including base, concurrently.
+// Failures to inspect a single directory are reported in its Error field.
+func Status(ctx context.Context, opts StatusOptions) ([]ReplicaStatus, error) {
+	names, err := ListBranchDirs(ctx, opts.RepoDir)
+	if err != nil {
+		return nil, err
+	}
+	baseDir := filepath.Join(opts.RepoDir, utils.BaseDirName)
+	base, err := git.PlainOpen(baseDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open base repo: %w", err)
+	}
+	baseHead, err := base.Head()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get base HEAD: %w", err)
+	}
+
+	statuses := make([]*ReplicaStatus, len(names))
+	sem := make(chan struct{}, max(opts.Jobs, 1))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		dir := filepath.Join(opts.RepoDir, name)
+		// Skip directories that are not checkouts of this repository
+		if err := utils.VerifyCheckout(dir, opts.RepoDir); err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			s := &ReplicaStatus{Name: name, Dir: dir}
+			if err := fillReplicaStatus(ctx, s, baseDir, baseHead.Hash()); err != nil {
+				s.Error = err.Error()
+			}
+			statuses[i] = s
+		}()
+	}
+	wg.Wait()
+
+	var result []ReplicaStatus
+	for _, s := range statuses {
+		if s != nil {
+			result = append(result, *s)
+		}
+	}
+	return result, nil
+}
+
+// fillReplicaStatus fills s with the state of the checkout at s.Dir. Each call opens its own repositories, so that calls can run concurrently.
+func fillReplicaStatus(ctx context.Context, s *ReplicaStatus, baseDir string, baseHead plumbing.Hash) error {
+	base, err := git.PlainOpen(baseDir)
+	if err != nil {
+		return fmt.Errorf("failed to open base repo: %w", err)
+	}
+	repo, err := git.PlainOpen(s.Dir)
+	if err != nil {
+		return fmt.Errorf("failed to open repo: %w", err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return fmt.Errorf("failed to get HEAD: %w", err)
+	}
+	if head.Name().IsBranch() {
+		s.Branch = head.Name().Short()
+	}
+	s.Mismatch = s.Name != utils.BaseDirName && utils.ReplicaDirName(s.Branch) != s.Name
+	if s.ReplicaMetadata, err = ReadMetadata(s.Dir); err != nil {
+		return err
+	}
+
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return fmt.Errorf("failed to read HEAD commit: %w", err)
+	}
+	s.LastCommitTime = commit.Committer.When
+	s.LastCommitSubject, _, _ = strings.Cut(commit.Message, "\n")
+
+	modified, untracked, err := utils.WorktreeChanges(repo)
+	if err != nil {
+		return err
+	}
+	s.Modified, s.Untracked = len(modified), len(untracked)
+
+	if s.AheadBase, s.BehindBase, err = utils.AheadBehind(ctx, repo, head.Hash(), base, baseHead); err != nil {
+		return err
+	}
+
+	if s.Branch == "" {
+		return nil
+	}
+	cfg, err := repo.Config()
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	b, ok := cfg.Branches[s.Branch]
+	if !ok || b.Remote == "" || !b.Merge.IsBranch() {
+		return nil
+	}
+	s.Upstream = b.Remote + "/" + b.Merge.Short()
+	upstream, err := repo.Reference(plumbing.NewRemoteReferenceName(b.Remote, b.Merge.Short()), true)
+	if err != nil {
+		if err == plumbing.ErrReferenceNotFound {
+			s.UpstreamGone = true
+			return nil
+		}
+		return fmt.Errorf("failed to read upstream %s: %w", s.Upstream, err)
+	}
+	if s.AheadUpstream, s.BehindUpstream, err = utils.AheadBehind(ctx, repo, head.Hash(), repo, upstream.Hash()); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package handlers_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+)
+
+func TestStatus(t *testing.T) {
+	origin := newTestOrigin(t)
+	repoDir := filepath.Join(t.TempDir(), "github.com", "owner", "repo")
+	newReplica := func(name string) string {
+		dir := filepath.Join(repoDir, name)
+		cloneTestRepo(t, origin, dir)
+		setTestRemoteURL(t, dir, "https://github.com/owner/repo.git")
+		return dir
+	}
+
+	feature := newReplica("feature")
+	repo, err := git.PlainOpen(feature)
+	assert.NoError(t, err)
+	head, err := repo.Head()
+	assert.NoError(t, err)
+	checkoutTestBranch(t, feature, "feature", head.Hash())
+	commitTestFile(t, feature, "feature.txt", "feature\n")
+	writeTestFile(t, filepath.Join(feature, "README.md"), "changed\n")
+	writeTestFile(t, filepath.Join(feature, "new.txt"), "new\n")
+
+	newReplica("mismatch")
+
+	// Slashes of branch names become dashes in directory names
+	slash := newReplica("feature-foo")
+	checkoutTestBranch(t, slash, "feature/foo", head.Hash())
+
+	commitTestFile(t, origin, "base.txt", "base\n")
+	newReplica("base")
+	assert.NoError(t, os.MkdirAll(filepath.Join(repoDir, "junk"), 0o755))
+
+	t.Run("collect status of every checkout", func(t *testing.T) {
+		statuses, err := handlers.Status(context.Background(), handlers.StatusOptions{RepoDir: repoDir, Jobs: 2})
+		assert.NoError(t, err)
+		assert.Len(t, statuses, 4)
+		byName := map[string]handlers.ReplicaStatus{}
+		for _, s := range statuses {
+			assert.Empty(t, s.Error)
+			byName[s.Name] = s
+		}
+
+		base := byName["base"]
+		assert.Equal(t, "main", base.Branch)
+		assert.False(t, base.Mismatch)
+		assert.Equal(t, "origin/main", base.Upstream)
+		assert.Equal(t, 0, base.AheadBase)
+		assert.Equal(t, 0, base.BehindBase)
+		assert.Equal(t, "update base.txt", base.LastCommitSubject)
+
+		f := byName["feature"]
+		assert.Equal(t, "feature", f.Branch)
+		assert.False(t, f.Mismatch)
+		assert.Empty(t, f.Upstream)
+		assert.Equal(t, 1, f.AheadBase)
+		assert.Equal(t, 1, f.BehindBase)
+		assert.Equal(t, 1, f.Modified)
+		assert.Equal(t, 1, f.Untracked)
+		assert.Equal(t, "update feature.txt", f.LastCommitSubject)
+
+		s := byName["feature-foo"]
+		assert.Equal(t, "feature/foo", s.Branch)
+		assert.False(t, s.Mismatch)
+
+		m := byName["mismatch"]
+		assert.Equal(t, "main", m.Branch)
+		assert.True(t, m.Mismatch)
+		assert.Equal(t, "origin/main", m.Upstream)
+		assert.Equal(t, 0, m.AheadUpstream)
+		assert.Equal(t, 0, m.BehindUpstream)
+		assert.Equal(t, 0, m.AheadBase)
+		assert.Equal(t, 1, m.BehindBase)
+	})
+
+	t.Run("no base", func(t *testing.T) {
+		_, err := handlers.Status(context.Background(), handlers.StatusOptions{RepoDir: t.TempDir()})
+		assert.Error(t, err)
+	})
+}
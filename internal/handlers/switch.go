@@ -3,14 +3,26 @@ package handlers
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"time"
+
+	"github.com/terakoya76/git-replicator/internal/utils"
 )
 
 type SwitchOptions struct {
 	RepoDir           string
 	BranchName        string
 	GitReplicatorRoot string
+	// Creator, Task and Labels are recorded in the metadata of the new branch directory.
+	Creator string
+	Task    string
+	Labels  []string
+	// PostSwitch is a hook command run in the new branch directory once it is ready, see RunHook.
+	PostSwitch string
+	// Output receives the output of the PostSwitch hook.
+	Output io.Writer
 }
 
 // GetRemoteURLFunc defines a function type for getting remote URL
@@ -25,6 +37,7 @@ type CloneFunc func(ctx context.Context, url, dir string) error
 // This allows for dependency injection in tests
 type SwitchBranchFunc func(ctx context.Context, repoDir, branchName string) error
 
+// Switch clones the repository of opts.RepoDir into a new branch directory and switches it to opts.BranchName.
 func Switch(
 	ctx context.Context,
 	opts SwitchOptions,
@@ -36,12 +49,19 @@ func Switch(
 		return fmt.Errorf("repo dir and branch name are required")
 	}
 
+	if opts.BranchName == utils.BaseDirName {
+		return fmt.Errorf("branch directory name %q is reserved for the canonical clone", opts.BranchName)
+	}
+	branchDir, err := utils.ResolveReplicaDir(opts.RepoDir, opts.BranchName)
+	if err != nil {
+		return err
+	}
+
 	remoteURL, err := getRemoteURL(opts.RepoDir, opts.GitReplicatorRoot)
 	if err != nil {
 		return fmt.Errorf("failed to get remote url: %w", err)
 	}
 
-	branchDir := filepath.Join(opts.RepoDir, opts.BranchName)
 	if _, err := os.Stat(branchDir); err == nil {
 		return fmt.Errorf("branch directory already exists: %s", branchDir)
 	}
@@ -50,10 +70,15 @@ func Switch(
 		return fmt.Errorf("failed to clone to branch dir: %w", err)
 	}
 
+	meta := newReplicaMetadata(branchDir, opts.Creator, opts.Task, opts.Labels, time.Now())
 	if err := switchBranchFunc(ctx, branchDir, opts.BranchName); err != nil {
 		return err
 	}
-
-	fmt.Printf("cloned branch: %s to dir: %s", opts.BranchName, branchDir)
+	if err := WriteMetadata(branchDir, meta); err != nil {
+		return err
+	}
+	if opts.PostSwitch != "" {
+		return RunHook(ctx, opts.RepoDir, filepath.Base(branchDir), opts.PostSwitch, opts.Output)
+	}
 	return nil
 }
@@ -1,6 +1,7 @@
 package handlers_test
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"os"
@@ -167,3 +168,92 @@ func TestSwitch(t *testing.T) {
 		})
 	}
 }
+
+func TestSwitchRejectsInvalidBranchDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	gitReplicatorRoot := filepath.Join(tmpDir, "git-replicator")
+	repoDir := filepath.Join(gitReplicatorRoot, "github.com", "terakoya76", "git-replicator-test")
+
+	cloneFunc := func(ctx context.Context, url, dir string) error {
+		t.Fatalf("clone must not be called for %s", dir)
+		return nil
+	}
+	switchBranchFunc := func(ctx context.Context, repoDir, branchName string) error { return nil }
+
+	for _, branch := range []string{"base", "..", "../other", "/tmp/abs", "a/../b", "a//b"} {
+		t.Run(branch, func(t *testing.T) {
+			opts := handlers.SwitchOptions{
+				RepoDir:           repoDir,
+				BranchName:        branch,
+				GitReplicatorRoot: gitReplicatorRoot,
+			}
+			err := handlers.Switch(context.Background(), opts, utils.DefaultGetRemoteURL, cloneFunc, switchBranchFunc)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestSwitchSlashBranch(t *testing.T) {
+	origin := newTestOrigin(t)
+	rootDir := t.TempDir()
+	repoDir := filepath.Join(rootDir, "github.com", "owner", "repo")
+	cloneTestRepo(t, origin, filepath.Join(repoDir, "base"))
+	getRemoteURL := func(string, string) (string, error) { return origin, nil }
+	cloneFunc := func(ctx context.Context, url, dir string) error {
+		cloneTestRepo(t, url, dir)
+		return nil
+	}
+
+	opts := handlers.SwitchOptions{
+		RepoDir:           repoDir,
+		BranchName:        "feature/foo",
+		GitReplicatorRoot: rootDir,
+	}
+	assert.NoError(t, handlers.Switch(context.Background(), opts, getRemoteURL, cloneFunc, utils.DefaultSwitchBranchFunc))
+
+	// The branch keeps its name while the directory uses a single path element
+	repo, err := git.PlainOpen(filepath.Join(repoDir, "feature-foo"))
+	assert.NoError(t, err)
+	head, err := repo.Head()
+	assert.NoError(t, err)
+	assert.Equal(t, "refs/heads/feature/foo", head.Name().String())
+	assert.NoDirExists(t, filepath.Join(repoDir, "feature"))
+
+	// The directory can be resolved from either name
+	for _, name := range []string{"feature/foo", "feature-foo"} {
+		dir, err := handlers.ResolveBranchDir(context.Background(), repoDir, name)
+		assert.NoError(t, err)
+		assert.Equal(t, filepath.Join(repoDir, "feature-foo"), dir)
+	}
+}
+
+func TestSwitchPostSwitchHook(t *testing.T) {
+	origin := newTestOrigin(t)
+	rootDir := t.TempDir()
+	repoDir := filepath.Join(rootDir, "github.com", "owner", "repo")
+	cloneTestRepo(t, origin, filepath.Join(repoDir, "base"))
+	getRemoteURL := func(string, string) (string, error) { return origin, nil }
+	cloneFunc := func(ctx context.Context, url, dir string) error {
+		cloneTestRepo(t, url, dir)
+		return nil
+	}
+
+	var out bytes.Buffer
+	opts := handlers.SwitchOptions{
+		RepoDir:           repoDir,
+		BranchName:        "feature",
+		GitReplicatorRoot: rootDir,
+		PostSwitch:        `git branch --show-current > hook.txt; echo ran`,
+		Output:            &out,
+	}
+	assert.NoError(t, handlers.Switch(context.Background(), opts, getRemoteURL, cloneFunc, utils.DefaultSwitchBranchFunc))
+	assert.Equal(t, "ran\n", out.String())
+	data, err := os.ReadFile(filepath.Join(repoDir, "feature", "hook.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "feature\n", string(data))
+
+	// A failing hook fails the switch but keeps the new branch directory
+	opts.BranchName, opts.PostSwitch = "broken", "exit 1"
+	assert.Error(t, handlers.Switch(context.Background(), opts, getRemoteURL, cloneFunc, utils.DefaultSwitchBranchFunc))
+	assert.DirExists(t, filepath.Join(repoDir, "broken"))
+}
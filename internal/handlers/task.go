@@ -0,0 +1,427 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+const (
+	TaskStatusQueued  = "queued"
+	TaskStatusRunning = "running"
+	TaskStatusDone    = "done"
+	TaskStatusFailed  = "failed"
+)
+
+const (
+	// TaskEnv and TaskFileEnv are set to the task description and the path of the task file in the environment of the agent command.
+	TaskEnv     = "GIT_REPLICATOR_TASK"
+	TaskFileEnv = "GIT_REPLICATOR_TASK_FILE"
+	// TaskFileName is the file in the replica the task description is written to. It is excluded from git.
+	TaskFileName = "TASK.md"
+)
+
+const (
+	taskQueueFile = "tasks.json"
+	taskLockFile  = "tasks.lock"
+	// taskLockStale is the age after which the lock of a crashed process is broken.
+	taskLockStale   = time.Minute
+	taskLockTimeout = 10 * time.Second
+	taskSlugMaxLen  = 40
+)
+
+// Task is a unit of work for an agent, run in a replica of its own.
+type Task struct {
+	ID          int       `json:"id"`
+	Description string    `json:"description"`
+	Branch      string    `json:"branch"`
+	Labels      []string  `json:"labels,omitempty"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+	StartedAt   time.Time `json:"started_at,omitzero"`
+	FinishedAt  time.Time `json:"finished_at,omitzero"`
+	// Worker, WorkerPID and WorkerHost identify the worker that took the task.
+	Worker     string `json:"worker,omitempty"`
+	WorkerPID  int    `json:"worker_pid,omitempty"`
+	WorkerHost string `json:"worker_host,omitempty"`
+	Dir        string `json:"dir,omitempty"`
+	ExitCode   int    `json:"exit_code"`
+	LogFile    string `json:"log_file,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// TaskQueuePath returns the path of the task queue of repoDir.
+func TaskQueuePath(repoDir string) string {
+	return filepath.Join(repoDir, StateDirName, taskQueueFile)
+}
+
+// TaskSlug returns a branch name derived from description, e.g. "fix-the-login-form" for "Fix the login form!".
+func TaskSlug(description string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(description) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+	slug := b.String()
+	if len(slug) > taskSlugMaxLen {
+		slug = strings.TrimRight(slug[:taskSlugMaxLen], "-")
+	}
+	if slug == "" {
+		return "task"
+	}
+	return slug
+}
+
+// AddTask appends a queued task to the queue of repoDir. Its branch is the slug of description, suffixed to be unique among tasks and branch directories.
+func AddTask(ctx context.Context, repoDir, description string, labels []string, now time.Time) (Task, error) {
+	description = strings.TrimSpace(description)
+	if description == "" {
+		return Task{}, fmt.Errorf("task description is required")
+	}
+	dirs, err := ListBranchDirs(ctx, repoDir)
+	if err != nil {
+		return Task{}, err
+	}
+	var task Task
+	err = withTaskQueue(repoDir, func(tasks *[]Task) error {
+		taken := slices.Clone(dirs)
+		id := 1
+		for _, t := range *tasks {
+			taken = append(taken, t.Branch)
+			id = max(id, t.ID+1)
+		}
+		slug := TaskSlug(description)
+		branch := slug
+		for n := 2; slices.Contains(taken, branch); n++ {
+			branch = slug + "-" + strconv.Itoa(n)
+		}
+		task = Task{ID: id, Description: description, Branch: branch, Labels: labels, Status: TaskStatusQueued, CreatedAt: now}
+		*tasks = append(*tasks, task)
+		return nil
+	})
+	return task, err
+}
+
+// ListTasks returns the tasks of the queue of repoDir in the order they were added.
+func ListTasks(repoDir string) ([]Task, error) {
+	return readTaskQueue(repoDir)
+}
+
+type RunTasksOptions struct {
+	RepoDir           string
+	GitReplicatorRoot string
+	// Command is the agent command, run with sh -c in the replica of each task.
+	Command string
+	// Owner leases the replica of each task while its command runs.
+	Owner string
+	// Max is the number of tasks to run before returning. Zero runs tasks until the queue is empty.
+	Max int
+	// PollInterval, if set, makes RunTasks wait for new tasks when the queue is empty, checking every PollInterval until ctx is canceled.
+	PollInterval time.Duration
+	// PostSwitch is a hook command run in the replica of each task once it is created, before Command.
+	PostSwitch string
+	// Output receives the output of the commands, each line prefixed with the branch. Nil discards it.
+	Output io.Writer
+}
+
+// RunTasks takes queued tasks from the queue of opts.RepoDir one at a time, creates a replica for each with Switch,
+// writes the task to TASK.md in it, runs opts.Command there and records the outcome in the queue and the replica metadata.
+// Several workers may run on the same queue. Running tasks whose worker process is gone from this host are queued again.
+func RunTasks(
+	ctx context.Context,
+	opts RunTasksOptions,
+	getRemoteURL GetRemoteURLFunc,
+	cloneFunc CloneFunc,
+	switchBranchFunc SwitchBranchFunc,
+) ([]Task, error) {
+	if strings.TrimSpace(opts.Command) == "" {
+		return nil, fmt.Errorf("no agent command configured (set agent.command or pass --command)")
+	}
+	logDir := filepath.Join(opts.RepoDir, StateDirName, "logs")
+	if err := os.MkdirAll(logDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	output := opts.Output
+	if output == nil {
+		output = io.Discard
+	}
+
+	host, _ := os.Hostname()
+	worker := Task{Worker: opts.Owner, WorkerPID: os.Getpid(), WorkerHost: host}
+
+	var ran []Task
+	for opts.Max <= 0 || len(ran) < opts.Max {
+		if err := ctx.Err(); err != nil {
+			return ran, err
+		}
+		task, ok, err := takeTask(opts.RepoDir, worker, time.Now())
+		if err != nil {
+			return ran, err
+		}
+		if !ok {
+			if opts.PollInterval <= 0 {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				return ran, nil
+			case <-time.After(opts.PollInterval):
+			}
+			continue
+		}
+		task.LogFile = filepath.Join(logDir, fmt.Sprintf("task-%d.log", task.ID))
+		runTask(ctx, &task, opts, output, getRemoteURL, cloneFunc, switchBranchFunc)
+		task.FinishedAt = time.Now()
+		if err := saveTask(opts.RepoDir, task); err != nil {
+			return ran, err
+		}
+		ran = append(ran, task)
+	}
+	return ran, nil
+}
+
+// runTask creates the replica of task, runs the agent command in it and records the outcome in task.
+func runTask(ctx context.Context, task *Task, opts RunTasksOptions, output io.Writer, getRemoteURL GetRemoteURLFunc, cloneFunc CloneFunc, switchBranchFunc SwitchBranchFunc) {
+	fail := func(err error) {
+		task.Status, task.ExitCode, task.Error = TaskStatusFailed, -1, err.Error()
+	}
+	// Prefix the output of the post-switch hook like that of the command
+	hookOutput := &prefixWriter{prefix: "[" + task.Branch + "] ", out: output}
+	switchOpts := SwitchOptions{
+		RepoDir:           opts.RepoDir,
+		BranchName:        task.Branch,
+		GitReplicatorRoot: opts.GitReplicatorRoot,
+		Creator:           opts.Owner,
+		Task:              task.Description,
+		Labels:            task.Labels,
+		PostSwitch:        opts.PostSwitch,
+		Output:            hookOutput,
+	}
+	if !hasTaskReplica(opts.RepoDir, *task) {
+		err := Switch(ctx, switchOpts, getRemoteURL, cloneFunc, switchBranchFunc)
+		hookOutput.Flush()
+		if err != nil {
+			fail(err)
+			return
+		}
+	}
+	task.Dir = filepath.Join(opts.RepoDir, utils.ReplicaDirName(task.Branch))
+	if _, err := Claim(ctx, ClaimOptions{RepoDir: opts.RepoDir, Name: task.Branch, Owner: opts.Owner, PID: os.Getpid(), Now: time.Now()}); err != nil {
+		fail(err)
+		return
+	}
+	defer Release(ReleaseOptions{RepoDir: opts.RepoDir, Name: task.Branch, Owner: opts.Owner, Now: time.Now()})
+	taskFile, err := writeTaskFile(task.Dir, *task)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	log, err := os.Create(task.LogFile)
+	if err != nil {
+		fail(fmt.Errorf("failed to create log file: %w", err))
+		return
+	}
+	defer log.Close()
+	prefixed := &prefixWriter{prefix: "[" + task.Branch + "] ", out: output}
+	w := io.MultiWriter(log, prefixed)
+	cmd := exec.CommandContext(ctx, "sh", "-c", opts.Command)
+	cmd.Dir = task.Dir
+	cmd.Env = append(os.Environ(), ExecReplicaEnv+"="+task.Branch, TaskEnv+"="+task.Description, TaskFileEnv+"="+taskFile)
+	cmd.Stdout = w
+	cmd.Stderr = w
+	err = cmd.Run()
+	prefixed.Flush()
+
+	task.Status = TaskStatusDone
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+	case errors.As(err, &exitErr):
+		task.Status, task.ExitCode, task.Error = TaskStatusFailed, exitErr.ExitCode(), err.Error()
+	default:
+		fail(err)
+	}
+	status := task.Status
+	if err := UpdateMetadata(task.Dir, time.Now(), MetadataUpdate{Status: &status}.Apply); err != nil && task.Error == "" {
+		task.Error = err.Error()
+	}
+}
+
+// hasTaskReplica reports whether the replica of task was already created for it, e.g. by a worker that died before finishing the task.
+func hasTaskReplica(repoDir string, task Task) bool {
+	dir, err := resolveExistingReplica(repoDir, task.Branch, false)
+	if err != nil {
+		return false
+	}
+	meta, err := ReadMetadata(dir)
+	return err == nil && meta.Task == task.Description
+}
+
+// writeTaskFile writes task to TASK.md in the replica at dir, excluded from git so that it does not count as untracked work.
+func writeTaskFile(dir string, task Task) (string, error) {
+	path := filepath.Join(dir, TaskFileName)
+	content := fmt.Sprintf("# Task %d\n\n%s\n", task.ID, task.Description)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write task file: %w", err)
+	}
+	exclude := filepath.Join(dir, ".git", "info", "exclude")
+	if err := os.MkdirAll(filepath.Dir(exclude), 0o755); err != nil {
+		return "", fmt.Errorf("failed to exclude task file: %w", err)
+	}
+	f, err := os.OpenFile(exclude, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return "", fmt.Errorf("failed to exclude task file: %w", err)
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintf(f, "\n/%s\n", TaskFileName); err != nil {
+		return "", fmt.Errorf("failed to exclude task file: %w", err)
+	}
+	return path, nil
+}
+
+// takeTask marks the oldest queued task as running, claimed by the Worker, WorkerPID and WorkerHost of worker, and returns it,
+// or false if no task is queued. Running tasks of workers that are gone from the host of worker are queued again first.
+func takeTask(repoDir string, worker Task, now time.Time) (Task, bool, error) {
+	var task Task
+	var ok bool
+	err := withTaskQueue(repoDir, func(tasks *[]Task) error {
+		for i := range *tasks {
+			t := &(*tasks)[i]
+			if t.Status == TaskStatusRunning && t.WorkerPID != 0 && t.WorkerHost == worker.WorkerHost && !utils.ProcessAlive(t.WorkerPID) {
+				slog.Warn("requeueing task of a worker that is gone", "id", t.ID, "worker", t.Worker, "pid", t.WorkerPID)
+				releaseDeadWorkerLease(filepath.Join(repoDir, utils.ReplicaDirName(t.Branch)), *t)
+				t.Status, t.StartedAt = TaskStatusQueued, time.Time{}
+				t.Worker, t.WorkerPID, t.WorkerHost = "", 0, ""
+			}
+		}
+		for i := range *tasks {
+			t := &(*tasks)[i]
+			if t.Status == TaskStatusQueued {
+				t.Status, t.StartedAt = TaskStatusRunning, now
+				t.Worker, t.WorkerPID, t.WorkerHost = worker.Worker, worker.WorkerPID, worker.WorkerHost
+				task, ok = *t, true
+				return nil
+			}
+		}
+		return nil
+	})
+	return task, ok, err
+}
+
+// releaseDeadWorkerLease removes the lease the worker of task left on the replica at dir, so that the next worker can claim it.
+func releaseDeadWorkerLease(dir string, task Task) {
+	lease, err := ReadLease(dir)
+	if err != nil || lease == nil || lease.PID != task.WorkerPID || lease.Host != task.WorkerHost {
+		return
+	}
+	if err := os.Remove(LeasePath(dir)); err != nil {
+		slog.Warn("failed to remove lease", "dir", dir, "err", err)
+	}
+}
+
+// saveTask replaces the task with the ID of task in the queue of repoDir.
+func saveTask(repoDir string, task Task) error {
+	return withTaskQueue(repoDir, func(tasks *[]Task) error {
+		for i := range *tasks {
+			if (*tasks)[i].ID == task.ID {
+				(*tasks)[i] = task
+				return nil
+			}
+		}
+		return fmt.Errorf("task %d was removed from the queue", task.ID)
+	})
+}
+
+func readTaskQueue(repoDir string) ([]Task, error) {
+	data, err := os.ReadFile(TaskQueuePath(repoDir))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read task queue: %w", err)
+	}
+	var tasks []Task
+	if err := json.Unmarshal(data, &tasks); err != nil {
+		return nil, fmt.Errorf("failed to parse task queue %s: %w", TaskQueuePath(repoDir), err)
+	}
+	return tasks, nil
+}
+
+// withTaskQueue calls update with the tasks of the queue of repoDir and writes them back if it succeeds.
+// A lock file serializes concurrent workers and commands.
+func withTaskQueue(repoDir string, update func(tasks *[]Task) error) error {
+	stateDir := filepath.Join(repoDir, StateDirName)
+	if err := os.MkdirAll(stateDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	unlock, err := lockFile(filepath.Join(stateDir, taskLockFile))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	tasks, err := readTaskQueue(repoDir)
+	if err != nil {
+		return err
+	}
+	if err := update(&tasks); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(tasks, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode task queue: %w", err)
+	}
+	path := TaskQueuePath(repoDir)
+	if err := os.WriteFile(path+".tmp", data, 0o644); err != nil {
+		return fmt.Errorf("failed to write task queue: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to write task queue: %w", err)
+	}
+	return nil
+}
+
+// lockFile creates path exclusively, waiting for other holders to remove it, and returns a function removing it.
+func lockFile(path string) (func(), error) {
+	deadline := time.Now().Add(taskLockTimeout)
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > taskLockStale {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for lock %s", path)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,185 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+func TestTaskSlug(t *testing.T) {
+	tests := []struct {
+		description string
+		want        string
+	}{
+		{"Fix the login form!", "fix-the-login-form"},
+		{"  add `--json` to status  ", "add-json-to-status"},
+		{"Überprüfen", "berpr-fen"},
+		{"!!!", "task"},
+		{"Refactor the configuration loading so that profiles and roots come from one place", "refactor-the-configuration-loading-so-th"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			assert.Equal(t, tt.want, handlers.TaskSlug(tt.description))
+		})
+	}
+}
+
+func TestAddTask(t *testing.T) {
+	repoDir := filepath.Join(t.TempDir(), "github.com", "owner", "repo")
+	assert.NoError(t, os.MkdirAll(filepath.Join(repoDir, "base"), 0o755))
+	assert.NoError(t, os.MkdirAll(filepath.Join(repoDir, "fix-bug"), 0o755))
+	now := time.Now()
+
+	_, err := handlers.AddTask(context.Background(), repoDir, "  ", nil, now)
+	assert.Error(t, err)
+
+	var branches []string
+	for _, description := range []string{"Fix bug", "fix bug", "Add docs"} {
+		task, err := handlers.AddTask(context.Background(), repoDir, description, []string{"queue"}, now)
+		assert.NoError(t, err)
+		branches = append(branches, task.Branch)
+	}
+	assert.Equal(t, []string{"fix-bug-2", "fix-bug-3", "add-docs"}, branches)
+
+	tasks, err := handlers.ListTasks(repoDir)
+	assert.NoError(t, err)
+	if assert.Len(t, tasks, 3) {
+		assert.Equal(t, 3, tasks[2].ID)
+		assert.Equal(t, handlers.TaskStatusQueued, tasks[2].Status)
+		assert.Equal(t, []string{"queue"}, tasks[2].Labels)
+	}
+
+	// The queue state is not a branch directory
+	dirs, err := handlers.ListBranchDirs(context.Background(), repoDir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"base", "fix-bug"}, dirs)
+}
+
+func TestRunTasks(t *testing.T) {
+	origin := newTestOrigin(t)
+	rootDir := t.TempDir()
+	repoDir := filepath.Join(rootDir, "github.com", "owner", "repo")
+	baseDir := filepath.Join(repoDir, "base")
+	cloneTestRepo(t, origin, baseDir)
+	setTestRemoteURL(t, baseDir, "https://github.com/owner/repo.git")
+	ctx := context.Background()
+
+	getRemoteURL := func(string, string) (string, error) { return origin, nil }
+	cloneFunc := func(ctx context.Context, url, dir string) error {
+		cloneTestRepo(t, url, dir)
+		setTestRemoteURL(t, dir, "https://github.com/owner/repo.git")
+		return nil
+	}
+	for _, description := range []string{"write notes", "fail please", "write more notes"} {
+		_, err := handlers.AddTask(ctx, repoDir, description, nil, time.Now())
+		assert.NoError(t, err)
+	}
+	opts := handlers.RunTasksOptions{
+		RepoDir:           repoDir,
+		GitReplicatorRoot: rootDir,
+		Command:           `case "$GIT_REPLICATOR_TASK" in fail*) echo failing; exit 3;; esac; cat "$GIT_REPLICATOR_TASK_FILE" > notes.txt; echo "done $GIT_REPLICATOR_REPLICA"`,
+		Owner:             "worker",
+		Max:               2,
+	}
+
+	t.Run("no command", func(t *testing.T) {
+		_, err := handlers.RunTasks(ctx, handlers.RunTasksOptions{RepoDir: repoDir}, getRemoteURL, cloneFunc, utils.DefaultSwitchBranchFunc)
+		assert.Error(t, err)
+	})
+
+	t.Run("max", func(t *testing.T) {
+		var out bytes.Buffer
+		opts.Output = &out
+		tasks, err := handlers.RunTasks(ctx, opts, getRemoteURL, cloneFunc, utils.DefaultSwitchBranchFunc)
+		assert.NoError(t, err)
+		if !assert.Len(t, tasks, 2) {
+			return
+		}
+		assert.Equal(t, handlers.TaskStatusDone, tasks[0].Status)
+		assert.Equal(t, "worker", tasks[0].Worker)
+		assert.Equal(t, os.Getpid(), tasks[0].WorkerPID)
+		assert.Equal(t, filepath.Join(repoDir, "write-notes"), tasks[0].Dir)
+		assert.Contains(t, out.String(), "[write-notes] done write-notes\n")
+		data, err := os.ReadFile(filepath.Join(tasks[0].Dir, "notes.txt"))
+		assert.NoError(t, err)
+		assert.Equal(t, "# Task 1\n\nwrite notes\n", string(data))
+
+		assert.Equal(t, handlers.TaskStatusFailed, tasks[1].Status)
+		assert.Equal(t, 3, tasks[1].ExitCode)
+		log, err := os.ReadFile(tasks[1].LogFile)
+		assert.NoError(t, err)
+		assert.Equal(t, "failing\n", string(log))
+
+		meta, err := handlers.ReadMetadata(tasks[0].Dir)
+		assert.NoError(t, err)
+		assert.Equal(t, "write notes", meta.Task)
+		assert.Equal(t, "worker", meta.CreatedBy)
+		assert.Equal(t, handlers.TaskStatusDone, meta.Status)
+		lease, err := handlers.ReadLease(tasks[0].Dir)
+		assert.NoError(t, err)
+		assert.Nil(t, lease)
+
+		// TASK.md is excluded from git, so the replica of the failed task is clean
+		state, err := utils.InspectWorkState(ctx, tasks[1].Dir)
+		assert.NoError(t, err)
+		assert.True(t, state.Clean())
+	})
+
+	t.Run("until empty", func(t *testing.T) {
+		opts.Max = 0
+		tasks, err := handlers.RunTasks(ctx, opts, getRemoteURL, cloneFunc, utils.DefaultSwitchBranchFunc)
+		assert.NoError(t, err)
+		if assert.Len(t, tasks, 1) {
+			assert.Equal(t, "write-more-notes", tasks[0].Branch)
+		}
+
+		all, err := handlers.ListTasks(repoDir)
+		assert.NoError(t, err)
+		var statuses []string
+		for _, task := range all {
+			statuses = append(statuses, task.Status)
+		}
+		assert.Equal(t, []string{handlers.TaskStatusDone, handlers.TaskStatusFailed, handlers.TaskStatusDone}, statuses)
+	})
+
+	t.Run("requeue tasks of dead workers", func(t *testing.T) {
+		task, err := handlers.AddTask(ctx, repoDir, "write notes again", nil, time.Now())
+		assert.NoError(t, err)
+		// A worker took the task, created its replica and was killed
+		dead := exec.Command("true")
+		assert.NoError(t, dead.Run())
+		host, err := os.Hostname()
+		assert.NoError(t, err)
+		tasks, err := handlers.ListTasks(repoDir)
+		assert.NoError(t, err)
+		tasks[len(tasks)-1].Status = handlers.TaskStatusRunning
+		tasks[len(tasks)-1].Worker = "killed"
+		tasks[len(tasks)-1].WorkerPID = dead.Process.Pid
+		tasks[len(tasks)-1].WorkerHost = host
+		data, err := json.Marshal(tasks)
+		assert.NoError(t, err)
+		assert.NoError(t, os.WriteFile(handlers.TaskQueuePath(repoDir), data, 0o644))
+		dir := filepath.Join(repoDir, task.Branch)
+		assert.NoError(t, cloneFunc(ctx, origin, dir))
+		assert.NoError(t, handlers.WriteMetadata(dir, handlers.ReplicaMetadata{Task: task.Description}))
+		_, err = handlers.Claim(ctx, handlers.ClaimOptions{RepoDir: repoDir, Name: task.Branch, Owner: "killed", PID: dead.Process.Pid, Now: time.Now()})
+		assert.NoError(t, err)
+
+		ran, err := handlers.RunTasks(ctx, opts, getRemoteURL, cloneFunc, utils.DefaultSwitchBranchFunc)
+		assert.NoError(t, err)
+		if assert.Len(t, ran, 1) {
+			assert.Equal(t, task.ID, ran[0].ID)
+			assert.Equal(t, handlers.TaskStatusDone, ran[0].Status, ran[0].Error)
+			assert.Equal(t, "worker", ran[0].Worker)
+		}
+	})
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+// TrashDirName is the directory under the git-replicator root where deleted branch directories are kept.
+const TrashDirName = ".trash"
+
+const (
+	trashMetaFile    = "meta.json"
+	trashReplicaDir  = "replica"
+	trashIDTimestamp = "20060102T150405.000000000"
+)
+
+// TrashEntry describes a branch directory moved to the trash.
+type TrashEntry struct {
+	ID           string    `json:"id"`
+	Host         string    `json:"host"`
+	Owner        string    `json:"owner"`
+	Repo         string    `json:"repo"`
+	Branch       string    `json:"branch"`
+	OriginalPath string    `json:"original_path"`
+	DeletedAt    time.Time `json:"deleted_at"`
+	// Path is the directory of the entry inside the trash.
+	Path string `json:"path"`
+}
+
+// moveToTrash moves the branch directory dir of repoDir into $root/.trash and records where it came from.
+func moveToTrash(rootDir, repoDir, branchName, dir string, now time.Time) (TrashEntry, error) {
+	entry := TrashEntry{
+		ID:           fmt.Sprintf("%s-%s", now.UTC().Format(trashIDTimestamp), utils.ReplicaDirName(branchName)),
+		Host:         filepath.Base(filepath.Dir(filepath.Dir(repoDir))),
+		Owner:        filepath.Base(filepath.Dir(repoDir)),
+		Repo:         filepath.Base(repoDir),
+		Branch:       branchName,
+		OriginalPath: dir,
+		DeletedAt:    now,
+	}
+	entry.Path = filepath.Join(rootDir, TrashDirName, entry.ID)
+	if err := os.MkdirAll(entry.Path, 0o755); err != nil {
+		return entry, fmt.Errorf("failed to create trash entry: %w", err)
+	}
+	if err := writeTrashMeta(entry); err != nil {
+		_ = os.RemoveAll(entry.Path)
+		return entry, err
+	}
+	if err := os.Rename(dir, filepath.Join(entry.Path, trashReplicaDir)); err != nil {
+		_ = os.RemoveAll(entry.Path)
+		return entry, fmt.Errorf("failed to move %s to trash (use --permanent to delete it instead): %w", dir, err)
+	}
+	return entry, nil
+}
+
+func writeTrashMeta(entry TrashEntry) error {
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode trash metadata: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(entry.Path, trashMetaFile), data, 0o644); err != nil {
+		return fmt.Errorf("failed to write trash metadata: %w", err)
+	}
+	return nil
+}
+
+// ListTrash returns the entries in the trash under rootDir, most recently deleted first.
+// Entries whose metadata is missing or cannot be decoded are skipped with a warning.
+func ListTrash(ctx context.Context, rootDir string) ([]TrashEntry, error) {
+	trashDir := filepath.Join(rootDir, TrashDirName)
+	dirs, err := os.ReadDir(trashDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read trash directory: %w", err)
+	}
+	var entries []TrashEntry
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		path := filepath.Join(trashDir, d.Name())
+		data, err := os.ReadFile(filepath.Join(path, trashMetaFile))
+		if err != nil {
+			slog.Warn("skipping trash entry with unreadable metadata", "path", path, "err", err)
+			continue
+		}
+		var entry TrashEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			slog.Warn("skipping trash entry with invalid metadata", "path", path, "err", err)
+			continue
+		}
+		entry.Path = path
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].DeletedAt.After(entries[j].DeletedAt)
+	})
+	return entries, nil
+}
+
+type RestoreOptions struct {
+	GitReplicatorRoot string
+	RepoDir           string
+	BranchName        string
+}
+
+// Restore moves the most recently deleted branch directory of opts.BranchName back from the trash to its original path.
+func Restore(ctx context.Context, opts RestoreOptions) (TrashEntry, error) {
+	dir, err := utils.ResolveReplicaDir(opts.RepoDir, opts.BranchName)
+	if err != nil {
+		return TrashEntry{}, err
+	}
+	entries, err := ListTrash(ctx, opts.GitReplicatorRoot)
+	if err != nil {
+		return TrashEntry{}, err
+	}
+	for _, entry := range entries {
+		if entry.OriginalPath != dir {
+			continue
+		}
+		if _, err := os.Stat(dir); err == nil {
+			return entry, fmt.Errorf("branch directory already exists: %s", dir)
+		}
+		if err := os.Rename(filepath.Join(entry.Path, trashReplicaDir), dir); err != nil {
+			return entry, fmt.Errorf("failed to restore %s: %w", dir, err)
+		}
+		if err := utils.RemoveDir(entry.Path); err != nil {
+			return entry, fmt.Errorf("restored %s but failed to remove trash entry: %w", dir, err)
+		}
+		markActive := func(meta *ReplicaMetadata) {
+			if meta.Status == MetadataStatusDeleted {
+				meta.Status = MetadataStatusActive
+			}
+		}
+		if err := UpdateMetadata(dir, time.Now(), markActive); err != nil {
+			return entry, fmt.Errorf("restored %s but failed to update metadata: %w", dir, err)
+		}
+		return entry, nil
+	}
+	return TrashEntry{}, fmt.Errorf("no trashed branch directory found for %s", dir)
+}
+
+// ExpiredTrash returns the trash entries under rootDir deleted more than olderThan before now.
+func ExpiredTrash(ctx context.Context, rootDir string, olderThan time.Duration, now time.Time) ([]TrashEntry, error) {
+	entries, err := ListTrash(ctx, rootDir)
+	if err != nil {
+		return nil, err
+	}
+	var expired []TrashEntry
+	for _, entry := range entries {
+		if now.Sub(entry.DeletedAt) >= olderThan {
+			expired = append(expired, entry)
+		}
+	}
+	return expired, nil
+}
+
+// EmptyTrash permanently removes the trash entries deleted more than olderThan before now and returns them.
+func EmptyTrash(ctx context.Context, rootDir string, olderThan time.Duration, now time.Time) ([]TrashEntry, error) {
+	entries, err := ExpiredTrash(ctx, rootDir, olderThan, now)
+	if err != nil {
+		return nil, err
+	}
+	var removed []TrashEntry
+	for _, entry := range entries {
+		if err := utils.RemoveDir(entry.Path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, entry)
+	}
+	return removed, nil
+}
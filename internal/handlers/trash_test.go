@@ -0,0 +1,140 @@
+package handlers_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+)
+
+func TestTrash(t *testing.T) {
+	origin := newTestOrigin(t)
+	rootDir := t.TempDir()
+	repoDir := filepath.Join(rootDir, "github.com", "owner", "repo")
+	ctx := context.Background()
+
+	newReplica := func(branch string) string {
+		dir := filepath.Join(repoDir, branch)
+		cloneTestRepo(t, origin, dir)
+		setTestRemoteURL(t, dir, "https://github.com/owner/repo.git")
+		return dir
+	}
+	deleteReplica := func(branch string) {
+		opts := handlers.DeleteOptions{GitReplicatorRoot: rootDir, RepoDir: repoDir, BranchName: branch}
+		assert.NoError(t, handlers.DeleteBranchDir(ctx, opts))
+	}
+
+	t.Run("empty trash", func(t *testing.T) {
+		entries, err := handlers.ListTrash(ctx, rootDir)
+		assert.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("delete records metadata", func(t *testing.T) {
+		dir := newReplica("feature-x")
+		deleteReplica("feature-x")
+
+		entries, err := handlers.ListTrash(ctx, rootDir)
+		assert.NoError(t, err)
+		assert.Len(t, entries, 1)
+		e := entries[0]
+		assert.Equal(t, "github.com", e.Host)
+		assert.Equal(t, "owner", e.Owner)
+		assert.Equal(t, "repo", e.Repo)
+		assert.Equal(t, "feature-x", e.Branch)
+		assert.Equal(t, dir, e.OriginalPath)
+		assert.WithinDuration(t, time.Now(), e.DeletedAt, time.Minute)
+		_, err = os.Stat(filepath.Join(e.Path, "replica", "README.md"))
+		assert.NoError(t, err)
+	})
+
+	t.Run("trash is not listed as a repository", func(t *testing.T) {
+		repos, err := handlers.List(ctx, rootDir)
+		assert.NoError(t, err)
+		assert.Empty(t, repos)
+	})
+
+	t.Run("restore moves the replica back", func(t *testing.T) {
+		opts := handlers.RestoreOptions{GitReplicatorRoot: rootDir, RepoDir: repoDir, BranchName: "feature-x"}
+		entry, err := handlers.Restore(ctx, opts)
+		assert.NoError(t, err)
+		assert.Equal(t, "feature-x", entry.Branch)
+		_, err = os.Stat(filepath.Join(repoDir, "feature-x", "README.md"))
+		assert.NoError(t, err)
+		entries, err := handlers.ListTrash(ctx, rootDir)
+		assert.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("restore fails when the directory exists", func(t *testing.T) {
+		deleteReplica("feature-x")
+		newReplica("feature-x")
+		opts := handlers.RestoreOptions{GitReplicatorRoot: rootDir, RepoDir: repoDir, BranchName: "feature-x"}
+		_, err := handlers.Restore(ctx, opts)
+		assert.Error(t, err)
+	})
+
+	t.Run("restore unknown branch", func(t *testing.T) {
+		opts := handlers.RestoreOptions{GitReplicatorRoot: rootDir, RepoDir: repoDir, BranchName: "unknown"}
+		_, err := handlers.Restore(ctx, opts)
+		assert.Error(t, err)
+	})
+
+	t.Run("slash branch names", func(t *testing.T) {
+		dir := newReplica("feature-y")
+		deleteReplica("feature/y")
+		entries, err := handlers.ListTrash(ctx, rootDir)
+		assert.NoError(t, err)
+		if assert.Len(t, entries, 2) {
+			assert.Equal(t, "feature/y", entries[0].Branch)
+			assert.Equal(t, dir, entries[0].OriginalPath)
+		}
+
+		opts := handlers.RestoreOptions{GitReplicatorRoot: rootDir, RepoDir: repoDir, BranchName: "feature/y"}
+		_, err = handlers.Restore(ctx, opts)
+		assert.NoError(t, err)
+		assert.DirExists(t, dir)
+	})
+
+	t.Run("broken entries are skipped", func(t *testing.T) {
+		trashDir := filepath.Join(rootDir, handlers.TrashDirName)
+		assert.NoError(t, os.MkdirAll(filepath.Join(trashDir, "no-meta"), 0o755))
+		assert.NoError(t, os.MkdirAll(filepath.Join(trashDir, "corrupt"), 0o755))
+		assert.NoError(t, os.WriteFile(filepath.Join(trashDir, "corrupt", "meta.json"), []byte("{"), 0o644))
+		t.Cleanup(func() {
+			os.RemoveAll(filepath.Join(trashDir, "no-meta"))
+			os.RemoveAll(filepath.Join(trashDir, "corrupt"))
+		})
+
+		entries, err := handlers.ListTrash(ctx, rootDir)
+		assert.NoError(t, err)
+		assert.Len(t, entries, 1)
+		assert.Equal(t, "feature-x", entries[0].Branch)
+	})
+
+	t.Run("empty only removes old entries", func(t *testing.T) {
+		deleteReplica("feature-x")
+		entries, err := handlers.ListTrash(ctx, rootDir)
+		assert.NoError(t, err)
+		assert.Len(t, entries, 2)
+
+		expired, err := handlers.ExpiredTrash(ctx, rootDir, 7*24*time.Hour, time.Now().Add(8*24*time.Hour))
+		assert.NoError(t, err)
+		assert.Len(t, expired, 2)
+
+		removed, err := handlers.EmptyTrash(ctx, rootDir, 7*24*time.Hour, time.Now())
+		assert.NoError(t, err)
+		assert.Empty(t, removed)
+
+		removed, err = handlers.EmptyTrash(ctx, rootDir, 7*24*time.Hour, time.Now().Add(8*24*time.Hour))
+		assert.NoError(t, err)
+		assert.Len(t, removed, 2)
+		entries, err = handlers.ListTrash(ctx, rootDir)
+		assert.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+}
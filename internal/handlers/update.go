@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+const (
+	// UpdateModeNone only fast-forwards base.
+	UpdateModeNone   = ""
+	UpdateModeRebase = "rebase"
+	UpdateModeMerge  = "merge"
+)
+
+const (
+	UpdateStatusUpdated  = "updated"
+	UpdateStatusUpToDate = "up to date"
+	UpdateStatusConflict = "conflict"
+	UpdateStatusSkipped  = "skipped"
+	UpdateStatusFailed   = "failed"
+)
+
+type UpdateOptions struct {
+	RepoDir string
+	// Mode is how the branch of each replica is brought onto the new base: UpdateModeNone, UpdateModeRebase or UpdateModeMerge.
+	Mode string
+}
+
+// UpdateResult is the outcome of updating base or a replica.
+type UpdateResult struct {
+	Branch string `json:"branch"`
+	Dir    string `json:"dir"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// Conflicts are the files that conflicted before the rebase or merge was aborted.
+	Conflicts []string `json:"conflicts,omitempty"`
+}
+
+// Update fetches origin in base and fast-forwards it to the default branch of origin.
+// Depending on opts.Mode it then rebases or merges the branch of every replica onto the new base. Replicas with uncommitted changes or a detached HEAD are skipped,
+// and a rebase or merge that conflicts is aborted, leaving the replica as it was. The result for base comes first.
+func Update(ctx context.Context, opts UpdateOptions, fetchFunc FetchFunc) ([]UpdateResult, error) {
+	if opts.Mode != UpdateModeNone && opts.Mode != UpdateModeRebase && opts.Mode != UpdateModeMerge {
+		return nil, fmt.Errorf("unsupported update mode: %s", opts.Mode)
+	}
+	baseDir := filepath.Join(opts.RepoDir, utils.BaseDirName)
+	baseResult, defaultBranch, err := fastForwardBase(ctx, baseDir, fetchFunc)
+	if err != nil {
+		return nil, err
+	}
+	results := []UpdateResult{baseResult}
+	if opts.Mode == UpdateModeNone {
+		return results, nil
+	}
+
+	replicas, err := listReplicas(ctx, opts.RepoDir)
+	if err != nil {
+		return results, err
+	}
+	// Take the remote-tracking branches from base, which has just fetched them, unless base is a single branch clone
+	// whose refs would prune the other branches of the replicas
+	allBranches, err := utils.TracksAllBranches(baseDir)
+	if err != nil {
+		return results, err
+	}
+	fetchRefs := fetchFunc
+	if allBranches {
+		fetchRefs = func(ctx context.Context, dir string) error {
+			return utils.FetchRemoteRefs(ctx, dir, baseDir)
+		}
+	}
+	for _, branch := range replicas {
+		r := UpdateResult{Branch: branch, Dir: filepath.Join(opts.RepoDir, branch)}
+		updateReplica(ctx, &r, defaultBranch, opts.Mode, fetchRefs)
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// fastForwardBase fetches origin in baseDir and fast-forwards its default branch, which must be checked out.
+func fastForwardBase(ctx context.Context, baseDir string, fetchFunc FetchFunc) (UpdateResult, string, error) {
+	result := UpdateResult{Branch: utils.BaseDirName, Dir: baseDir}
+	if err := fetchFunc(ctx, baseDir); err != nil {
+		return result, "", err
+	}
+	repo, err := git.PlainOpen(baseDir)
+	if err != nil {
+		return result, "", fmt.Errorf("failed to open base repo: %w", err)
+	}
+	defaultBranch, err := utils.RemoteDefaultBranch(repo)
+	if err != nil {
+		return result, "", err
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return result, "", fmt.Errorf("failed to get base HEAD: %w", err)
+	}
+	if head.Name() != plumbing.NewBranchReferenceName(defaultBranch) {
+		return result, "", fmt.Errorf("base is not on the default branch %s", defaultBranch)
+	}
+	upstream, err := repo.Reference(plumbing.NewRemoteReferenceName(git.DefaultRemoteName, defaultBranch), true)
+	if err != nil {
+		return result, "", fmt.Errorf("failed to read %s/%s: %w", git.DefaultRemoteName, defaultBranch, err)
+	}
+	if upstream.Hash() == head.Hash() {
+		result.Status = UpdateStatusUpToDate
+		return result, defaultBranch, nil
+	}
+	if _, err := utils.RunGit(ctx, baseDir, "merge", "--ff-only", "--quiet", upstream.Hash().String()); err != nil {
+		return result, "", fmt.Errorf("failed to fast-forward base: %w", err)
+	}
+	result.Status = UpdateStatusUpdated
+	result.Detail = fmt.Sprintf("fast-forwarded %s to %s", shortHash(head.Hash()), shortHash(upstream.Hash()))
+	return result, defaultBranch, nil
+}
+
+// updateReplica rebases or merges the branch of the replica at r.Dir onto the default branch of base and records the outcome in r.
+func updateReplica(ctx context.Context, r *UpdateResult, defaultBranch, mode string, fetchRefs FetchFunc) {
+	repo, err := git.PlainOpen(r.Dir)
+	if err != nil {
+		r.Status, r.Detail = UpdateStatusFailed, fmt.Sprintf("failed to open repo: %s", err)
+		return
+	}
+	head, err := repo.Head()
+	if err != nil {
+		r.Status, r.Detail = UpdateStatusFailed, fmt.Sprintf("failed to get HEAD: %s", err)
+		return
+	}
+	if !head.Name().IsBranch() {
+		r.Status, r.Detail = UpdateStatusSkipped, "HEAD is detached"
+		return
+	}
+	modified, _, err := utils.WorktreeChanges(repo)
+	if err != nil {
+		r.Status, r.Detail = UpdateStatusFailed, err.Error()
+		return
+	}
+	if len(modified) > 0 {
+		r.Status, r.Detail = UpdateStatusSkipped, fmt.Sprintf("%d uncommitted changes", len(modified))
+		return
+	}
+
+	if err := fetchRefs(ctx, r.Dir); err != nil {
+		r.Status, r.Detail = UpdateStatusFailed, err.Error()
+		return
+	}
+	upstream := git.DefaultRemoteName + "/" + defaultBranch
+	ref, err := repo.Reference(plumbing.NewRemoteReferenceName(git.DefaultRemoteName, defaultBranch), true)
+	if err != nil {
+		r.Status, r.Detail = UpdateStatusFailed, fmt.Sprintf("failed to read %s: %s", upstream, err)
+		return
+	}
+	upToDate, err := isAncestor(repo, ref.Hash(), head.Hash())
+	if err != nil {
+		r.Status, r.Detail = UpdateStatusFailed, err.Error()
+		return
+	}
+	if upToDate {
+		r.Status = UpdateStatusUpToDate
+		return
+	}
+
+	args := []string{"rebase", "--quiet", upstream}
+	abort := []string{"rebase", "--abort"}
+	if mode == UpdateModeMerge {
+		args = []string{"merge", "--no-edit", "--quiet", upstream}
+		abort = []string{"merge", "--abort"}
+	}
+	if _, err := utils.RunGit(ctx, r.Dir, args...); err != nil {
+		out, _ := utils.RunGit(ctx, r.Dir, "diff", "--name-only", "--diff-filter=U")
+		r.Conflicts = strings.Fields(out)
+		if _, abortErr := utils.RunGit(ctx, r.Dir, abort...); abortErr != nil {
+			r.Status, r.Detail = UpdateStatusFailed, fmt.Sprintf("%s; %s", err, abortErr)
+			return
+		}
+		if len(r.Conflicts) == 0 {
+			r.Status, r.Detail = UpdateStatusFailed, err.Error()
+			return
+		}
+		r.Status, r.Detail = UpdateStatusConflict, fmt.Sprintf("%s onto %s aborted", mode, upstream)
+		return
+	}
+	r.Status = UpdateStatusUpdated
+	if mode == UpdateModeMerge {
+		r.Detail = fmt.Sprintf("merged %s (%s)", upstream, shortHash(ref.Hash()))
+	} else {
+		r.Detail = fmt.Sprintf("rebased onto %s (%s)", upstream, shortHash(ref.Hash()))
+	}
+}
+
+// isAncestor reports whether the commit ancestor is reachable from the commit descendant in repo.
+func isAncestor(repo *git.Repository, ancestor, descendant plumbing.Hash) (bool, error) {
+	if ancestor == descendant {
+		return true, nil
+	}
+	a, err := repo.CommitObject(ancestor)
+	if err != nil {
+		return false, fmt.Errorf("failed to read commit %s: %w", ancestor, err)
+	}
+	d, err := repo.CommitObject(descendant)
+	if err != nil {
+		return false, fmt.Errorf("failed to read commit %s: %w", descendant, err)
+	}
+	return a.IsAncestor(d)
+}
+
+func shortHash(h plumbing.Hash) string {
+	return h.String()[:7]
+}
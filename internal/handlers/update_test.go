@@ -0,0 +1,183 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/stretchr/testify/assert"
+	"github.com/terakoya76/git-replicator/internal/handlers"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+func TestUpdate(t *testing.T) {
+	setTestGitIdentity(t)
+
+	// setup creates base and the replicas clean, conflict, dirty and detached, then adds a commit to origin
+	setup := func(t *testing.T) (string, string, plumbing.Hash) {
+		origin := newTestOrigin(t)
+		repoDir := filepath.Join(t.TempDir(), "github.com", "owner", "repo")
+		for _, branch := range []string{"base", "clean", "conflict", "dirty", "detached"} {
+			dir := filepath.Join(repoDir, branch)
+			repo := cloneTestRepo(t, origin, dir)
+			setTestRemoteURL(t, dir, "https://github.com/owner/repo.git")
+			head, err := repo.Head()
+			if err != nil {
+				t.Fatalf("failed to get HEAD: %v", err)
+			}
+			if branch != "base" {
+				checkoutTestBranch(t, dir, branch, head.Hash())
+			}
+		}
+		commitTestFile(t, filepath.Join(repoDir, "clean"), "clean.txt", "clean\n")
+		commitTestFile(t, filepath.Join(repoDir, "conflict"), "README.md", "# conflict\n")
+		commitTestFile(t, filepath.Join(repoDir, "dirty"), "dirty.txt", "dirty\n")
+		writeTestFile(t, filepath.Join(repoDir, "dirty", "dirty.txt"), "uncommitted\n")
+		if _, err := utils.RunGit(context.Background(), filepath.Join(repoDir, "detached"), "checkout", "--quiet", "--detach"); err != nil {
+			t.Fatalf("failed to detach HEAD: %v", err)
+		}
+		newHead := commitTestFile(t, origin, "README.md", "# updated\n")
+		return origin, repoDir, newHead
+	}
+	headOf := func(t *testing.T, dir string) *plumbing.Reference {
+		repo, err := git.PlainOpen(dir)
+		if err != nil {
+			t.Fatalf("failed to open %s: %v", dir, err)
+		}
+		head, err := repo.Head()
+		if err != nil {
+			t.Fatalf("failed to get HEAD of %s: %v", dir, err)
+		}
+		return head
+	}
+	statusesOf := func(results []handlers.UpdateResult) map[string]string {
+		statuses := map[string]string{}
+		for _, r := range results {
+			statuses[r.Branch] = r.Status
+		}
+		return statuses
+	}
+
+	t.Run("base only", func(t *testing.T) {
+		origin, repoDir, newHead := setup(t)
+		clean := headOf(t, filepath.Join(repoDir, "clean")).Hash()
+		results, err := handlers.Update(context.Background(), handlers.UpdateOptions{RepoDir: repoDir}, fetchTestOrigin(origin))
+		assert.NoError(t, err)
+		if assert.Len(t, results, 1) {
+			assert.Equal(t, handlers.UpdateStatusUpdated, results[0].Status)
+		}
+		assert.Equal(t, newHead, headOf(t, filepath.Join(repoDir, "base")).Hash())
+		assert.Equal(t, clean, headOf(t, filepath.Join(repoDir, "clean")).Hash())
+
+		results, err = handlers.Update(context.Background(), handlers.UpdateOptions{RepoDir: repoDir}, fetchTestOrigin(origin))
+		assert.NoError(t, err)
+		assert.Equal(t, handlers.UpdateStatusUpToDate, results[0].Status)
+	})
+
+	t.Run("rebase", func(t *testing.T) {
+		origin, repoDir, newHead := setup(t)
+		conflictHead := headOf(t, filepath.Join(repoDir, "conflict")).Hash()
+		results, err := handlers.Update(context.Background(), handlers.UpdateOptions{RepoDir: repoDir, Mode: handlers.UpdateModeRebase}, fetchTestOrigin(origin))
+		assert.NoError(t, err)
+		assert.Equal(t, "base", results[0].Branch)
+		assert.Equal(t, map[string]string{
+			"base":     handlers.UpdateStatusUpdated,
+			"clean":    handlers.UpdateStatusUpdated,
+			"conflict": handlers.UpdateStatusConflict,
+			"dirty":    handlers.UpdateStatusSkipped,
+			"detached": handlers.UpdateStatusSkipped,
+		}, statusesOf(results))
+
+		cleanRepo, err := git.PlainOpen(filepath.Join(repoDir, "clean"))
+		assert.NoError(t, err)
+		head := headOf(t, filepath.Join(repoDir, "clean"))
+		assert.Equal(t, plumbing.NewBranchReferenceName("clean"), head.Name())
+		commit, err := cleanRepo.CommitObject(head.Hash())
+		assert.NoError(t, err)
+		assert.Equal(t, []plumbing.Hash{newHead}, commit.ParentHashes)
+
+		// The conflicting rebase was aborted and left the replica as it was
+		for _, r := range results {
+			if r.Branch == "conflict" {
+				assert.Equal(t, []string{"README.md"}, r.Conflicts)
+			}
+		}
+		head = headOf(t, filepath.Join(repoDir, "conflict"))
+		assert.Equal(t, plumbing.NewBranchReferenceName("conflict"), head.Name())
+		assert.Equal(t, conflictHead, head.Hash())
+		state, err := utils.InspectWorkState(context.Background(), filepath.Join(repoDir, "conflict"))
+		assert.NoError(t, err)
+		assert.Empty(t, state.Modified)
+
+		// Running again leaves the rebased replica alone
+		results, err = handlers.Update(context.Background(), handlers.UpdateOptions{RepoDir: repoDir, Mode: handlers.UpdateModeRebase}, fetchTestOrigin(origin))
+		assert.NoError(t, err)
+		assert.Equal(t, handlers.UpdateStatusUpToDate, statusesOf(results)["clean"])
+	})
+
+	t.Run("merge", func(t *testing.T) {
+		origin, repoDir, newHead := setup(t)
+		results, err := handlers.Update(context.Background(), handlers.UpdateOptions{RepoDir: repoDir, Mode: handlers.UpdateModeMerge}, fetchTestOrigin(origin))
+		assert.NoError(t, err)
+		assert.Equal(t, handlers.UpdateStatusUpdated, statusesOf(results)["clean"])
+		assert.Equal(t, handlers.UpdateStatusConflict, statusesOf(results)["conflict"])
+
+		cleanRepo, err := git.PlainOpen(filepath.Join(repoDir, "clean"))
+		assert.NoError(t, err)
+		commit, err := cleanRepo.CommitObject(headOf(t, filepath.Join(repoDir, "clean")).Hash())
+		assert.NoError(t, err)
+		assert.Len(t, commit.ParentHashes, 2)
+		assert.Equal(t, newHead, commit.ParentHashes[1])
+	})
+
+	t.Run("single branch base", func(t *testing.T) {
+		origin, repoDir, newHead := setup(t)
+		baseDir := filepath.Join(repoDir, "base")
+		_, err := utils.RunGit(context.Background(), baseDir, "config", "remote.origin.fetch", "+refs/heads/main:refs/remotes/origin/main")
+		assert.NoError(t, err)
+		// clean has been pushed, which base does not track
+		cleanDir := filepath.Join(repoDir, "clean")
+		pushed := headOf(t, cleanDir).Hash()
+		_, err = utils.RunGit(context.Background(), cleanDir, "push", "--quiet", origin, "clean")
+		assert.NoError(t, err)
+		_, err = utils.RunGit(context.Background(), cleanDir, "update-ref", "refs/remotes/origin/clean", pushed.String())
+		assert.NoError(t, err)
+
+		// Like a single branch clone, base only fetches main
+		fetchFunc := func(ctx context.Context, dir string) error {
+			if dir != baseDir {
+				return fetchTestOrigin(origin)(ctx, dir)
+			}
+			_, err := utils.RunGit(ctx, dir, "fetch", "--quiet", origin, "+refs/heads/main:refs/remotes/origin/main")
+			return err
+		}
+		results, err := handlers.Update(context.Background(), handlers.UpdateOptions{RepoDir: repoDir, Mode: handlers.UpdateModeRebase}, fetchFunc)
+		assert.NoError(t, err)
+		assert.Equal(t, handlers.UpdateStatusUpdated, statusesOf(results)["clean"])
+		cleanRepo, err := git.PlainOpen(cleanDir)
+		assert.NoError(t, err)
+		ref, err := cleanRepo.Reference(plumbing.NewRemoteReferenceName("origin", "clean"), true)
+		if assert.NoError(t, err) {
+			assert.Equal(t, pushed, ref.Hash())
+		}
+		commit, err := cleanRepo.CommitObject(headOf(t, cleanDir).Hash())
+		assert.NoError(t, err)
+		assert.Equal(t, []plumbing.Hash{newHead}, commit.ParentHashes)
+	})
+
+	t.Run("fetch failure", func(t *testing.T) {
+		_, repoDir, _ := setup(t)
+		_, err := handlers.Update(context.Background(), handlers.UpdateOptions{RepoDir: repoDir}, func(ctx context.Context, dir string) error {
+			return errors.New("network down")
+		})
+		assert.EqualError(t, err, "network down")
+	})
+
+	t.Run("invalid mode", func(t *testing.T) {
+		_, err := handlers.Update(context.Background(), handlers.UpdateOptions{Mode: "squash"}, fetchTestOrigin(""))
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DiskUsage is the disk space used by a checkout, split between the .git directory and the worktree.
+type DiskUsage struct {
+	// Git is the size of the .git directory, including the object store.
+	Git      int64 `json:"git"`
+	Worktree int64 `json:"worktree"`
+	// Shared is the size of files hardlinked to files already counted elsewhere. It is not included in Git or Worktree.
+	Shared int64 `json:"shared"`
+}
+
+// Total returns the disk space used by the checkout itself, excluding shared files.
+func (u DiskUsage) Total() int64 {
+	return u.Git + u.Worktree
+}
+
+// Add returns the sum of u and other.
+func (u DiskUsage) Add(other DiskUsage) DiskUsage {
+	return DiskUsage{Git: u.Git + other.Git, Worktree: u.Worktree + other.Worktree, Shared: u.Shared + other.Shared}
+}
+
+// FileSet records the files already counted by MeasureDiskUsage, so that hardlinked files are counted once.
+type FileSet map[fileID]bool
+
+// MeasureDiskUsage returns the disk usage of the checkout at dir.
+// Files already in seen, such as objects hardlinked by a local clone, are counted as shared; the files of dir are added to seen.
+func MeasureDiskUsage(dir string, seen FileSet) (DiskUsage, error) {
+	var usage DiskUsage
+	gitDir := filepath.Join(dir, ".git")
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if id, ok := getFileID(info); ok {
+			if seen[id] {
+				usage.Shared += info.Size()
+				return nil
+			}
+			seen[id] = true
+		}
+		if path == gitDir || strings.HasPrefix(path, gitDir+string(filepath.Separator)) {
+			usage.Git += info.Size()
+		} else {
+			usage.Worktree += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return usage, fmt.Errorf("failed to compute disk usage of %s: %w", dir, err)
+	}
+	return usage, nil
+}
+
+// Alternates returns the object directories the checkout at dir borrows objects from (see gitrepository-layout(5)).
+// Objects in these directories are not part of the checkout's own disk usage.
+func Alternates(dir string) ([]string, error) {
+	objectsDir := filepath.Join(dir, ".git", "objects")
+	f, err := os.Open(filepath.Join(objectsDir, "info", "alternates"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read alternates of %s: %w", dir, err)
+	}
+	defer f.Close()
+
+	var alternates []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// Relative paths are relative to the objects directory
+		if !filepath.IsAbs(line) {
+			line = filepath.Join(objectsDir, line)
+		}
+		alternates = append(alternates, filepath.Clean(line))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read alternates of %s: %w", dir, err)
+	}
+	return alternates, nil
+}
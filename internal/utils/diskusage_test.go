@@ -0,0 +1,66 @@
+package utils_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+func TestMeasureDiskUsage(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeFile := func(path string, size int) {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		assert.NoError(t, os.WriteFile(path, []byte(strings.Repeat("x", size)), 0o644))
+	}
+	first := filepath.Join(tmpDir, "first")
+	writeFile(filepath.Join(first, ".git", "objects", "pack", "pack-1.pack"), 1000)
+	writeFile(filepath.Join(first, ".gitignore"), 10)
+	writeFile(filepath.Join(first, "src", "main.go"), 100)
+
+	// second hardlinks the pack of first, as a local clone does
+	second := filepath.Join(tmpDir, "second")
+	assert.NoError(t, os.MkdirAll(filepath.Join(second, ".git", "objects", "pack"), 0o755))
+	assert.NoError(t, os.Link(filepath.Join(first, ".git", "objects", "pack", "pack-1.pack"), filepath.Join(second, ".git", "objects", "pack", "pack-1.pack")))
+	writeFile(filepath.Join(second, ".git", "index"), 50)
+	writeFile(filepath.Join(second, "main.go"), 200)
+
+	seen := utils.FileSet{}
+	usage, err := utils.MeasureDiskUsage(first, seen)
+	assert.NoError(t, err)
+	assert.Equal(t, utils.DiskUsage{Git: 1000, Worktree: 110}, usage)
+	assert.Equal(t, int64(1110), usage.Total())
+
+	usage, err = utils.MeasureDiskUsage(second, seen)
+	assert.NoError(t, err)
+	assert.Equal(t, utils.DiskUsage{Git: 50, Worktree: 200, Shared: 1000}, usage)
+	assert.Equal(t, int64(250), usage.Total())
+
+	// Measured on its own, second owns the pack
+	usage, err = utils.MeasureDiskUsage(second, utils.FileSet{})
+	assert.NoError(t, err)
+	assert.Equal(t, utils.DiskUsage{Git: 1050, Worktree: 200}, usage)
+
+	_, err = utils.MeasureDiskUsage(filepath.Join(tmpDir, "missing"), utils.FileSet{})
+	assert.Error(t, err)
+}
+
+func TestAlternates(t *testing.T) {
+	tmpDir := t.TempDir()
+	dir := filepath.Join(tmpDir, "replica")
+	infoDir := filepath.Join(dir, ".git", "objects", "info")
+	assert.NoError(t, os.MkdirAll(infoDir, 0o755))
+
+	alternates, err := utils.Alternates(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, alternates)
+
+	content := "/shared/objects\n\n# comment\n../../../base/.git/objects\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(infoDir, "alternates"), []byte(content), 0o644))
+	alternates, err = utils.Alternates(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/shared/objects", filepath.Join(tmpDir, "base", ".git", "objects")}, alternates)
+}
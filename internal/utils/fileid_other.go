@@ -0,0 +1,12 @@
+//go:build !unix
+
+package utils
+
+import "os"
+
+type fileID struct{}
+
+// getFileID is not supported on this platform, so hardlinks are counted once per link.
+func getFileID(info os.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
@@ -4,15 +4,65 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 )
 
-// GetGitReplicatorRoot returns the path to $HOME/git-replicator
-func GetGitReplicatorRoot() (string, error) {
+// RootEnv is the environment variable listing the git-replicator roots, separated like $PATH.
+const RootEnv = "GIT_REPLICATOR_ROOT"
+
+// GetGitReplicatorRoots returns the git-replicator roots as absolute paths, the first being the primary root new repositories are cloned into.
+// The roots are taken from $GIT_REPLICATOR_ROOT, then from configured, and default to $HOME/git-replicator.
+func GetGitReplicatorRoots(configured ...string) ([]string, error) {
+	candidates := configured
+	if env := os.Getenv(RootEnv); env != "" {
+		candidates = filepath.SplitList(env)
+	}
 	home, err := os.UserHomeDir()
 	if err != nil {
-		return "", fmt.Errorf("failed to get home directory: %w", err)
+		return nil, fmt.Errorf("failed to get home directory: %w", err)
+	}
+	var roots []string
+	for _, root := range candidates {
+		if root == "" {
+			continue
+		}
+		if root == "~" || strings.HasPrefix(root, "~"+string(filepath.Separator)) {
+			root = filepath.Join(home, root[1:])
+		}
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			return nil, fmt.Errorf("invalid git-replicator root %s: %w", root, err)
+		}
+		if !slices.Contains(roots, abs) {
+			roots = append(roots, abs)
+		}
+	}
+	if len(roots) == 0 {
+		roots = []string{filepath.Join(home, "git-replicator")}
+	}
+	return roots, nil
+}
+
+// GetGitReplicatorRoot returns the primary git-replicator root, by default $HOME/git-replicator (see GetGitReplicatorRoots).
+func GetGitReplicatorRoot(configured ...string) (string, error) {
+	roots, err := GetGitReplicatorRoots(configured...)
+	if err != nil {
+		return "", err
+	}
+	return roots[0], nil
+}
+
+// FindRoot returns the root of roots that contains dir.
+func FindRoot(roots []string, dir string) (string, error) {
+	for _, root := range roots {
+		rel, err := filepath.Rel(root, dir)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return root, nil
+		}
 	}
-	return filepath.Join(home, "git-replicator"), nil
+	return "", fmt.Errorf("%s is not under any git-replicator root (%s)", dir, strings.Join(roots, ", "))
 }
 
 // FindRepoDir walks up from cwd to gitReplicatorRoot and returns the repo directory (the second-level directory under gitReplicatorRoot, e.g., $HOME/git-replicator/owner/repo).
@@ -26,12 +76,22 @@ func FindRepoDir(cwd, gitReplicatorRoot string) (string, error) {
 			return dir, nil
 		}
 		if dir == gitReplicatorRoot || dir == "/" || dir == "." {
-			return "", fmt.Errorf("could not find repo directory, so move to the repo directory ($HOME/git-replicator/<host>/<owner>/<repo>)")
+			return "", fmt.Errorf("could not find repo directory, so move to the repo directory (%s/<host>/<owner>/<repo>)", gitReplicatorRoot)
 		}
 		dir = parent
 	}
 }
 
+// FindReplicaName returns the name of the branch directory of repoDir that contains cwd.
+func FindReplicaName(cwd, repoDir string) (string, error) {
+	rel, err := filepath.Rel(repoDir, cwd)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("could not find branch directory, so move into a branch directory (%s/<branch>) or name the branches", repoDir)
+	}
+	name, _, _ := strings.Cut(rel, string(filepath.Separator))
+	return name, nil
+}
+
 // RemoveDir deletes the specified directory and all its contents.
 func RemoveDir(dir string) error {
 	if err := os.RemoveAll(dir); err != nil {
@@ -39,3 +99,107 @@ func RemoveDir(dir string) error {
 	}
 	return nil
 }
+
+// BaseDirName is the name of the directory holding the canonical clone of a repository.
+const BaseDirName = "base"
+
+// ReplicaDirName returns the name of the replica directory holding branch, replacing the path separators of names such as "feature/foo" with "-".
+func ReplicaDirName(branch string) string {
+	return strings.NewReplacer("/", "-", `\`, "-").Replace(branch)
+}
+
+// ResolveReplicaDir returns the path of the replica directory of the branch or directory name under repoDir, as named by ReplicaDirName.
+// It rejects names that would not resolve to a direct child of repoDir, such as "..", absolute paths, names with empty, "." or ".." path elements or symlinks pointing elsewhere.
+func ResolveReplicaDir(repoDir, name string) (string, error) {
+	if name == "" || filepath.IsAbs(name) {
+		return "", fmt.Errorf("invalid branch directory name %q: must be a relative name", name)
+	}
+	for _, elem := range strings.Split(strings.ReplaceAll(name, `\`, "/"), "/") {
+		if elem == "" || elem == "." || elem == ".." {
+			return "", fmt.Errorf("invalid branch directory name %q: path elements must not be empty, \".\" or \"..\"", name)
+		}
+	}
+	name = ReplicaDirName(name)
+	absRepo, err := filepath.Abs(repoDir)
+	if err != nil {
+		return "", fmt.Errorf("invalid repoDir: %s", repoDir)
+	}
+	dir := filepath.Join(absRepo, name)
+	if filepath.Dir(dir) != absRepo {
+		return "", fmt.Errorf("invalid branch directory name %q: resolves outside %s", name, repoDir)
+	}
+
+	stat, err := os.Lstat(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return dir, nil
+		}
+		return "", fmt.Errorf("failed to stat %s: %w", dir, err)
+	}
+	if stat.Mode()&os.ModeSymlink != 0 {
+		realRepo, err := filepath.EvalSymlinks(absRepo)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve %s: %w", absRepo, err)
+		}
+		realDir, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve %s: %w", dir, err)
+		}
+		if filepath.Dir(realDir) != realRepo {
+			return "", fmt.Errorf("invalid branch directory %s: symlink resolves outside %s", dir, repoDir)
+		}
+	}
+	return dir, nil
+}
+
+// DirSize returns the total size of the regular files under dir. Symlinks are not followed.
+func DirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to compute size of %s: %w", dir, err)
+	}
+	return size, nil
+}
+
+// LastModified returns the newest modification time of the files in the worktree at dir.
+// The .git directory is skipped except for its index, which changes on every add and commit.
+func LastModified(dir string) (time.Time, error) {
+	var latest time.Time
+	if info, err := os.Stat(filepath.Join(dir, ".git", "index")); err == nil {
+		latest = info.ModTime()
+	}
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		return nil
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to walk %s: %w", dir, err)
+	}
+	return latest, nil
+}
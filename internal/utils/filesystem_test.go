@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/terakoya76/git-replicator/internal/utils"
@@ -103,6 +104,8 @@ func TestGetGitReplicatorRoot(t *testing.T) {
 		t.Fatalf("os.UserHomeDir() failed: %v", err)
 	}
 
+	t.Setenv(utils.RootEnv, "")
+
 	want := filepath.Join(home, "git-replicator")
 	got, err := utils.GetGitReplicatorRoot()
 	if err != nil {
@@ -113,6 +116,70 @@ func TestGetGitReplicatorRoot(t *testing.T) {
 	}
 }
 
+func TestGetGitReplicatorRoots(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Fatalf("os.UserHomeDir() failed: %v", err)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("os.Getwd() failed: %v", err)
+	}
+	sep := string(filepath.ListSeparator)
+
+	tests := []struct {
+		name       string
+		env        string
+		configured []string
+		want       []string
+	}{
+		{name: "default", want: []string{filepath.Join(home, "git-replicator")}},
+		{name: "configured", configured: []string{"/srv/work", "", "~/personal"}, want: []string{"/srv/work", filepath.Join(home, "personal")}},
+		{name: "env overrides config", env: "/srv/env" + sep + "~" + sep + "/srv/env/", configured: []string{"/srv/work"}, want: []string{"/srv/env", home}},
+		{name: "relative paths", configured: []string{"roots/work"}, want: []string{filepath.Join(cwd, "roots", "work")}},
+		{name: "empty entries", env: sep, configured: []string{""}, want: []string{filepath.Join(home, "git-replicator")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(utils.RootEnv, tt.env)
+			got, err := utils.GetGitReplicatorRoots(tt.configured...)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+
+			primary, err := utils.GetGitReplicatorRoot(tt.configured...)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want[0], primary)
+		})
+	}
+}
+
+func TestFindRoot(t *testing.T) {
+	roots := []string{"/srv/work", "/srv/personal"}
+	tests := []struct {
+		name    string
+		dir     string
+		want    string
+		wantErr bool
+	}{
+		{name: "first root", dir: "/srv/work/github.com/owner/repo", want: "/srv/work"},
+		{name: "second root", dir: "/srv/personal/github.com/owner/repo/base", want: "/srv/personal"},
+		{name: "root itself", dir: "/srv/personal", want: "/srv/personal"},
+		{name: "sibling with common prefix", dir: "/srv/workspace/repo", wantErr: true},
+		{name: "outside", dir: "/tmp/repo", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := utils.FindRoot(roots, tt.dir)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
 func TestRemoveDir(t *testing.T) {
 	tmp := t.TempDir()
 
@@ -191,3 +258,120 @@ func TestRemoveDir(t *testing.T) {
 		})
 	}
 }
+
+func TestResolveReplicaDir(t *testing.T) {
+	tmp := t.TempDir()
+	repoDir := filepath.Join(tmp, "github.com", "owner", "repo")
+	otherDir := filepath.Join(tmp, "github.com", "owner", "other")
+	for _, dir := range []string{filepath.Join(repoDir, "feature"), filepath.Join(repoDir, "real"), otherDir} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatalf("failed to mkdir %s: %v", dir, err)
+		}
+	}
+	if err := os.Symlink(otherDir, filepath.Join(repoDir, "outside")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(repoDir, "real"), filepath.Join(repoDir, "inside")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{name: "existing dir", input: "feature", want: filepath.Join(repoDir, "feature")},
+		{name: "not yet existing dir", input: "new", want: filepath.Join(repoDir, "new")},
+		{name: "symlink to sibling replica", input: "inside", want: filepath.Join(repoDir, "inside")},
+		{name: "empty", input: "", wantErr: true},
+		{name: "dot", input: ".", wantErr: true},
+		{name: "parent", input: "..", wantErr: true},
+		{name: "relative traversal", input: "../other", wantErr: true},
+		{name: "slash branch", input: "feature/x", want: filepath.Join(repoDir, "feature-x")},
+		{name: "nested traversal", input: "feature/../other", wantErr: true},
+		{name: "empty element", input: "feature//x", wantErr: true},
+		{name: "absolute", input: otherDir, wantErr: true},
+		{name: "symlink outside", input: "outside", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := utils.ResolveReplicaDir(repoDir, tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDirSize(t *testing.T) {
+	tmp := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(tmp, "sub"), 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(tmp, "a.txt"), make([]byte, 100), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(tmp, "sub", "b.txt"), make([]byte, 28), 0o644))
+	assert.NoError(t, os.Symlink(filepath.Join(tmp, "a.txt"), filepath.Join(tmp, "link")))
+
+	size, err := utils.DirSize(tmp)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(128), size)
+
+	_, err = utils.DirSize(filepath.Join(tmp, "not-exist"))
+	assert.Error(t, err)
+}
+
+func TestLastModified(t *testing.T) {
+	tmp := t.TempDir()
+	old := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	newer := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+	gitDir := filepath.Join(tmp, ".git")
+	assert.NoError(t, os.MkdirAll(gitDir, 0o755))
+	for _, f := range []string{filepath.Join(tmp, "a.txt"), filepath.Join(gitDir, "objects")} {
+		assert.NoError(t, os.WriteFile(f, []byte("data"), 0o644))
+	}
+	for _, p := range []string{tmp, gitDir, filepath.Join(tmp, "a.txt")} {
+		assert.NoError(t, os.Chtimes(p, old, old))
+	}
+
+	got, err := utils.LastModified(tmp)
+	assert.NoError(t, err)
+	assert.Equal(t, old, got)
+
+	// The index counts, other files under .git do not
+	assert.NoError(t, os.WriteFile(filepath.Join(gitDir, "index"), []byte("data"), 0o644))
+	assert.NoError(t, os.Chtimes(filepath.Join(gitDir, "index"), newer, newer))
+	got, err = utils.LastModified(tmp)
+	assert.NoError(t, err)
+	assert.Equal(t, newer, got)
+}
+
+func TestFindReplicaName(t *testing.T) {
+	repoDir := filepath.Join("/root", "git-replicator", "github.com", "owner", "repo")
+	tests := []struct {
+		name    string
+		cwd     string
+		want    string
+		wantErr bool
+	}{
+		{name: "replica", cwd: filepath.Join(repoDir, "feature"), want: "feature"},
+		{name: "subdirectory", cwd: filepath.Join(repoDir, "feature", "src", "pkg"), want: "feature"},
+		{name: "base", cwd: filepath.Join(repoDir, "base"), want: "base"},
+		{name: "repo dir", cwd: repoDir, wantErr: true},
+		{name: "outside", cwd: filepath.Join(repoDir, "..", "other"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := utils.FindReplicaName(tt.cwd, repoDir)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
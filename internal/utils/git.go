@@ -7,29 +7,115 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
 )
 
 func DefaultCloneFunc(ctx context.Context, url, dir string) error {
-	var err error
+	return Clone(ctx, url, dir, CloneOptions{})
+}
+
+// CloneOptions tune the clones made by Clone.
+type CloneOptions struct {
+	// Depth limits the history fetched to this many commits. 0 fetches all of it.
+	Depth             int
+	SingleBranch      bool
+	RecurseSubmodules bool
+	Credentials
+}
+
+// Credentials authenticate clones, fetches and pushes. Without any, HTTPS is anonymous and SSH uses the SSH agent.
+type Credentials struct {
+	// Username and Token authenticate over HTTPS. Username defaults to "git".
+	Username string
+	Token    string
+	// SSHKey is the private key file authenticating over SSH instead of the SSH agent.
+	SSHKey string
+}
+
+// NewCloneFunc returns a clone function like DefaultCloneFunc that applies opts.
+func NewCloneFunc(opts CloneOptions) func(ctx context.Context, url, dir string) error {
+	return func(ctx context.Context, url, dir string) error {
+		return Clone(ctx, url, dir, opts)
+	}
+}
+
+// Clone clones url into dir with opts, reporting progress on stderr.
+func Clone(ctx context.Context, url, dir string, opts CloneOptions) error {
+	auth, err := opts.Credentials.auth(url)
+	if err != nil {
+		return err
+	}
+	cloneOpts := &git.CloneOptions{
+		URL:          url,
+		Auth:         auth,
+		Depth:        opts.Depth,
+		SingleBranch: opts.SingleBranch,
+		Progress:     os.Stderr,
+	}
 	if testing.Testing() {
-		_, err = git.PlainCloneContext(ctx, dir, false, &git.CloneOptions{
-			URL:      url,
-			Progress: io.Discard,
-		})
-	} else {
-		_, err = git.PlainCloneContext(ctx, dir, false, &git.CloneOptions{
-			URL:      url,
-			Progress: os.Stdout,
-		})
+		cloneOpts.Progress = io.Discard
 	}
+	if opts.RecurseSubmodules {
+		cloneOpts.RecurseSubmodules = git.DefaultSubmoduleRecursionDepth
+	}
+	_, err = git.PlainCloneContext(ctx, dir, false, cloneOpts)
 	return err
 }
 
+// auth returns the auth method of c for url, or nil to connect anonymously or through the SSH agent.
+func (c Credentials) auth(url string) (transport.AuthMethod, error) {
+	if strings.HasPrefix(url, "git@") || strings.HasPrefix(url, "ssh://") {
+		if c.SSHKey == "" {
+			return nil, nil
+		}
+		keyFile := c.SSHKey
+		if rest, ok := strings.CutPrefix(keyFile, "~/"); ok {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get home directory: %w", err)
+			}
+			keyFile = filepath.Join(home, rest)
+		}
+		auth, err := gitssh.NewPublicKeysFromFile("git", keyFile, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to load ssh key %s: %w", c.SSHKey, err)
+		}
+		return auth, nil
+	}
+	if c.Token == "" {
+		return nil, nil
+	}
+	username := c.Username
+	if username == "" {
+		username = "git"
+	}
+	return &githttp.BasicAuth{Username: username, Password: c.Token}, nil
+}
+
+// originAuth returns the auth method of c for the origin remote of repo.
+func (c Credentials) originAuth(repo *git.Repository) (transport.AuthMethod, error) {
+	remote, err := repo.Remote(git.DefaultRemoteName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get remote %s: %w", git.DefaultRemoteName, err)
+	}
+	urls := remote.Config().URLs
+	if len(urls) == 0 {
+		return nil, nil
+	}
+	return c.auth(urls[0])
+}
+
 // Validate that repoDir is under gitReplicatorRoot and build the remote URL
 func DefaultGetRemoteURL(repoDir, gitReplicatorRoot string) (string, error) {
 	return BuildRemoteURLFromRepoDir(repoDir, gitReplicatorRoot)
@@ -135,3 +221,483 @@ func SwitchBranch(ctx context.Context, repoDir, branchName string) error {
 	}
 	return nil
 }
+
+// WorkState describes the work in a checkout that would be lost if its directory were removed.
+type WorkState struct {
+	// Modified lists tracked files with staged or unstaged changes.
+	Modified []string
+	// Untracked lists files not tracked by git (ignored files are excluded).
+	Untracked []string
+	// Stashes is the number of stash entries.
+	Stashes int
+	// Unpushed maps a local branch (or "HEAD" when detached) to the number of commits not reachable from any remote-tracking ref.
+	Unpushed map[string]int
+}
+
+// Clean reports whether nothing would be lost by removing the checkout.
+func (s WorkState) Clean() bool {
+	return len(s.Modified) == 0 && len(s.Untracked) == 0 && s.Stashes == 0 && len(s.Unpushed) == 0
+}
+
+// Report returns a human-readable, multi-line description of the work that would be lost.
+func (s WorkState) Report() string {
+	var b strings.Builder
+	if len(s.Modified) > 0 {
+		fmt.Fprintf(&b, "  uncommitted changes (%d):\n", len(s.Modified))
+		for _, f := range s.Modified {
+			fmt.Fprintf(&b, "    %s\n", f)
+		}
+	}
+	if len(s.Untracked) > 0 {
+		fmt.Fprintf(&b, "  untracked files (%d):\n", len(s.Untracked))
+		for _, f := range s.Untracked {
+			fmt.Fprintf(&b, "    %s\n", f)
+		}
+	}
+	if s.Stashes > 0 {
+		fmt.Fprintf(&b, "  stashes: %d\n", s.Stashes)
+	}
+	if len(s.Unpushed) > 0 {
+		b.WriteString("  commits not on any remote:\n")
+		branches := make([]string, 0, len(s.Unpushed))
+		for branch := range s.Unpushed {
+			branches = append(branches, branch)
+		}
+		sort.Strings(branches)
+		for _, branch := range branches {
+			fmt.Fprintf(&b, "    %s: %d\n", branch, s.Unpushed[branch])
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// Summary returns a one-line description of the work that would be lost, e.g. "2 modified, 1 untracked, 3 unpushed commits".
+func (s WorkState) Summary() string {
+	var parts []string
+	if len(s.Modified) > 0 {
+		parts = append(parts, fmt.Sprintf("%d modified", len(s.Modified)))
+	}
+	if len(s.Untracked) > 0 {
+		parts = append(parts, fmt.Sprintf("%d untracked", len(s.Untracked)))
+	}
+	if s.Stashes > 0 {
+		parts = append(parts, fmt.Sprintf("%d stashes", s.Stashes))
+	}
+	unpushed := 0
+	for _, n := range s.Unpushed {
+		unpushed += n
+	}
+	if unpushed > 0 {
+		parts = append(parts, fmt.Sprintf("%d unpushed commits", unpushed))
+	}
+	if len(parts) == 0 {
+		return "clean"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// InspectWorkState inspects the checkout at dir for uncommitted changes, stashes and commits not pushed to any remote.
+func InspectWorkState(ctx context.Context, dir string) (WorkState, error) {
+	var state WorkState
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return state, fmt.Errorf("failed to open repo: %w", err)
+	}
+
+	state.Modified, state.Untracked, err = WorktreeChanges(repo)
+	if err != nil {
+		return state, err
+	}
+
+	state.Stashes, err = countStashes(repo, dir)
+	if err != nil {
+		return state, err
+	}
+
+	state.Unpushed, err = unpushedCommits(ctx, repo)
+	if err != nil {
+		return state, err
+	}
+	return state, nil
+}
+
+// WorktreeChanges returns the tracked files with staged or unstaged changes and the untracked files of the worktree of repo.
+func WorktreeChanges(repo *git.Repository) ([]string, []string, error) {
+	wt, err := repo.Worktree()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get worktree: %w", err)
+	}
+	status, err := wt.StatusWithOptions(git.StatusOptions{Strategy: git.Preload})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get worktree status: %w", err)
+	}
+	var modified, untracked []string
+	for file, fs := range status {
+		switch {
+		case fs.Worktree == git.Untracked:
+			untracked = append(untracked, file)
+		case fs.Staging != git.Unmodified || fs.Worktree != git.Unmodified:
+			modified = append(modified, file)
+		}
+	}
+	sort.Strings(modified)
+	sort.Strings(untracked)
+	return modified, untracked, nil
+}
+
+// countStashes returns the number of stash entries, read from the stash reflog.
+func countStashes(repo *git.Repository, dir string) (int, error) {
+	if _, err := repo.Reference(plumbing.ReferenceName("refs/stash"), false); err != nil {
+		if err == plumbing.ErrReferenceNotFound {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read stash ref: %w", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, ".git", "logs", "refs", "stash"))
+	if err != nil {
+		// refs/stash exists, so there is at least one entry
+		return 1, nil
+	}
+	count := 0
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) != "" {
+			count++
+		}
+	}
+	return max(count, 1), nil
+}
+
+// unpushedCommits counts, per local branch (and detached HEAD), the commits that are not reachable from any remote-tracking ref.
+func unpushedCommits(ctx context.Context, repo *git.Repository) (map[string]int, error) {
+	refs, err := repo.References()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list references: %w", err)
+	}
+	var remoteTips []plumbing.Hash
+	tips := map[string]plumbing.Hash{}
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference {
+			return nil
+		}
+		switch {
+		case ref.Name().IsRemote():
+			remoteTips = append(remoteTips, ref.Hash())
+		case ref.Name().IsBranch():
+			tips[ref.Name().Short()] = ref.Hash()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to iterate references: %w", err)
+	}
+	head, err := repo.Head()
+	if err == nil && !head.Name().IsBranch() {
+		tips["HEAD"] = head.Hash()
+	}
+
+	pushed := map[plumbing.Hash]bool{}
+	if err := walkCommits(ctx, repo, remoteTips, nil, pushed, func(plumbing.Hash) {}); err != nil {
+		return nil, err
+	}
+
+	unpushed := map[string]int{}
+	for branch, tip := range tips {
+		count := 0
+		seen := map[plumbing.Hash]bool{}
+		if err := walkCommits(ctx, repo, []plumbing.Hash{tip}, pushed, seen, func(plumbing.Hash) { count++ }); err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			unpushed[branch] = count
+		}
+	}
+	return unpushed, nil
+}
+
+// walkCommits visits every commit reachable from tips without passing through a commit in stop or one already in seen, marking each visited commit as seen.
+func walkCommits(ctx context.Context, repo *git.Repository, tips []plumbing.Hash, stop, seen map[plumbing.Hash]bool, visit func(plumbing.Hash)) error {
+	stack := append([]plumbing.Hash(nil), tips...)
+	for len(stack) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		h := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[h] || stop[h] {
+			continue
+		}
+		commit, err := repo.CommitObject(h)
+		if err != nil {
+			if err == plumbing.ErrObjectNotFound {
+				continue
+			}
+			return fmt.Errorf("failed to read commit %s: %w", h, err)
+		}
+		seen[h] = true
+		visit(h)
+		stack = append(stack, commit.ParentHashes...)
+	}
+	return nil
+}
+
+// VerifyCheckout checks that dir is a git checkout with a remote pointing at the repository of repoDir ($root/<host>/<owner>/<repo>).
+func VerifyCheckout(dir, repoDir string) error {
+	repoName := filepath.Base(repoDir)
+	owner := filepath.Base(filepath.Dir(repoDir))
+	host := filepath.Base(filepath.Dir(filepath.Dir(repoDir)))
+	want := fmt.Sprintf("%s/%s/%s", host, owner, repoName)
+
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return fmt.Errorf("%s is not a git checkout of %s: %w", dir, want, err)
+	}
+	remotes, err := repo.Remotes()
+	if err != nil {
+		return fmt.Errorf("failed to get remotes: %w", err)
+	}
+	for _, remote := range remotes {
+		for _, u := range remote.Config().URLs {
+			parts, err := ParseGitURL(u)
+			if err != nil {
+				continue
+			}
+			if strings.EqualFold(parts.Host, host) && parts.Owner == owner && parts.Repo == repoName {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%s is not a git checkout of %s: no matching remote", dir, want)
+}
+
+// DefaultFetchFunc is the default implementation for fetching origin in a checkout, for external use
+func DefaultFetchFunc(ctx context.Context, dir string) error {
+	return Fetch(ctx, dir, Credentials{})
+}
+
+// NewFetchFunc returns a fetch function like DefaultFetchFunc that authenticates with the credentials credentialsFor returns for the checkout.
+func NewFetchFunc(credentialsFor func(dir string) (Credentials, error)) func(ctx context.Context, dir string) error {
+	return func(ctx context.Context, dir string) error {
+		creds, err := credentialsFor(dir)
+		if err != nil {
+			return err
+		}
+		return Fetch(ctx, dir, creds)
+	}
+}
+
+// Fetch fetches origin into the checkout at dir with creds, pruning remote-tracking refs deleted on the remote.
+func Fetch(ctx context.Context, dir string, creds Credentials) error {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open repo: %w", err)
+	}
+	auth, err := creds.originAuth(repo)
+	if err != nil {
+		return err
+	}
+	err = repo.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: git.DefaultRemoteName,
+		Auth:       auth,
+		Prune:      true,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return fmt.Errorf("failed to fetch %s: %w", dir, err)
+	}
+	return nil
+}
+
+// DefaultPushFunc is the default implementation for pushing a branch to origin, for external use
+func DefaultPushFunc(ctx context.Context, dir, branch string, forceWithLease bool) error {
+	return Push(ctx, dir, branch, forceWithLease, Credentials{})
+}
+
+// NewPushFunc returns a push function like DefaultPushFunc that authenticates with the credentials credentialsFor returns for the checkout.
+func NewPushFunc(credentialsFor func(dir string) (Credentials, error)) func(ctx context.Context, dir, branch string, forceWithLease bool) error {
+	return func(ctx context.Context, dir, branch string, forceWithLease bool) error {
+		creds, err := credentialsFor(dir)
+		if err != nil {
+			return err
+		}
+		return Push(ctx, dir, branch, forceWithLease, creds)
+	}
+}
+
+// Push pushes branch of the checkout at dir to the branch of the same name on origin with creds.
+// With forceWithLease, a non-fast-forward update is allowed as long as the remote branch is still where the remote-tracking branch says it is.
+// It returns git.NoErrAlreadyUpToDate if origin already has the branch at the same commit.
+func Push(ctx context.Context, dir, branch string, forceWithLease bool, creds Credentials) error {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open repo: %w", err)
+	}
+	auth, err := creds.originAuth(repo)
+	if err != nil {
+		return err
+	}
+	ref := plumbing.NewBranchReferenceName(branch)
+	opts := &git.PushOptions{
+		RemoteName: git.DefaultRemoteName,
+		Auth:       auth,
+		RefSpecs:   []config.RefSpec{config.RefSpec(ref.String() + ":" + ref.String())},
+	}
+	if testing.Testing() {
+		opts.Progress = io.Discard
+	} else {
+		opts.Progress = os.Stderr
+	}
+	if forceWithLease {
+		// Without a remote-tracking branch the lease is that the remote branch does not exist yet, which a plain push already enforces
+		if _, err := repo.Reference(plumbing.NewRemoteReferenceName(git.DefaultRemoteName, branch), true); err == nil {
+			opts.ForceWithLease = &git.ForceWithLease{}
+		}
+	}
+	if err := repo.PushContext(ctx, opts); err != nil {
+		if err == git.NoErrAlreadyUpToDate {
+			return err
+		}
+		return fmt.Errorf("failed to push %s: %w", branch, err)
+	}
+	return nil
+}
+
+// SetUpstream configures branch of the checkout at dir to track the branch of the same name on origin.
+func SetUpstream(dir, branch string) error {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open repo: %w", err)
+	}
+	cfg, err := repo.Config()
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	b, ok := cfg.Branches[branch]
+	if !ok {
+		b = &config.Branch{Name: branch}
+		cfg.Branches[branch] = b
+	}
+	b.Remote = git.DefaultRemoteName
+	b.Merge = plumbing.NewBranchReferenceName(branch)
+	if err := repo.SetConfig(cfg); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	return nil
+}
+
+// FetchRemoteRefs copies the remote-tracking branches of origin from the checkout at srcDir into the checkout at dir, pruning the ones srcDir no longer has.
+// The remote is not contacted: the objects dir is missing are copied from srcDir on the local filesystem.
+func FetchRemoteRefs(ctx context.Context, dir, srcDir string) error {
+	refspec := fmt.Sprintf("+refs/remotes/%[1]s/*:refs/remotes/%[1]s/*", git.DefaultRemoteName)
+	if _, err := RunGit(ctx, dir, "fetch", "--prune", "--no-tags", "--quiet", srcDir, refspec); err != nil {
+		return fmt.Errorf("failed to fetch %s from %s: %w", dir, srcDir, err)
+	}
+	return nil
+}
+
+// TracksAllBranches reports whether the checkout at dir fetches every branch of origin, as opposed to a single branch clone.
+func TracksAllBranches(dir string) (bool, error) {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return false, fmt.Errorf("failed to open repo %s: %w", dir, err)
+	}
+	cfg, err := repo.Config()
+	if err != nil {
+		return false, fmt.Errorf("failed to read config of %s: %w", dir, err)
+	}
+	remote, ok := cfg.Remotes[git.DefaultRemoteName]
+	if !ok {
+		return false, nil
+	}
+	all := config.RefSpec(fmt.Sprintf("+refs/heads/*:refs/remotes/%s/*", git.DefaultRemoteName))
+	return slices.Contains(remote.Fetch, all), nil
+}
+
+// RemoteDefaultBranch returns the default branch of origin, as recorded by refs/remotes/origin/HEAD.
+// Clones that did not record it fall back to the branch checked out in repo.
+func RemoteDefaultBranch(repo *git.Repository) (string, error) {
+	prefix := plumbing.NewRemoteReferenceName(git.DefaultRemoteName, "").String()
+	if ref, err := repo.Reference(plumbing.NewRemoteHEADReferenceName(git.DefaultRemoteName), false); err == nil && ref.Type() == plumbing.SymbolicReference {
+		if branch, ok := strings.CutPrefix(ref.Target().String(), prefix); ok {
+			return branch, nil
+		}
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return "", fmt.Errorf("failed to get HEAD: %w", err)
+	}
+	if !head.Name().IsBranch() {
+		return "", fmt.Errorf("cannot determine the default branch: HEAD is detached")
+	}
+	return head.Name().Short(), nil
+}
+
+// ReachableCommits returns the set of commits reachable from tips.
+func ReachableCommits(ctx context.Context, repo *git.Repository, tips ...plumbing.Hash) (map[plumbing.Hash]bool, error) {
+	seen := map[plumbing.Hash]bool{}
+	if err := walkCommits(ctx, repo, tips, nil, seen, func(plumbing.Hash) {}); err != nil {
+		return nil, err
+	}
+	return seen, nil
+}
+
+// LastCommitTime returns the committer time of the HEAD commit of the checkout at dir.
+func LastCommitTime(dir string) (time.Time, error) {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to open repo: %w", err)
+	}
+	head, err := repo.Head()
+	if err == plumbing.ErrReferenceNotFound {
+		// No commits yet
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get HEAD: %w", err)
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read HEAD commit: %w", err)
+	}
+	return commit.Committer.When, nil
+}
+
+// AheadBehind counts the commits reachable from localTip in local but not from remoteTip in remote (ahead), and the other way around (behind).
+// The two repositories may be different clones of the same project, since commits are compared by hash.
+func AheadBehind(ctx context.Context, local *git.Repository, localTip plumbing.Hash, remote *git.Repository, remoteTip plumbing.Hash) (int, int, error) {
+	remoteSet, err := ReachableCommits(ctx, remote, remoteTip)
+	if err != nil {
+		return 0, 0, err
+	}
+	ahead := 0
+	var common []plumbing.Hash
+	seen := map[plumbing.Hash]bool{}
+	stack := []plumbing.Hash{localTip}
+	for len(stack) > 0 {
+		if err := ctx.Err(); err != nil {
+			return 0, 0, err
+		}
+		h := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[h] {
+			continue
+		}
+		seen[h] = true
+		if remoteSet[h] {
+			common = append(common, h)
+			continue
+		}
+		commit, err := local.CommitObject(h)
+		if err != nil {
+			if err == plumbing.ErrObjectNotFound {
+				continue
+			}
+			return 0, 0, fmt.Errorf("failed to read commit %s: %w", h, err)
+		}
+		ahead++
+		stack = append(stack, commit.ParentHashes...)
+	}
+	commonSet, err := ReachableCommits(ctx, remote, common...)
+	if err != nil {
+		return 0, 0, err
+	}
+	return ahead, len(remoteSet) - len(commonSet), nil
+}
@@ -2,12 +2,16 @@ package utils_test
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/stretchr/testify/assert"
 	"github.com/terakoya76/git-replicator/internal/utils"
 )
@@ -186,3 +190,337 @@ func TestSwitchBranch(t *testing.T) {
 		})
 	}
 }
+
+// initTestRepo creates a repository on main at dir with name committed with content.
+func initTestRepo(t *testing.T, dir, name, content string) plumbing.Hash {
+	t.Helper()
+	repo, err := git.PlainInitWithOptions(dir, &git.PlainInitOptions{
+		InitOptions: git.InitOptions{DefaultBranch: plumbing.NewBranchReferenceName("main")},
+	})
+	assert.NoError(t, err)
+	return commitTestFile(t, repo, dir, name, content)
+}
+
+// commitTestFile writes name with content in the worktree of repo at dir and commits it.
+func commitTestFile(t *testing.T, repo *git.Repository, dir, name, content string) plumbing.Hash {
+	t.Helper()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	wt, err := repo.Worktree()
+	assert.NoError(t, err)
+	_, err = wt.Add(name)
+	assert.NoError(t, err)
+	hash, err := wt.Commit("update "+name, &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	assert.NoError(t, err)
+	return hash
+}
+
+func TestInspectWorkState(t *testing.T) {
+	dir := t.TempDir()
+	initTestRepo(t, dir, "tracked.txt", "v1")
+
+	t.Run("committed but never pushed", func(t *testing.T) {
+		state, err := utils.InspectWorkState(context.Background(), dir)
+		assert.NoError(t, err)
+		assert.False(t, state.Clean())
+		assert.Equal(t, map[string]int{"main": 1}, state.Unpushed)
+		assert.Empty(t, state.Modified)
+		assert.Empty(t, state.Untracked)
+	})
+
+	t.Run("modified and untracked files", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "tracked.txt"), []byte("v2"), 0o644))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "untracked.txt"), []byte("new"), 0o644))
+		state, err := utils.InspectWorkState(context.Background(), dir)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"tracked.txt"}, state.Modified)
+		assert.Equal(t, []string{"untracked.txt"}, state.Untracked)
+		assert.Contains(t, state.Report(), "untracked files (1):")
+		assert.Equal(t, "1 modified, 1 untracked, 1 unpushed commits", state.Summary())
+	})
+
+	t.Run("not a git repo", func(t *testing.T) {
+		_, err := utils.InspectWorkState(context.Background(), t.TempDir())
+		assert.Error(t, err)
+	})
+}
+
+func TestTracksAllBranches(t *testing.T) {
+	dir := t.TempDir()
+	initTestRepo(t, dir, "a.txt", "a")
+	ctx := context.Background()
+
+	tracks, err := utils.TracksAllBranches(dir)
+	assert.NoError(t, err)
+	assert.False(t, tracks)
+
+	_, err = utils.RunGit(ctx, dir, "remote", "add", "origin", "https://github.com/owner/repo.git")
+	assert.NoError(t, err)
+	tracks, err = utils.TracksAllBranches(dir)
+	assert.NoError(t, err)
+	assert.True(t, tracks)
+
+	_, err = utils.RunGit(ctx, dir, "config", "remote.origin.fetch", "+refs/heads/main:refs/remotes/origin/main")
+	assert.NoError(t, err)
+	tracks, err = utils.TracksAllBranches(dir)
+	assert.NoError(t, err)
+	assert.False(t, tracks)
+
+	_, err = utils.TracksAllBranches(t.TempDir())
+	assert.Error(t, err)
+}
+
+func TestLastCommitTime(t *testing.T) {
+	dir := t.TempDir()
+	before := time.Now().Add(-time.Second)
+	initTestRepo(t, dir, "a.txt", "a")
+
+	got, err := utils.LastCommitTime(dir)
+	assert.NoError(t, err)
+	assert.WithinDuration(t, before, got, time.Minute)
+
+	_, err = utils.LastCommitTime(t.TempDir())
+	assert.Error(t, err)
+
+	// A repository without commits has no last commit time
+	empty := t.TempDir()
+	_, err = git.PlainInit(empty, false)
+	assert.NoError(t, err)
+	got, err = utils.LastCommitTime(empty)
+	assert.NoError(t, err)
+	assert.True(t, got.IsZero())
+}
+
+func TestVerifyCheckout(t *testing.T) {
+	tmp := t.TempDir()
+	repoDir := filepath.Join(tmp, "github.com", "owner", "repo")
+
+	tests := []struct {
+		name    string
+		urls    []string
+		noGit   bool
+		wantErr bool
+	}{
+		{name: "https remote", urls: []string{"https://github.com/owner/repo.git"}},
+		{name: "ssh remote", urls: []string{"git@github.com:owner/repo.git"}},
+		{name: "other repository", urls: []string{"https://github.com/owner/other.git"}, wantErr: true},
+		{name: "no remote", wantErr: true},
+		{name: "not a git repo", noGit: true, wantErr: true},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(repoDir, fmt.Sprintf("replica-%d", i))
+			assert.NoError(t, os.MkdirAll(dir, 0o755))
+			if !tt.noGit {
+				repo, err := git.PlainInit(dir, false)
+				assert.NoError(t, err)
+				if len(tt.urls) > 0 {
+					_, err = repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: tt.urls})
+					assert.NoError(t, err)
+				}
+			}
+			err := utils.VerifyCheckout(dir, repoDir)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestClone(t *testing.T) {
+	tmp := t.TempDir()
+	origin := filepath.Join(tmp, "origin")
+	initTestRepo(t, origin, "a.txt", "a")
+	originRepo, err := git.PlainOpen(origin)
+	assert.NoError(t, err)
+	head := commitTestFile(t, originRepo, origin, "b.txt", "b")
+
+	t.Run("shallow", func(t *testing.T) {
+		clone := filepath.Join(t.TempDir(), "clone")
+		cloneFunc := utils.NewCloneFunc(utils.CloneOptions{Depth: 1, SingleBranch: true})
+		assert.NoError(t, cloneFunc(context.Background(), "file://"+origin, clone))
+		repo, err := git.PlainOpen(clone)
+		assert.NoError(t, err)
+		shallow, err := repo.Storer.Shallow()
+		assert.NoError(t, err)
+		assert.Equal(t, []plumbing.Hash{head}, shallow)
+	})
+
+	t.Run("ssh key only applies to ssh urls", func(t *testing.T) {
+		clone := filepath.Join(t.TempDir(), "clone")
+		assert.NoError(t, utils.Clone(context.Background(), origin, clone, utils.CloneOptions{Credentials: utils.Credentials{SSHKey: filepath.Join(tmp, "missing")}}))
+	})
+
+	t.Run("missing ssh key", func(t *testing.T) {
+		err := utils.Clone(context.Background(), "git@example.com:owner/repo.git", filepath.Join(t.TempDir(), "clone"), utils.CloneOptions{Credentials: utils.Credentials{SSHKey: filepath.Join(tmp, "missing")}})
+		assert.ErrorContains(t, err, "failed to load ssh key")
+	})
+}
+
+func TestFetch(t *testing.T) {
+	tmp := t.TempDir()
+	origin := filepath.Join(tmp, "origin")
+	initTestRepo(t, origin, "a.txt", "a")
+	clone := filepath.Join(tmp, "clone")
+	assert.NoError(t, utils.DefaultCloneFunc(context.Background(), origin, clone))
+
+	originRepo, err := git.PlainOpen(origin)
+	assert.NoError(t, err)
+	want := commitTestFile(t, originRepo, origin, "b.txt", "b")
+
+	assert.NoError(t, utils.Fetch(context.Background(), clone, utils.Credentials{}))
+	cloneRepo, err := git.PlainOpen(clone)
+	assert.NoError(t, err)
+	ref, err := cloneRepo.Reference(plumbing.NewRemoteReferenceName("origin", "main"), true)
+	assert.NoError(t, err)
+	assert.Equal(t, want, ref.Hash())
+
+	// Already up to date is not an error
+	assert.NoError(t, utils.Fetch(context.Background(), clone, utils.Credentials{}))
+
+	reachable, err := utils.ReachableCommits(context.Background(), cloneRepo, want)
+	assert.NoError(t, err)
+	assert.Len(t, reachable, 2)
+
+	assert.Error(t, utils.Fetch(context.Background(), filepath.Join(tmp, "not-exist"), utils.Credentials{}))
+}
+
+func TestFetchCredentials(t *testing.T) {
+	tmp := t.TempDir()
+	origin := filepath.Join(tmp, "origin")
+	initTestRepo(t, origin, "a.txt", "a")
+	clone := filepath.Join(tmp, "clone")
+	assert.NoError(t, utils.DefaultCloneFunc(context.Background(), origin, clone))
+	missingKey := utils.Credentials{SSHKey: filepath.Join(tmp, "missing")}
+
+	// The SSH key only applies to SSH remotes
+	fetchFunc := utils.NewFetchFunc(func(dir string) (utils.Credentials, error) {
+		assert.Equal(t, clone, dir)
+		return missingKey, nil
+	})
+	assert.NoError(t, fetchFunc(context.Background(), clone))
+
+	cloneRepo, err := git.PlainOpen(clone)
+	assert.NoError(t, err)
+	assert.NoError(t, cloneRepo.DeleteRemote("origin"))
+	_, err = cloneRepo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{"git@example.com:owner/repo.git"}})
+	assert.NoError(t, err)
+	assert.ErrorContains(t, fetchFunc(context.Background(), clone), "failed to load ssh key")
+	pushFunc := utils.NewPushFunc(func(dir string) (utils.Credentials, error) {
+		return missingKey, nil
+	})
+	assert.ErrorContains(t, pushFunc(context.Background(), clone, "main", false), "failed to load ssh key")
+
+	fetchFunc = utils.NewFetchFunc(func(dir string) (utils.Credentials, error) {
+		return utils.Credentials{}, fmt.Errorf("no settings")
+	})
+	assert.ErrorContains(t, fetchFunc(context.Background(), clone), "no settings")
+}
+
+func TestPush(t *testing.T) {
+	tmp := t.TempDir()
+	work := filepath.Join(tmp, "work")
+	initTestRepo(t, work, "a.txt", "a")
+	origin := filepath.Join(tmp, "origin.git")
+	_, err := git.PlainClone(origin, true, &git.CloneOptions{URL: work})
+	assert.NoError(t, err)
+
+	clone := filepath.Join(tmp, "clone")
+	other := filepath.Join(tmp, "other")
+	assert.NoError(t, utils.DefaultCloneFunc(context.Background(), origin, clone))
+	assert.NoError(t, utils.DefaultCloneFunc(context.Background(), origin, other))
+	cloneRepo, err := git.PlainOpen(clone)
+	assert.NoError(t, err)
+	otherRepo, err := git.PlainOpen(other)
+	assert.NoError(t, err)
+	remoteHead := func() plumbing.Hash {
+		repo, err := git.PlainOpen(origin)
+		assert.NoError(t, err)
+		ref, err := repo.Reference(plumbing.NewBranchReferenceName("feature"), true)
+		assert.NoError(t, err)
+		return ref.Hash()
+	}
+
+	assert.NoError(t, utils.SwitchBranch(context.Background(), clone, "feature"))
+	first := commitTestFile(t, cloneRepo, clone, "b.txt", "b")
+	assert.NoError(t, utils.Push(context.Background(), clone, "feature", false, utils.Credentials{}))
+	assert.Equal(t, first, remoteHead())
+	assert.ErrorIs(t, utils.Push(context.Background(), clone, "feature", false, utils.Credentials{}), git.NoErrAlreadyUpToDate)
+
+	// other rewrites feature behind the back of clone, which needs a lease
+	assert.NoError(t, utils.Fetch(context.Background(), other, utils.Credentials{}))
+	assert.NoError(t, utils.SwitchBranch(context.Background(), other, "feature"))
+	rewritten := commitTestFile(t, otherRepo, other, "c.txt", "c")
+	assert.Error(t, utils.Push(context.Background(), other, "feature", false, utils.Credentials{}))
+	assert.NoError(t, utils.Push(context.Background(), other, "feature", true, utils.Credentials{}))
+	assert.Equal(t, rewritten, remoteHead())
+
+	commitTestFile(t, cloneRepo, clone, "d.txt", "d")
+	assert.Error(t, utils.Push(context.Background(), clone, "feature", false, utils.Credentials{}))
+	// The lease is broken because origin/feature of clone is stale
+	assert.Error(t, utils.Push(context.Background(), clone, "feature", true, utils.Credentials{}))
+	assert.Equal(t, rewritten, remoteHead())
+
+	assert.NoError(t, utils.Fetch(context.Background(), clone, utils.Credentials{}))
+	assert.NoError(t, utils.Push(context.Background(), clone, "feature", true, utils.Credentials{}))
+	head, err := cloneRepo.Head()
+	assert.NoError(t, err)
+	assert.Equal(t, head.Hash(), remoteHead())
+}
+
+func TestSetUpstream(t *testing.T) {
+	dir := t.TempDir()
+	initTestRepo(t, dir, "a.txt", "a")
+	assert.NoError(t, utils.SetUpstream(dir, "main"))
+
+	repo, err := git.PlainOpen(dir)
+	assert.NoError(t, err)
+	cfg, err := repo.Config()
+	assert.NoError(t, err)
+	if assert.Contains(t, cfg.Branches, "main") {
+		assert.Equal(t, "origin", cfg.Branches["main"].Remote)
+		assert.Equal(t, plumbing.NewBranchReferenceName("main"), cfg.Branches["main"].Merge)
+	}
+}
+
+func TestAheadBehind(t *testing.T) {
+	tmp := t.TempDir()
+	origin := filepath.Join(tmp, "origin")
+	initTestRepo(t, origin, "a.txt", "a")
+	clone := filepath.Join(tmp, "clone")
+	assert.NoError(t, utils.DefaultCloneFunc(context.Background(), origin, clone))
+
+	originRepo, err := git.PlainOpen(origin)
+	assert.NoError(t, err)
+	cloneRepo, err := git.PlainOpen(clone)
+	assert.NoError(t, err)
+	originTip := commitTestFile(t, originRepo, origin, "b.txt", "b")
+	commitTestFile(t, originRepo, origin, "c.txt", "c")
+	originTip2, err := originRepo.Head()
+	assert.NoError(t, err)
+	cloneTip := commitTestFile(t, cloneRepo, clone, "d.txt", "d")
+
+	tests := []struct {
+		name       string
+		localTip   plumbing.Hash
+		remoteTip  plumbing.Hash
+		wantAhead  int
+		wantBehind int
+	}{
+		{name: "diverged", localTip: cloneTip, remoteTip: originTip2.Hash(), wantAhead: 1, wantBehind: 2},
+		{name: "diverged from older tip", localTip: cloneTip, remoteTip: originTip, wantAhead: 1, wantBehind: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ahead, behind, err := utils.AheadBehind(context.Background(), cloneRepo, tt.localTip, originRepo, tt.remoteTip)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantAhead, ahead)
+			assert.Equal(t, tt.wantBehind, behind)
+		})
+	}
+}
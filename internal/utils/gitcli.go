@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// RunGit runs the git CLI in dir and returns its standard output.
+// It is used for operations go-git does not support, such as rebase and merge.
+func RunGit(ctx context.Context, dir string, args ...string) (string, error) {
+	return RunGitEnv(ctx, dir, nil, args...)
+}
+
+// RunGitEnv is like RunGit with additional environment variables in the form "KEY=value".
+func RunGitEnv(ctx context.Context, dir string, env []string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return stdout.String(), fmt.Errorf("git %s failed: %w: %s", strings.Join(args, " "), err, msg)
+		}
+		return stdout.String(), fmt.Errorf("git %s failed: %w", strings.Join(args, " "), err)
+	}
+	return stdout.String(), nil
+}
+
+// AlternateObjectsEnv returns the environment that lets git read the objects of the checkouts at dirs in addition to its own.
+// Nothing is written to the object stores, so checkouts of the same project can be compared without adding remotes.
+func AlternateObjectsEnv(dirs ...string) []string {
+	objects := make([]string, len(dirs))
+	for i, dir := range dirs {
+		objects[i] = filepath.Join(dir, ".git", "objects")
+	}
+	return AlternateObjectDirsEnv(objects...)
+}
+
+// AlternateObjectDirsEnv is like AlternateObjectsEnv for object directories, such as those written by SnapshotWorktree.
+func AlternateObjectDirsEnv(objectDirs ...string) []string {
+	return []string{"GIT_ALTERNATE_OBJECT_DIRECTORIES=" + strings.Join(objectDirs, string(filepath.ListSeparator))}
+}
+
+// SnapshotWorktree writes the worktree of the checkout at dir, including uncommitted and untracked files that are not ignored, as a tree object and returns its hash.
+// The new objects are written to objectDir, with the objects of the checkout read as alternates, and a temporary index is used,
+// so the object store, index and refs of the checkout are left untouched. Reading the tree requires objectDir as an alternate (see AlternateObjectDirsEnv).
+func SnapshotWorktree(ctx context.Context, dir, objectDir string) (string, error) {
+	tmp, err := os.CreateTemp("", "git-replicator-index-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary index: %w", err)
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	// Start from the real index so that unchanged files are not hashed again
+	if data, err := os.ReadFile(filepath.Join(dir, ".git", "index")); err == nil {
+		if err := os.WriteFile(tmp.Name(), data, 0o600); err != nil {
+			return "", fmt.Errorf("failed to write temporary index: %w", err)
+		}
+	} else {
+		os.Remove(tmp.Name())
+	}
+
+	env := []string{
+		"GIT_INDEX_FILE=" + tmp.Name(),
+		"GIT_OBJECT_DIRECTORY=" + objectDir,
+		"GIT_ALTERNATE_OBJECT_DIRECTORIES=" + filepath.Join(dir, ".git", "objects"),
+	}
+	if _, err := RunGitEnv(ctx, dir, env, "add", "--all"); err != nil {
+		return "", err
+	}
+	out, err := RunGitEnv(ctx, dir, env, "write-tree")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
@@ -0,0 +1,101 @@
+package utils_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+func TestRunGit(t *testing.T) {
+	dir := t.TempDir()
+	head := initTestRepo(t, dir, "file.txt", "v1")
+
+	out, err := utils.RunGit(context.Background(), dir, "rev-parse", "HEAD")
+	assert.NoError(t, err)
+	assert.Equal(t, head.String(), strings.TrimSpace(out))
+
+	_, err = utils.RunGit(context.Background(), dir, "rev-parse", "no-such-ref")
+	assert.ErrorContains(t, err, "git rev-parse no-such-ref failed")
+}
+
+func TestAlternateObjectsEnv(t *testing.T) {
+	a := t.TempDir()
+	b := t.TempDir()
+	initTestRepo(t, a, "a.txt", "a")
+	other := initTestRepo(t, b, "b.txt", "b")
+
+	_, err := utils.RunGit(context.Background(), a, "cat-file", "-e", other.String())
+	assert.Error(t, err)
+	_, err = utils.RunGitEnv(context.Background(), a, utils.AlternateObjectsEnv(b), "cat-file", "-e", other.String())
+	assert.NoError(t, err)
+}
+
+func TestSnapshotWorktree(t *testing.T) {
+	dir := t.TempDir()
+	initTestRepo(t, dir, "tracked.txt", "v1")
+	committed, err := utils.RunGit(context.Background(), dir, "rev-parse", "HEAD^{tree}")
+	assert.NoError(t, err)
+
+	objectDir := t.TempDir()
+	tree, err := utils.SnapshotWorktree(context.Background(), dir, objectDir)
+	assert.NoError(t, err)
+	assert.Equal(t, strings.TrimSpace(committed), tree)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "tracked.txt"), []byte("v2"), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "new.txt"), []byte("new"), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, ".gitignore"), []byte("ignored.txt\n"), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "ignored.txt"), []byte("ignored"), 0o644))
+	index, err := os.ReadFile(filepath.Join(dir, ".git", "index"))
+	assert.NoError(t, err)
+	objects, err := utils.RunGit(context.Background(), dir, "count-objects")
+	assert.NoError(t, err)
+
+	tree, err = utils.SnapshotWorktree(context.Background(), dir, objectDir)
+	assert.NoError(t, err)
+	// The snapshot is only readable with objectDir as an alternate
+	_, err = utils.RunGit(context.Background(), dir, "cat-file", "-e", tree)
+	assert.Error(t, err)
+	env := utils.AlternateObjectDirsEnv(objectDir)
+	out, err := utils.RunGitEnv(context.Background(), dir, env, "ls-tree", "--name-only", tree)
+	assert.NoError(t, err)
+	assert.Equal(t, ".gitignore\nnew.txt\ntracked.txt\n", out)
+	content, err := utils.RunGitEnv(context.Background(), dir, env, "cat-file", "-p", tree+":tracked.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", content)
+
+	// The index and objects of the checkout are left untouched
+	after, err := os.ReadFile(filepath.Join(dir, ".git", "index"))
+	assert.NoError(t, err)
+	assert.Equal(t, index, after)
+	objectsAfter, err := utils.RunGit(context.Background(), dir, "count-objects")
+	assert.NoError(t, err)
+	assert.Equal(t, objects, objectsAfter)
+	status, err := utils.RunGit(context.Background(), dir, "status", "--porcelain")
+	assert.NoError(t, err)
+	assert.Contains(t, status, "?? new.txt")
+}
+
+func TestFetchRemoteRefs(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	initTestRepo(t, src, "file.txt", "v1")
+	initTestRepo(t, dst, "file.txt", "v1")
+	head, err := utils.RunGit(context.Background(), src, "rev-parse", "HEAD")
+	assert.NoError(t, err)
+	_, err = utils.RunGit(context.Background(), src, "update-ref", "refs/remotes/origin/main", strings.TrimSpace(head))
+	assert.NoError(t, err)
+	_, err = utils.RunGit(context.Background(), dst, "update-ref", "refs/remotes/origin/gone", "HEAD")
+	assert.NoError(t, err)
+
+	assert.NoError(t, utils.FetchRemoteRefs(context.Background(), dst, src))
+	refs, err := utils.RunGit(context.Background(), dst, "for-each-ref", "--format=%(refname) %(objectname)", "refs/remotes/origin")
+	assert.NoError(t, err)
+	assert.Equal(t, "refs/remotes/origin/main "+head, refs)
+
+	assert.Error(t, utils.FetchRemoteRefs(context.Background(), dst, filepath.Join(src, "missing")))
+}
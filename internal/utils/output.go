@@ -0,0 +1,214 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// OutputFormats lists the values accepted by Printer.Output. The empty string means "text".
+var OutputFormats = []string{"text", "json", "yaml", "tsv"}
+
+// Printer writes command results as human-readable text, JSON, YAML, TSV or through a Go template.
+type Printer struct {
+	// Output is one of OutputFormats.
+	Output string
+	// Format is a Go template executed for each item of a slice (or once for any other value). It takes precedence over Output.
+	Format string
+	W      io.Writer
+}
+
+// Structured reports whether the printer writes machine-readable output instead of text.
+func (p Printer) Structured() bool {
+	return p.Format != "" || (p.Output != "" && p.Output != "text")
+}
+
+// Print writes v in the configured format. In text mode it calls text instead.
+// JSON, YAML and TSV field names follow the json struct tags of v.
+func (p Printer) Print(v any, text func(w io.Writer) error) error {
+	// Print empty results as [] rather than null
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice && rv.IsNil() {
+		v = reflect.MakeSlice(rv.Type(), 0, 0).Interface()
+	}
+	if p.Format != "" {
+		return p.printTemplate(v)
+	}
+	switch p.Output {
+	case "", "text":
+		return text(p.W)
+	case "json":
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode json: %w", err)
+		}
+		_, err = fmt.Fprintln(p.W, string(data))
+		return err
+	case "yaml":
+		// Go through JSON so that field names match the json output
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("failed to encode yaml: %w", err)
+		}
+		var generic any
+		if err := json.Unmarshal(data, &generic); err != nil {
+			return fmt.Errorf("failed to encode yaml: %w", err)
+		}
+		out, err := yaml.Marshal(generic)
+		if err != nil {
+			return fmt.Errorf("failed to encode yaml: %w", err)
+		}
+		_, err = p.W.Write(out)
+		return err
+	case "tsv":
+		return p.printTSV(v)
+	default:
+		return fmt.Errorf("unsupported output format: %s (supported: %s)", p.Output, strings.Join(OutputFormats, ", "))
+	}
+}
+
+func (p Printer) printTemplate(v any) error {
+	tmpl, err := template.New("format").Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+		"join": strings.Join,
+	}).Parse(p.Format)
+	if err != nil {
+		return fmt.Errorf("invalid format template: %w", err)
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		if err := tmpl.Execute(p.W, v); err != nil {
+			return fmt.Errorf("failed to execute format template: %w", err)
+		}
+		_, err := fmt.Fprintln(p.W)
+		return err
+	}
+	for i := 0; i < rv.Len(); i++ {
+		if err := tmpl.Execute(p.W, rv.Index(i).Interface()); err != nil {
+			return fmt.Errorf("failed to execute format template: %w", err)
+		}
+		if _, err := fmt.Fprintln(p.W); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printTSV writes a slice of structs as tab-separated values with a header row.
+func (p Printer) printTSV(v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		rv = reflect.Append(reflect.MakeSlice(reflect.SliceOf(rv.Type()), 0, 1), rv)
+	}
+	elemType := rv.Type().Elem()
+	for elemType.Kind() == reflect.Pointer {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		for i := 0; i < rv.Len(); i++ {
+			if _, err := fmt.Fprintln(p.W, tsvValue(rv.Index(i))); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	columns := tsvColumns(elemType, nil)
+	header := make([]string, len(columns))
+	for i, c := range columns {
+		header[i] = c.name
+	}
+	if _, err := fmt.Fprintln(p.W, strings.Join(header, "\t")); err != nil {
+		return err
+	}
+	for i := 0; i < rv.Len(); i++ {
+		elem := reflect.Indirect(rv.Index(i))
+		row := make([]string, len(columns))
+		for j, c := range columns {
+			f, err := elem.FieldByIndexErr(c.index)
+			if err == nil {
+				row[j] = tsvValue(f)
+			}
+		}
+		if _, err := fmt.Fprintln(p.W, strings.Join(row, "\t")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type tsvColumn struct {
+	name  string
+	index []int
+}
+
+// tsvColumns returns the exported fields of t named after their json tags, flattening embedded structs.
+func tsvColumns(t reflect.Type, index []int) []tsvColumn {
+	var columns []tsvColumn
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		fieldIndex := append(append([]int(nil), index...), i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		// Like encoding/json, promote the fields of embedded structs even if their type is unexported
+		if f.Anonymous && f.Type.Kind() == reflect.Struct && name == "" {
+			columns = append(columns, tsvColumns(f.Type, fieldIndex)...)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		columns = append(columns, tsvColumn{name: name, index: fieldIndex})
+	}
+	return columns
+}
+
+func tsvValue(v reflect.Value) string {
+	if !v.IsValid() {
+		return ""
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(time.RFC3339)
+	}
+	var s string
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Struct || v.Type().Elem().Kind() == reflect.Map {
+			data, _ := json.Marshal(v.Interface())
+			s = string(data)
+			break
+		}
+		parts := make([]string, v.Len())
+		for i := range parts {
+			parts[i] = tsvValue(v.Index(i))
+		}
+		s = strings.Join(parts, ",")
+	case reflect.Map, reflect.Struct:
+		data, _ := json.Marshal(v.Interface())
+		s = string(data)
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return ""
+		}
+		return tsvValue(v.Elem())
+	default:
+		s = fmt.Sprint(v.Interface())
+	}
+	return strings.NewReplacer("\t", " ", "\n", " ").Replace(s)
+}
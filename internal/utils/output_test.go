@@ -0,0 +1,149 @@
+package utils_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+type outputInner struct {
+	Dir string `json:"dir"`
+}
+
+type outputItem struct {
+	outputInner
+	Name    string    `json:"name"`
+	Tags    []string  `json:"tags"`
+	Updated time.Time `json:"updated"`
+	Note    string    `json:"note,omitempty"`
+	hidden  string
+}
+
+func TestPrinter(t *testing.T) {
+	updated := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	items := []outputItem{
+		{outputInner: outputInner{Dir: "/root/a"}, Name: "a", Tags: []string{"x", "y"}, Updated: updated, hidden: "h"},
+		{outputInner: outputInner{Dir: "/root/b"}, Name: "b\tc"},
+	}
+
+	tests := []struct {
+		name    string
+		printer utils.Printer
+		value   any
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "text",
+			printer: utils.Printer{Output: "text"},
+			value:   items,
+			want:    "text output\n",
+		},
+		{
+			name:    "default is text",
+			printer: utils.Printer{},
+			value:   items,
+			want:    "text output\n",
+		},
+		{
+			name:    "json",
+			printer: utils.Printer{Output: "json"},
+			value:   items[:1],
+			want: `[
+  {
+    "dir": "/root/a",
+    "name": "a",
+    "tags": [
+      "x",
+      "y"
+    ],
+    "updated": "2024-01-02T03:04:05Z"
+  }
+]
+`,
+		},
+		{
+			name:    "json empty slice",
+			printer: utils.Printer{Output: "json"},
+			value:   []outputItem(nil),
+			want:    "[]\n",
+		},
+		{
+			name:    "yaml",
+			printer: utils.Printer{Output: "yaml"},
+			value:   items[:1],
+			want: `- dir: /root/a
+  name: a
+  tags:
+    - x
+    - "y"
+  updated: "2024-01-02T03:04:05Z"
+`,
+		},
+		{
+			name:    "tsv",
+			printer: utils.Printer{Output: "tsv"},
+			value:   items,
+			want:    "dir\tname\ttags\tupdated\tnote\n/root/a\ta\tx,y\t2024-01-02T03:04:05Z\t\n/root/b\tb c\t\t\t\n",
+		},
+		{
+			name:    "tsv single value",
+			printer: utils.Printer{Output: "tsv"},
+			value:   items[0],
+			want:    "dir\tname\ttags\tupdated\tnote\n/root/a\ta\tx,y\t2024-01-02T03:04:05Z\t\n",
+		},
+		{
+			name:    "template per item",
+			printer: utils.Printer{Output: "json", Format: "{{.Name}} {{.Dir}} {{join .Tags \"+\"}}"},
+			value:   items,
+			want:    "a /root/a x+y\nb\tc /root/b \n",
+		},
+		{
+			name:    "template single value",
+			printer: utils.Printer{Format: "{{json .Tags}}"},
+			value:   items[0],
+			want:    "[\"x\",\"y\"]\n",
+		},
+		{
+			name:    "invalid template",
+			printer: utils.Printer{Format: "{{.Name"},
+			value:   items,
+			wantErr: true,
+		},
+		{
+			name:    "unsupported output",
+			printer: utils.Printer{Output: "xml"},
+			value:   items,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			p := tt.printer
+			p.W = &buf
+			err := p.Print(tt.value, func(w io.Writer) error {
+				_, err := io.WriteString(w, "text output\n")
+				return err
+			})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, buf.String())
+		})
+	}
+}
+
+func TestPrinterStructured(t *testing.T) {
+	assert.False(t, utils.Printer{}.Structured())
+	assert.False(t, utils.Printer{Output: "text"}.Structured())
+	assert.True(t, utils.Printer{Output: "json"}.Structured())
+	assert.True(t, utils.Printer{Format: "{{.Name}}"}.Structured())
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package utils
+
+// ProcessAlive cannot check processes on this platform, so every process is assumed to run.
+func ProcessAlive(pid int) bool {
+	return true
+}
@@ -0,0 +1,20 @@
+//go:build unix
+
+package utils_test
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+func TestProcessAlive(t *testing.T) {
+	assert.True(t, utils.ProcessAlive(os.Getpid()))
+
+	cmd := exec.Command("true")
+	assert.NoError(t, cmd.Run())
+	assert.False(t, utils.ProcessAlive(cmd.Process.Pid))
+}
@@ -0,0 +1,15 @@
+//go:build unix
+
+package utils
+
+import (
+	"errors"
+	"syscall"
+)
+
+// ProcessAlive reports whether a process with pid runs on this host.
+func ProcessAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	// EPERM means that the process exists but belongs to another user
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"T", 1 << 40},
+	{"G", 1 << 30},
+	{"M", 1 << 20},
+	{"K", 1 << 10},
+	{"B", 1},
+}
+
+// ParseSize parses a byte size such as "512M", "20G" or "1.5T" (binary units, optional trailing "B" or "iB").
+func ParseSize(s string) (int64, error) {
+	str := strings.ToUpper(strings.TrimSpace(s))
+	str = strings.TrimSuffix(str, "IB")
+	if len(str) > 1 {
+		str = strings.TrimSuffix(str, "B")
+	}
+	unit := int64(1)
+	for _, u := range sizeUnits {
+		if n, ok := strings.CutSuffix(str, u.suffix); ok {
+			str, unit = n, u.bytes
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(str, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid size: %s", s)
+	}
+	return int64(v * float64(unit)), nil
+}
+
+// FormatSize formats a byte size using binary units, e.g. "1.5G".
+func FormatSize(n int64) string {
+	for _, u := range sizeUnits[:len(sizeUnits)-1] {
+		if n >= u.bytes {
+			return fmt.Sprintf("%.1f%s", float64(n)/float64(u.bytes), u.suffix)
+		}
+	}
+	return fmt.Sprintf("%dB", n)
+}
@@ -0,0 +1,59 @@
+package utils_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    int64
+		wantErr bool
+	}{
+		{name: "bytes", input: "512", want: 512},
+		{name: "bytes with suffix", input: "512B", want: 512},
+		{name: "kilobytes", input: "4K", want: 4 << 10},
+		{name: "megabytes", input: "512M", want: 512 << 20},
+		{name: "gigabytes", input: "20G", want: 20 << 30},
+		{name: "gibibytes", input: "20GiB", want: 20 << 30},
+		{name: "lower case", input: "1gb", want: 1 << 30},
+		{name: "fractional", input: "1.5T", want: 3 << 39},
+		{name: "negative", input: "-1G", wantErr: true},
+		{name: "invalid", input: "big", wantErr: true},
+		{name: "empty", input: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := utils.ParseSize(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		input int64
+		want  string
+	}{
+		{0, "0B"},
+		{1023, "1023B"},
+		{1536, "1.5K"},
+		{20 << 30, "20.0G"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			assert.Equal(t, tt.want, utils.FormatSize(tt.input))
+		})
+	}
+}
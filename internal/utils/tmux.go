@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ErrTmuxNoSession is returned by RunTmux when the target session does not exist, including when no tmux server is running.
+var ErrTmuxNoSession = errors.New("tmux session not found")
+
+// DefaultTmuxFunc is the default implementation for running tmux commands, for external use
+func DefaultTmuxFunc(ctx context.Context, args ...string) (string, error) {
+	return RunTmux(ctx, "", args...)
+}
+
+// RunTmux runs tmux with args and returns its standard output. A non-empty socket selects a separate tmux server (tmux -L).
+func RunTmux(ctx context.Context, socket string, args ...string) (string, error) {
+	if socket != "" {
+		args = append([]string{"-L", socket}, args...)
+	}
+	cmd := exec.CommandContext(ctx, "tmux", args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("tmux %s failed: %w: %s", strings.Join(args, " "), err, msg)
+			if isTmuxNoSession(msg) {
+				err = fmt.Errorf("%w: %w", ErrTmuxNoSession, err)
+			}
+			return stdout.String(), err
+		}
+		return stdout.String(), fmt.Errorf("tmux %s failed: %w", strings.Join(args, " "), err)
+	}
+	return stdout.String(), nil
+}
+
+// isTmuxNoSession reports whether the error message msg of tmux says that the session, or the whole server, does not exist.
+func isTmuxNoSession(msg string) bool {
+	if strings.HasPrefix(msg, "can't find session") || strings.HasPrefix(msg, "no server running") {
+		return true
+	}
+	// A server that is shutting down, e.g. right after kill-server, drops the connection
+	if msg == "server exited unexpectedly" {
+		return true
+	}
+	// The socket of the server is removed when its last session ends
+	return strings.HasPrefix(msg, "error connecting to") && strings.HasSuffix(msg, "(No such file or directory)")
+}
+
+// AttachTmux attaches the terminal to the tmux window target, e.g. "@3", of session.
+// Inside tmux the current client is switched to it instead of nesting sessions.
+func AttachTmux(session, target string) error {
+	if _, err := RunTmux(context.Background(), "", "select-window", "-t", target); err != nil {
+		return err
+	}
+	args := []string{"attach-session", "-t", "=" + session}
+	if os.Getenv("TMUX") != "" {
+		args = []string{"switch-client", "-t", "=" + session}
+	}
+	cmd := exec.Command("tmux", args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to attach to tmux session %s: %w", session, err)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package utils_test
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/terakoya76/git-replicator/internal/utils"
+)
+
+func TestRunTmux(t *testing.T) {
+	if _, err := exec.LookPath("tmux"); err != nil {
+		t.Skip("tmux is not installed")
+	}
+	socket := fmt.Sprintf("git-replicator-test-%d", time.Now().UnixNano())
+	ctx := context.Background()
+	t.Cleanup(func() {
+		_, _ = utils.RunTmux(ctx, socket, "kill-server")
+	})
+
+	_, err := utils.RunTmux(ctx, socket, "new-session", "-d", "-s", "test", "-n", "first")
+	assert.NoError(t, err)
+	out, err := utils.RunTmux(ctx, socket, "list-windows", "-t", "=test", "-F", "#{window_name}")
+	assert.NoError(t, err)
+	assert.Equal(t, "first", strings.TrimSpace(out))
+
+	_, err = utils.RunTmux(ctx, socket, "has-session", "-t", "=missing")
+	assert.ErrorContains(t, err, "tmux -L "+socket+" has-session")
+	assert.ErrorIs(t, err, utils.ErrTmuxNoSession)
+
+	// Other failures are not mistaken for a missing session
+	_, err = utils.RunTmux(ctx, socket, "no-such-command")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, utils.ErrTmuxNoSession)
+
+	_, err = utils.RunTmux(ctx, socket, "kill-server")
+	assert.NoError(t, err)
+	_, err = utils.RunTmux(ctx, socket, "has-session", "-t", "=test")
+	assert.ErrorIs(t, err, utils.ErrTmuxNoSession)
+}